@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// annotationUnsafeChars match anything that could end the statement comment
+// or break its key=value format
+var annotationUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+type annotationKey struct{}
+
+type roleKey struct{}
+
+type suppressQueryLogKey struct{}
+
+// statementAnnotation identifies the operation that runs a statement.
+type statementAnnotation struct {
+	role      string
+	requestID string
+}
+
+// withAnnotation returns ctx carrying the comment that annotate_statements
+// prepends to the operation's statements. The plugin doesn't receive Vault's
+// request ID, so each operation gets a generated one that is also logged.
+func (m *MySQL) withAnnotation(ctx context.Context, operation, role string) context.Context {
+	if !m.AnnotateStatements {
+		return ctx
+	}
+
+	requestID, err := uuid.GenerateUUID()
+	if err != nil {
+		m.logger.Debug("failed to generate request ID for statement annotations", "error", err)
+	}
+	m.logger.Debug("annotating statements", "operation", operation, "role", role, "request_id", requestID)
+	return context.WithValue(ctx, annotationKey{}, statementAnnotation{role: role, requestID: requestID})
+}
+
+// annotateQuery prepends the operation's comment to query, e.g.
+// "/* vault:role=app req=1f0c... */ CREATE USER ...". Statements run outside
+// of an annotated operation are returned unchanged.
+func annotateQuery(ctx context.Context, query string) string {
+	a, ok := ctx.Value(annotationKey{}).(statementAnnotation)
+	if !ok {
+		return query
+	}
+	return "/* vault:role=" + annotationUnsafeChars.ReplaceAllString(a.role, "_") +
+		" req=" + annotationUnsafeChars.ReplaceAllString(a.requestID, "_") + " */ " + query
+}
+
+// withAnnotations prepends the operation's comment to each query run. It
+// must wrap the runner directly, so the other wrappers still see the query
+// as rendered. The server ignores the comment, so unsupported prepared
+// statements still fail with error 1295 and fall back to running unprepared.
+func withAnnotations(run queryRunner) queryRunner {
+	return func(ctx context.Context, execer queryExecer, query string) error {
+		return run(ctx, execer, annotateQuery(ctx, query))
+	}
+}
+
+// withRole returns ctx carrying the role of the user an operation is run
+// for, which selects role specific session settings.
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// roleFromContext returns the role carried by ctx, empty if none is.
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey{}).(string)
+	return role
+}
+
+// withQueryLogSuppressed returns ctx asking for the operation's statements
+// to be kept out of the general query log.
+func withQueryLogSuppressed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressQueryLogKey{}, true)
+}
+
+// queryLogSuppressed reports whether ctx asks for the statements to be kept
+// out of the general query log.
+func queryLogSuppressed(ctx context.Context) bool {
+	suppressed, _ := ctx.Value(suppressQueryLogKey{}).(bool)
+	return suppressed
+}
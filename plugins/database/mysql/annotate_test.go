@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestMySQL_annotateStatements(t *testing.T) {
+	d := &fakeDriver{
+		// The server rejects preparing CREATE USER regardless of the comment
+		prepareErrs: map[string]error{
+			"/* vault:role=app__ req=": &mysql.MySQLError{Number: 1295},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.AnnotateStatements = true
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app*/",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	if _, err := db.NewUser(context.Background(), req); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	annotated := regexp.MustCompile(`^exec: /\* vault:role=app__ req=[0-9a-f-]{36} \*/ CREATE USER `)
+	for _, call := range d.calls() {
+		if strings.HasPrefix(call, "exec: ") && !strings.HasPrefix(call, "exec: SET") {
+			if !annotated.MatchString(call) {
+				t.Fatalf("expected an annotated statement, got: %q", call)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected CREATE USER to run unprepared, got: %v", d.calls())
+}
+
+func TestAnnotateQuery(t *testing.T) {
+	query := "DROP USER 'v_test'@'%'"
+	if actual := annotateQuery(context.Background(), query); actual != query {
+		t.Fatalf("expected an unannotated query, got: %q", actual)
+	}
+
+	ctx := context.WithValue(context.Background(), annotationKey{}, statementAnnotation{role: "app", requestID: "abc"})
+	expected := "/* vault:role=app req=abc */ " + query
+	if actual := annotateQuery(ctx, query); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the audit log.
+const (
+	auditNewUser    = "new_user"
+	auditDeleteUser = "delete_user"
+	auditUpdateUser = "update_user"
+)
+
+// auditRecord is a single line of the JSON audit log. Fields are only ever
+// added, so existing parsers keep working.
+type auditRecord struct {
+	Time       string `json:"time"`
+	Operation  string `json:"operation"`
+	Username   string `json:"username,omitempty"`
+	RoleName   string `json:"role_name,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+}
+
+// auditLog writes one JSON record per line to w.
+type auditLog struct {
+	sync.Mutex
+	w io.WriteCloser
+}
+
+// openAuditLog opens the file at path for appending audit records.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit_log_path: %w", err)
+	}
+	return &auditLog{w: f}, nil
+}
+
+func (a *auditLog) write(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	_, err = a.w.Write(append(line, '\n'))
+	return err
+}
+
+func (a *auditLog) close() error {
+	a.Lock()
+	defer a.Unlock()
+	return a.w.Close()
+}
+
+// closeAuditLog closes the audit log if one is open.
+func (m *MySQL) closeAuditLog() {
+	if m.audit == nil {
+		return
+	}
+	if err := m.audit.close(); err != nil {
+		m.logger.Error("failed to close audit log", "error", err)
+	}
+	m.audit = nil
+}
+
+// auditOperation records the outcome of an operation if an audit log is
+// configured. Every value passes through the plugin's secret values, so the
+// connection password never reaches the log.
+func (m *MySQL) auditOperation(operation string, start time.Time, username, roleName string, opErr error) {
+	if m.audit == nil {
+		return
+	}
+
+	var replacements []string
+	for secret, replacement := range m.SecretValues() {
+		if secret != "" {
+			replacements = append(replacements, secret, replacement)
+		}
+	}
+	sanitize := strings.NewReplacer(replacements...).Replace
+
+	record := auditRecord{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		Operation:  operation,
+		Username:   sanitize(username),
+		RoleName:   sanitize(roleName),
+		DurationMS: time.Since(start).Milliseconds(),
+		Outcome:    "success",
+	}
+	if opErr != nil {
+		record.Outcome = "failure"
+		record.Error = sanitize(opErr.Error())
+	}
+
+	if err := m.audit.write(record); err != nil {
+		m.logger.Error("failed to write audit record", "operation", operation, "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestMySQL_auditLog(t *testing.T) {
+	d := &fakeDriver{
+		errs: map[string]error{
+			"DROP USER 'v_fail'": errors.New("access denied using password hunter2"),
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.Password = "hunter2"
+	buf := &bytes.Buffer{}
+	db.audit = &auditLog{w: nopWriteCloser{buf}}
+
+	for _, username := range []string{"v_ok", "v_fail"} {
+		req := dbplugin.DeleteUserRequest{
+			Username: username,
+			Statements: dbplugin.Statements{
+				Commands: []string{"DROP USER '{{name}}'@'%'"},
+			},
+		}
+		db.DeleteUser(context.Background(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, got: %q", buf.String())
+	}
+
+	var records []auditRecord
+	for _, line := range lines {
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid audit record %q: %s", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if records[0].Operation != auditDeleteUser || records[0].Username != "v_ok" || records[0].Outcome != "success" {
+		t.Fatalf("unexpected record: %#v", records[0])
+	}
+	if records[1].Outcome != "failure" || records[1].Error == "" {
+		t.Fatalf("unexpected record: %#v", records[1])
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("audit log contains the connection password: %s", buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// jitterRand is seeded per process so plugin instances recovering from the
+// same outage don't wait in lockstep.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// jitterDelay returns the delay to wait before retrying instead of d, as
+// chosen by the backoff_jitter strategy: "full" waits a random duration up
+// to d, "equal" (the default) waits at least half of d plus a random
+// duration up to the other half, and "none" waits d.
+func jitterDelay(strategy string, d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+
+	switch strategy {
+	case backoffJitterNone:
+		return d
+	case backoffJitterFull:
+		return randDuration(d)
+	default:
+		half := d / 2
+		return half + randDuration(d-half)
+	}
+}
+
+// randDuration returns a random duration in [0, d).
+func randDuration(d time.Duration) time.Duration {
+	jitterRand.Lock()
+	defer jitterRand.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(d)))
+}
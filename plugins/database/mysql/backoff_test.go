@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterDelay(t *testing.T) {
+	type testCase struct {
+		strategy string
+		min      time.Duration
+		max      time.Duration
+	}
+
+	tests := map[string]testCase{
+		"default": {
+			min: 500 * time.Millisecond,
+			max: time.Second,
+		},
+		"equal": {
+			strategy: backoffJitterEqual,
+			min:      500 * time.Millisecond,
+			max:      time.Second,
+		},
+		"full": {
+			strategy: backoffJitterFull,
+			max:      time.Second,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				delay := jitterDelay(test.strategy, time.Second)
+				if delay < test.min || delay >= test.max {
+					t.Fatalf("expected a delay in [%s, %s), got %s", test.min, test.max, delay)
+				}
+				seen[delay] = true
+			}
+			if len(seen) < 2 {
+				t.Fatalf("expected the delays to vary")
+			}
+		})
+	}
+
+	if delay := jitterDelay(backoffJitterNone, time.Second); delay != time.Second {
+		t.Fatalf("expected no jitter, got %s", delay)
+	}
+	if delay := jitterDelay(backoffJitterFull, 0); delay != 0 {
+		t.Fatalf("expected a zero delay to stay zero, got %s", delay)
+	}
+}
@@ -0,0 +1,138 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+)
+
+// resourceGroupsSQL fails where resource groups are unavailable even though
+// the version supports them, e.g. when the server lacks CAP_SYS_NICE or
+// runs the thread pool plugin
+const resourceGroupsSQL = "SELECT COUNT(*) FROM INFORMATION_SCHEMA.RESOURCE_GROUPS"
+
+// eventSchedulerSQL reads whether the event scheduler runs, "ON" if it does
+const eventSchedulerSQL = "SELECT @@GLOBAL.event_scheduler"
+
+// Capabilities describes the account management features of the connected
+// server, so callers can offer only the options it supports.
+type Capabilities struct {
+	// Version is the version reported by the server
+	Version string `json:"version"`
+	// MariaDB is true for MariaDB servers
+	MariaDB bool `json:"mariadb"`
+	// Roles is true if CREATE ROLE and granting roles are supported
+	Roles bool `json:"roles"`
+	// AccountLocking is true if ACCOUNT LOCK and UNLOCK are supported
+	AccountLocking bool `json:"account_locking"`
+	// DualPasswords is true if ALTER USER ... RETAIN CURRENT PASSWORD is
+	// supported
+	DualPasswords bool `json:"dual_passwords"`
+	// ResourceGroups is true if resource groups are supported and available
+	ResourceGroups bool `json:"resource_groups"`
+	// RandomPassword is true if IDENTIFIED BY RANDOM PASSWORD is supported
+	RandomPassword bool `json:"random_password"`
+	// Attributes is true if user ATTRIBUTE and COMMENT are supported
+	Attributes bool `json:"attributes"`
+	// RenameUser is true if RENAME USER is supported
+	RenameUser bool `json:"rename_user"`
+	// PasswordLifetime is true if PASSWORD EXPIRE INTERVAL is supported
+	PasswordLifetime bool `json:"password_lifetime"`
+	// EventScheduler is true if the event scheduler is running, so
+	// scheduled events like those of server_side_ttl_events are run
+	EventScheduler bool `json:"event_scheduler"`
+}
+
+// capabilitiesCache keeps the capabilities probed on a pool. They are
+// probed again once the pool is replaced after a reconnect, and when the
+// plugin is initialized again.
+type capabilitiesCache struct {
+	sync.Mutex
+	db           *sql.DB
+	capabilities *Capabilities
+}
+
+// reset drops the cached capabilities.
+func (c *capabilitiesCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.db = nil
+	c.capabilities = nil
+}
+
+// Capabilities returns the features supported by the connected server,
+// derived from its version and, for resource groups and the event scheduler,
+// a probe of the server.
+func (m *MySQL) Capabilities(ctx context.Context) (Capabilities, error) {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
+		return Capabilities{}, err
+	}
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	m.capabilities.Lock()
+	defer m.capabilities.Unlock()
+
+	if m.capabilities.capabilities != nil && m.capabilities.db == db {
+		return *m.capabilities.capabilities, nil
+	}
+
+	capabilities, err := probeCapabilities(ctx, db)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	m.capabilities.db = db
+	m.capabilities.capabilities = &capabilities
+	return capabilities, nil
+}
+
+// probeCapabilities reads the server version and probes the features that
+// can be unavailable on a supporting version.
+func probeCapabilities(ctx context.Context, db *sql.DB) (Capabilities, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, serverVersionSQL).Scan(&version); err != nil {
+		return Capabilities{}, err
+	}
+
+	mariaDB := strings.Contains(strings.ToLower(version), "mariadb")
+	mySQLAtLeast := func(min ...int) bool {
+		return !mariaDB && versionAtLeast(version, min, nil)
+	}
+
+	capabilities := Capabilities{
+		Version:          version,
+		MariaDB:          mariaDB,
+		Roles:            versionAtLeast(version, []int{8, 0, 0}, []int{10, 0, 5}),
+		AccountLocking:   supportsAccountLock(version),
+		DualPasswords:    mySQLAtLeast(8, 0, 14),
+		RandomPassword:   mySQLAtLeast(8, 0, 18),
+		Attributes:       mySQLAtLeast(8, 0, 21),
+		RenameUser:       versionAtLeast(version, []int{5, 0, 2}, nil),
+		PasswordLifetime: supportsPasswordLifetime(version),
+	}
+
+	if mySQLAtLeast(8, 0, 3) {
+		var count int
+		err := db.QueryRowContext(ctx, resourceGroupsSQL).Scan(&count)
+		if err != nil && ctx.Err() != nil {
+			return Capabilities{}, ctx.Err()
+		}
+		capabilities.ResourceGroups = err == nil
+	}
+
+	var scheduler string
+	err := db.QueryRowContext(ctx, eventSchedulerSQL).Scan(&scheduler)
+	if err != nil && ctx.Err() != nil {
+		return Capabilities{}, ctx.Err()
+	}
+	capabilities.EventScheduler = err == nil && strings.EqualFold(scheduler, "ON")
+
+	return capabilities, nil
+}
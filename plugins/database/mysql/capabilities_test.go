@@ -0,0 +1,151 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	type testCase struct {
+		version           string
+		resourceGroupsErr error
+		scheduler         string
+		expected          Capabilities
+	}
+
+	tests := map[string]testCase{
+		"mysql 5.6": {
+			version:  "5.6.51",
+			expected: Capabilities{Version: "5.6.51", RenameUser: true},
+		},
+		"mysql 5.7": {
+			version: "5.7.44-log",
+			expected: Capabilities{
+				Version:          "5.7.44-log",
+				AccountLocking:   true,
+				RenameUser:       true,
+				PasswordLifetime: true,
+			},
+		},
+		"mysql 8.0": {
+			version:   "8.0.32",
+			scheduler: "ON",
+			expected: Capabilities{
+				Version:          "8.0.32",
+				Roles:            true,
+				AccountLocking:   true,
+				DualPasswords:    true,
+				ResourceGroups:   true,
+				RandomPassword:   true,
+				Attributes:       true,
+				RenameUser:       true,
+				PasswordLifetime: true,
+				EventScheduler:   true,
+			},
+		},
+		"mysql 8.0 without resource groups": {
+			version:           "8.0.14",
+			resourceGroupsErr: &mysql.MySQLError{Number: 3658},
+			expected: Capabilities{
+				Version:          "8.0.14",
+				Roles:            true,
+				AccountLocking:   true,
+				DualPasswords:    true,
+				RenameUser:       true,
+				PasswordLifetime: true,
+			},
+		},
+		"mariadb": {
+			version: "10.6.12-MariaDB",
+			expected: Capabilities{
+				Version:          "10.6.12-MariaDB",
+				MariaDB:          true,
+				Roles:            true,
+				AccountLocking:   true,
+				RenameUser:       true,
+				PasswordLifetime: true,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				errs: map[string]error{},
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{test.version}},
+					},
+					resourceGroupsSQL: {
+						columns: []string{"COUNT(*)"},
+						values:  [][]driver.Value{{int64(2)}},
+					},
+					eventSchedulerSQL: {
+						columns: []string{"@@GLOBAL.event_scheduler"},
+						values:  [][]driver.Value{{test.scheduler}},
+					},
+				},
+			}
+			if test.resourceGroupsErr != nil {
+				d.errs[resourceGroupsSQL] = test.resourceGroupsErr
+			}
+			db := sql.OpenDB(d)
+			defer db.Close()
+
+			actual, err := probeCapabilities(context.Background(), db)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMySQL_Capabilities_cached(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			serverVersionSQL: {
+				columns: []string{"VERSION()"},
+				values:  [][]driver.Value{{"8.0.32"}},
+			},
+		},
+	}
+	db := newFakeMySQL(t, d)
+
+	countProbes := func() int {
+		probes := 0
+		for _, call := range d.calls() {
+			if strings.HasPrefix(call, "query: "+serverVersionSQL) {
+				probes++
+			}
+		}
+		return probes
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.Capabilities(context.Background()); err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+	}
+	if probes := countProbes(); probes != 1 {
+		t.Fatalf("expected the capabilities to be probed once, got %d", probes)
+	}
+
+	// A new pool after a reconnect is probed again
+	db.db = sql.OpenDB(d)
+	if _, err := db.Capabilities(context.Background()); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if probes := countProbes(); probes != 2 {
+		t.Fatalf("expected the capabilities to be probed again, got %d", probes)
+	}
+}
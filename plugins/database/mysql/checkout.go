@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+var connectionCheckoutMetricKey = []string{"database", mySQLTypeName, "connection_checkout"}
+
+// checkoutConn checks out a connection from db for an operation, emitting
+// the time spent waiting for it. A wait of at least slow_checkout_threshold
+// is logged with the pool's wait counters, since it means the pool was
+// saturated.
+func (m *MySQL) checkoutConn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	start := time.Now()
+	conn, err := db.Conn(ctx)
+	wait := time.Since(start)
+	metrics.MeasureSince(connectionCheckoutMetricKey, start)
+
+	if m.slowCheckoutThreshold > 0 && wait >= m.slowCheckoutThreshold {
+		stats := db.Stats()
+		m.logger.Warn("slow connection checkout, consider raising max_open_connections",
+			"wait", wait,
+			"in_use", stats.InUse,
+			"max_open_connections", stats.MaxOpenConnections,
+			"wait_count", stats.WaitCount,
+			"wait_duration", stats.WaitDuration)
+	}
+	return conn, err
+}
@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+)
+
+func TestMySQL_checkoutConn_slow(t *testing.T) {
+	db := newFakeMySQL(t, &fakeDriver{})
+	db.slowCheckoutThreshold = 10 * time.Millisecond
+
+	var buf bytes.Buffer
+	db.logger = log.New(&log.LoggerOptions{Output: &buf})
+
+	pool := sql.OpenDB(&fakeDriver{})
+	defer pool.Close()
+	pool.SetMaxOpenConns(1)
+
+	// Saturate the pool so the checkout has to wait
+	held, err := pool.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() {
+		held.Close()
+	})
+
+	conn, err := db.checkoutConn(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	conn.Close()
+
+	if !strings.Contains(buf.String(), "slow connection checkout") || !strings.Contains(buf.String(), "wait_count=1") {
+		t.Fatalf("expected a slow checkout warning, got: %s", buf.String())
+	}
+
+	// A free connection is checked out without a warning
+	buf.Reset()
+	conn, err = db.checkoutConn(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	conn.Close()
+	if buf.Len() > 0 {
+		t.Fatalf("expected no warning, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+package mysql
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/certs"
+	"github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/proxy"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	authTypePassword          = "password"
+	authTypeCloudSQLConnector = "cloudsql_connector"
+
+	// cloudSQLNetPrefix prefixes the network name each plugin instance
+	// registers its Cloud SQL dialer under in the mysql driver
+	cloudSQLNetPrefix = "cloudsql-connector-"
+
+	cloudSQLAdminScope = "https://www.googleapis.com/auth/sqlservice.admin"
+
+	// cloudSQLPort is the port Cloud SQL instances accept connector
+	// connections on
+	cloudSQLPort = 3307
+)
+
+var errCloudSQLDialerClosed = errors.New("cloud sql dialer is closed")
+
+// cloudSQLDialer dials Cloud SQL instances given their instance connection
+// name ("project:region:instance"). Each plugin instance owns its dialer and
+// closes it with the connection producer.
+type cloudSQLDialer interface {
+	Dial(ctx context.Context, instance string) (net.Conn, error)
+	Close() error
+}
+
+// newCloudSQLDialer returns the dialer used by auth_type cloudsql_connector.
+// Tests replace it.
+var newCloudSQLDialer = func(ctx context.Context) (cloudSQLDialer, error) {
+	return newCloudSQLProxyDialer(ctx)
+}
+
+// cloudSQLProxyDialer dials through its own Cloud SQL proxy client, which
+// authenticates with the application default credentials. It doesn't use
+// the proxy package's process-wide client, so plugin instances don't share
+// certificates or configuration.
+type cloudSQLProxyDialer struct {
+	client *proxy.Client
+	certs  *closableCertSource
+}
+
+func newCloudSQLProxyDialer(ctx context.Context) (*cloudSQLProxyDialer, error) {
+	httpClient, err := google.DefaultClient(ctx, cloudSQLAdminScope)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &closableCertSource{CertSource: certs.NewCertSource("", httpClient, true)}
+	return &cloudSQLProxyDialer{
+		client: &proxy.Client{
+			Port:  cloudSQLPort,
+			Certs: source,
+		},
+		certs: source,
+	}, nil
+}
+
+// Dial dials instance with the proxy client. The client doesn't take a
+// context, so a dial that completes after ctx is done is closed again.
+func (d *cloudSQLProxyDialer) Dial(ctx context.Context, instance string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := d.client.Dial(instance)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the dialer. Connections it already returned stay open.
+func (d *cloudSQLProxyDialer) Close() error {
+	d.certs.close()
+	return nil
+}
+
+// closableCertSource fails certificate requests once closed. The proxy
+// client refreshes each instance's certificate in the background until a
+// refresh fails, so closing the source ends the refresh of a closed dialer.
+type closableCertSource struct {
+	proxy.CertSource
+	closed uint32
+}
+
+func (s *closableCertSource) close() {
+	atomic.StoreUint32(&s.closed, 1)
+}
+
+func (s *closableCertSource) Local(instance string) (tls.Certificate, error) {
+	if atomic.LoadUint32(&s.closed) == 1 {
+		return tls.Certificate{}, errCloudSQLDialerClosed
+	}
+	return s.CertSource.Local(instance)
+}
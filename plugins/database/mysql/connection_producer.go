@@ -5,8 +5,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,27 +26,548 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
+const (
+	verifyDatabaseSQL = `
+	SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?
+`
+
+	showGrantsSQL = "SHOW GRANTS"
+)
+
+// ErrConnectionAuthFailed is returned when the server rejects the
+// credentials of the connection user.
+var ErrConnectionAuthFailed = errors.New("authentication failed for connection user: rotate or correct the configured username and password")
+
+// ErrConnectionPasswordExpired is returned when the server requires the
+// connection user to reset its expired password before running statements.
+var ErrConnectionPasswordExpired = errors.New("password of the connection user has expired: rotate the root credential or reset the password on the server")
+
+// sessionCharsetNameRe matches character set and collation names. The names
+// are sent unquoted in SET statements, so nothing else may be accepted.
+var sessionCharsetNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// schemaNameRe matches the database names accepted as default_schema. They
+// are rendered into statements as is, so quotes aren't accepted.
+var schemaNameRe = regexp.MustCompile(`^[A-Za-z0-9_$-]{1,64}$`)
+
+// envPlaceholderRe matches the environment variable references of
+// connection_url_template
+var envPlaceholderRe = regexp.MustCompile(`{{env:([A-Za-z_][A-Za-z0-9_]*)}}`)
+
+// redactedPassword replaces the password in diagnostic output
+const redactedPassword = "[redacted]"
+
+// ErrOperationBusy is returned when an operation gives up waiting for
+// another operation to release the connection lock.
+var ErrOperationBusy = errors.New("operation busy")
+
+// maxMaxExecutionTime is the largest max_execution_time the server accepts
+const maxMaxExecutionTime = 4294967295 * time.Millisecond
+
+// namedPipeNet is the network name the named pipe dialer is registered under
+// in the mysql driver
+const namedPipeNet = "np"
+
 // mySQLConnectionProducer implements ConnectionProducer and provides a generic producer for most sql databases
 type mySQLConnectionProducer struct {
 	ConnectionURL            string      `json:"connection_url"          mapstructure:"connection_url"          structs:"connection_url"`
+	ReplicaConnectionURL     string      `json:"replica_connection_url"  mapstructure:"replica_connection_url"  structs:"replica_connection_url"`
 	MaxOpenConnections       int         `json:"max_open_connections"    mapstructure:"max_open_connections"    structs:"max_open_connections"`
 	MaxIdleConnections       int         `json:"max_idle_connections"    mapstructure:"max_idle_connections"    structs:"max_idle_connections"`
 	MaxConnectionLifetimeRaw interface{} `json:"max_connection_lifetime" mapstructure:"max_connection_lifetime" structs:"max_connection_lifetime"`
+	LockTimeoutRaw           interface{} `json:"lock_timeout"            mapstructure:"lock_timeout"            structs:"lock_timeout"`
+
+	// ClusterSeeds are host:port addresses of Group Replication members.
+	// When set, the current primary is discovered through them and used
+	// instead of the host of connection_url, and rediscovered once it
+	// becomes unreachable or read-only.
+	ClusterSeeds []string `json:"cluster_seeds" mapstructure:"cluster_seeds" structs:"cluster_seeds"`
+
+	// StandbyConnectionURL is a warm standby that is health checked every
+	// standby_health_check_interval (10s by default) alongside the primary
+	// and promoted to primary once standby_promotion_failures (3 by
+	// default) consecutive primary health checks failed. The standby stays
+	// active until the plugin is initialized again.
+	StandbyConnectionURL          string      `json:"standby_connection_url"        mapstructure:"standby_connection_url"        structs:"standby_connection_url"`
+	StandbyPromotionFailures      int         `json:"standby_promotion_failures"    mapstructure:"standby_promotion_failures"    structs:"standby_promotion_failures"`
+	StandbyHealthCheckIntervalRaw interface{} `json:"standby_health_check_interval" mapstructure:"standby_health_check_interval" structs:"standby_health_check_interval"`
+
+	// ConnectionURLTemplate takes precedence over connection_url and is
+	// rendered for every new connection, so referenced environment variables
+	// like rotating tokens are re-read. Besides {{username}} and
+	// {{password}} it may reference {{env:NAME}}. The replica connection is
+	// not affected.
+	ConnectionURLTemplate string `json:"connection_url_template" mapstructure:"connection_url_template" structs:"connection_url_template"`
+
+	// ExpiredUserSweepIntervalRaw enables a background sweep that drops
+	// prefixed users whose recorded expiration has passed. Requires
+	// username_prefix and MySQL 8.0.21 or later.
+	ExpiredUserSweepIntervalRaw interface{} `json:"expired_user_sweep_interval" mapstructure:"expired_user_sweep_interval" structs:"expired_user_sweep_interval"`
+
+	// ServerSideTTLEvents makes NewUser create an event in
+	// ServerSideTTLEventSchema that drops the user at its expiration, even
+	// if Vault never revokes it. Renewals reschedule the event and DeleteUser
+	// drops it. Requires the event scheduler to be running and the EVENT
+	// privilege on the schema.
+	ServerSideTTLEvents      bool   `json:"server_side_ttl_events"       mapstructure:"server_side_ttl_events"       structs:"server_side_ttl_events"`
+	ServerSideTTLEventSchema string `json:"server_side_ttl_event_schema" mapstructure:"server_side_ttl_event_schema" structs:"server_side_ttl_event_schema"`
+
+	// UserCountIntervalRaw enables a gauge of the prefixed users on the
+	// server, refreshed at this interval. Requires username_prefix.
+	UserCountIntervalRaw interface{} `json:"user_count_interval" mapstructure:"user_count_interval" structs:"user_count_interval"`
+
+	// PoolValidationIntervalRaw enables a background validator that pings
+	// the idle pooled connections at this interval, so connections that died
+	// while idle are retired before an operation picks them up
+	PoolValidationIntervalRaw interface{} `json:"pool_validation_interval" mapstructure:"pool_validation_interval" structs:"pool_validation_interval"`
+
+	// SlowCheckoutThresholdRaw logs a warning with the pool's wait counters
+	// whenever an operation waits at least this long for a pooled
+	// connection. The wait is always emitted as the connection_checkout
+	// metric. Disabled by default.
+	SlowCheckoutThresholdRaw interface{} `json:"slow_checkout_threshold" mapstructure:"slow_checkout_threshold" structs:"slow_checkout_threshold"`
+
+	// QueryTimeoutRaw bounds each user operation. The creation, revocation
+	// and rotation statement timeouts override it for NewUser, DeleteUser
+	// and UpdateUser respectively. Operations are unbounded by default.
+	QueryTimeoutRaw               interface{} `json:"query_timeout"                mapstructure:"query_timeout"                structs:"query_timeout"`
+	CreationStatementTimeoutRaw   interface{} `json:"creation_statement_timeout"   mapstructure:"creation_statement_timeout"   structs:"creation_statement_timeout"`
+	RevocationStatementTimeoutRaw interface{} `json:"revocation_statement_timeout" mapstructure:"revocation_statement_timeout" structs:"revocation_statement_timeout"`
+	RotationStatementTimeoutRaw   interface{} `json:"rotation_statement_timeout"   mapstructure:"rotation_statement_timeout"   structs:"rotation_statement_timeout"`
+
+	// CreationDelayRaw is how long NewUser waits after creating a user before
+	// returning, giving poolers and replicas time to pick up the account
+	CreationDelayRaw interface{} `json:"creation_delay" mapstructure:"creation_delay" structs:"creation_delay"`
+
+	// UseServerTime renders {{expiration}} and the sweeper's expiration in
+	// the server's clock, so users don't expire early or late when the
+	// clocks of Vault and the server differ. The offset is measured when the
+	// plugin is initialized and again every 10 minutes or after a reconnect.
+	UseServerTime bool `json:"use_server_time" mapstructure:"use_server_time" structs:"use_server_time"`
+
+	// MaxReplicationLagRaw is the replica lag, read from the replica
+	// connection's Seconds_Behind_Source, above which NewUser applies
+	// ReplicationLagAction before creating the user: "warn" (the default)
+	// logs and records the lag in the user's metadata, since the credential
+	// may not work on the replicas yet, "wait" waits for the lag to drop
+	// within the creation statement timeout and "fail" refuses to create
+	// the user. Replicas that don't report a lag, because replication is
+	// stopped or the status isn't readable, are logged and ignored. Zero
+	// disables the check.
+	MaxReplicationLagRaw interface{} `json:"max_replication_lag"    mapstructure:"max_replication_lag"    structs:"max_replication_lag"`
+	ReplicationLagAction string      `json:"replication_lag_action" mapstructure:"replication_lag_action" structs:"replication_lag_action"`
+
+	// VerifyAttempts is the number of consecutive successful pings required
+	// when verifying the connection, waiting VerifyIntervalRaw between pings
+	// and giving up after VerifyTimeoutRaw. A single ping is used by default.
+	VerifyAttempts    int         `json:"verify_attempts" mapstructure:"verify_attempts" structs:"verify_attempts"`
+	VerifyIntervalRaw interface{} `json:"verify_interval" mapstructure:"verify_interval" structs:"verify_interval"`
+	VerifyTimeoutRaw  interface{} `json:"verify_timeout"  mapstructure:"verify_timeout"  structs:"verify_timeout"`
+
+	// AuditLogPath is a file that receives a JSON record for every
+	// NewUser, DeleteUser and UpdateUser call. Secrets are never logged.
+	AuditLogPath string `json:"audit_log_path" mapstructure:"audit_log_path" structs:"audit_log_path"`
+
+	// AuthType selects how connections are established. "password" (the
+	// default) dials the connection URL, "cloudsql_connector" dials
+	// InstanceConnectionName through the Cloud SQL connector.
+	AuthType               string `json:"auth_type"                mapstructure:"auth_type"                structs:"auth_type"`
+	InstanceConnectionName string `json:"instance_connection_name" mapstructure:"instance_connection_name" structs:"instance_connection_name"`
+
+	// Pipe is the name of a Windows named pipe to connect through instead of
+	// the address in the connection URL
+	Pipe string `json:"pipe" mapstructure:"pipe" structs:"pipe"`
+
+	// SendProxyProtocol sends a PROXY protocol header of
+	// ProxyProtocolVersion ("v1" or "v2", the default) before the MySQL
+	// handshake, for load balancers that require it. The header announces
+	// the plugin's own address, so the server checks @'host' grants
+	// against it rather than the load balancer's.
+	SendProxyProtocol    bool   `json:"send_proxy_protocol"    mapstructure:"send_proxy_protocol"    structs:"send_proxy_protocol"`
+	ProxyProtocolVersion string `json:"proxy_protocol_version" mapstructure:"proxy_protocol_version" structs:"proxy_protocol_version"`
+
+	// SSHTunnel routes connections through the SSH bastion at SSHHost
+	// (port 22 by default), authenticating as SSHUsername with the PEM
+	// encoded SSHPrivateKey. The bastion must present SSHHostKey, given in
+	// authorized_keys format. The address in connection_url is dialed from
+	// the bastion.
+	SSHTunnel     bool   `json:"ssh_tunnel"      mapstructure:"ssh_tunnel"      structs:"ssh_tunnel"`
+	SSHHost       string `json:"ssh_host"        mapstructure:"ssh_host"        structs:"ssh_host"`
+	SSHUsername   string `json:"ssh_username"    mapstructure:"ssh_username"    structs:"ssh_username"`
+	SSHPrivateKey string `json:"ssh_private_key" mapstructure:"ssh_private_key" structs:"-"`
+	SSHHostKey    string `json:"ssh_host_key"    mapstructure:"ssh_host_key"    structs:"ssh_host_key"`
+
+	// AnnotateStatements prepends a comment like
+	// "/* vault:role=app req=<id> */" to every statement run for NewUser,
+	// UpdateUser and DeleteUser, so the server's audit and general logs can
+	// be correlated with the plugin's logs
+	AnnotateStatements bool `json:"annotate_statements" mapstructure:"annotate_statements" structs:"annotate_statements"`
+
+	// CollationConnection and CharacterSetResults set the session variables
+	// of the same name on every connection, so statements compare and
+	// return strings consistently regardless of the server defaults
+	CollationConnection string `json:"collation_connection"  mapstructure:"collation_connection"  structs:"collation_connection"`
+	CharacterSetResults string `json:"character_set_results" mapstructure:"character_set_results" structs:"character_set_results"`
+
+	// MaxExecutionTimeRaw sets the max_execution_time session variable on
+	// every connection, so the server aborts statements that run longer even
+	// if the client's cancellation never reaches it. It has millisecond
+	// precision and applies to read-only SELECT statements, the only ones
+	// MySQL 5.7.8 and later enforce it for. Disabled by default.
+	MaxExecutionTimeRaw interface{} `json:"max_execution_time" mapstructure:"max_execution_time" structs:"max_execution_time"`
 
 	Username string `json:"username" mapstructure:"username" structs:"username"`
 	Password string `json:"password" mapstructure:"password" structs:"password"`
 
+	// PasswordFile is read for the connection password whenever a new
+	// connection is opened, instead of storing the password in the config
+	PasswordFile string `json:"password_file" mapstructure:"password_file" structs:"password_file"`
+
+	// VerificationDatabases are checked for access by the connection user
+	// when the connection is verified
+	VerificationDatabases []string `json:"verification_databases" mapstructure:"verification_databases" structs:"verification_databases"`
+
+	// VerifyConnectionPrivileges checks the connection user's grants for the
+	// privileges the configured operations need when the connection is
+	// verified, so a missing grant is reported before NewUser fails
+	VerifyConnectionPrivileges bool `json:"verify_connection_privileges" mapstructure:"verify_connection_privileges" structs:"verify_connection_privileges"`
+
+	// ExecutionMode is "transaction" (the default) to run each operation's
+	// statements in a single transaction, or "autocommit" to run and commit
+	// them one at a time for servers and proxies that mishandle transactions
+	ExecutionMode string `json:"execution_mode" mapstructure:"execution_mode" structs:"execution_mode"`
+
+	// DisableAutocommit runs the statements of an operation on a session
+	// with autocommit disabled, for provisioning procedures that expect it.
+	// The plugin still commits explicitly, and autocommit is enabled again
+	// before the session returns to the pool. RoleDisableAutocommit
+	// overrides it per role.
+	DisableAutocommit     bool            `json:"disable_autocommit"      mapstructure:"disable_autocommit"      structs:"disable_autocommit"`
+	RoleDisableAutocommit map[string]bool `json:"role_disable_autocommit" mapstructure:"role_disable_autocommit" structs:"role_disable_autocommit"`
+
+	// ParallelStatements runs consecutive GRANT statements concurrently, each
+	// on its own connection, to speed up roles granting on many schemas.
+	// Other statements still run alone and in order. It requires the
+	// autocommit execution_mode, since the statements can't share a
+	// transaction: a failed GRANT leaves the others applied.
+	ParallelStatements bool `json:"parallel_statements" mapstructure:"parallel_statements" structs:"parallel_statements"`
+
+	// PastExpiration is "reject" (the default) to fail NewUser when the
+	// requested expiration has already passed, or "clamp" to create the user
+	// with a one minute TTL instead
+	PastExpiration string `json:"past_expiration" mapstructure:"past_expiration" structs:"past_expiration"`
+
+	// RevocationMode is "drop" (the default) to run the revocation
+	// statements, or "noop" to run nothing on DeleteUser for users whose
+	// lifecycle is managed outside of Vault
+	RevocationMode string `json:"revocation_mode" mapstructure:"revocation_mode" structs:"revocation_mode"`
+
+	// RotationSyntax selects the default password rotation statement:
+	// "alter_user" or "set_password" for servers older than MySQL 5.7.6.
+	// When unset it is chosen from the server version.
+	RotationSyntax string `json:"rotation_syntax" mapstructure:"rotation_syntax" structs:"rotation_syntax"`
+
+	// CaptureCreationResults runs the final creation statement as a query
+	// and records the first row of each of its result sets in the user's
+	// metadata, e.g. for provisioning procedures that return generated names
+	CaptureCreationResults bool `json:"capture_creation_results" mapstructure:"capture_creation_results" structs:"capture_creation_results"`
+
+	// RecordGrants records the GRANT statements among the rendered creation
+	// statements in the user's metadata, so revocation statements can revoke
+	// exactly what was granted. A revocation statement that is only
+	// {{revoke_grants}} expands to one REVOKE per recorded grant, and
+	// {{grants}} renders the recorded summary. The metadata is kept in
+	// memory, so for users created before the plugin was last initialized
+	// {{revoke_grants}} revokes all privileges instead.
+	RecordGrants bool `json:"record_grants" mapstructure:"record_grants" structs:"record_grants"`
+
+	// AllowEmptyPassword lets NewUser create users without a password, for
+	// users that authenticate through a socket or PAM plugin
+	AllowEmptyPassword bool `json:"allow_empty_password" mapstructure:"allow_empty_password" structs:"allow_empty_password"`
+
+	// PasswordAllowedCharacters rejects passwords containing any character
+	// not in the set, for auth plugins and clients that mishandle some
+	// characters. Passwords are rejected rather than modified, so Vault
+	// generates a new one. Every character is allowed when empty.
+	PasswordAllowedCharacters string `json:"password_allowed_characters" mapstructure:"password_allowed_characters" structs:"password_allowed_characters"`
+
+	// AllowedStatementVerbs restricts the statements run for users to those
+	// starting with one of the listed verbs, like "CREATE USER" or "GRANT".
+	// Every statement is allowed when empty.
+	AllowedStatementVerbs []string `json:"allowed_statement_verbs" mapstructure:"allowed_statement_verbs" structs:"allowed_statement_verbs"`
+
+	// SchemaAllowList restricts the GRANT statements run for users to the
+	// listed schemas, so a misconfigured role can't grant on shared ones.
+	// An entry ending in * allows every schema with that prefix, e.g.
+	// "tenant_a_*", and "*" also allows global grants. Role grants aren't
+	// restricted. Every grant is allowed when empty.
+	SchemaAllowList []string `json:"schema_allow_list" mapstructure:"schema_allow_list" structs:"schema_allow_list"`
+
+	// StrictLeastPrivilege rejects creation statements with overly broad
+	// grants instead of only logging a warning
+	StrictLeastPrivilege bool `json:"strict_least_privilege" mapstructure:"strict_least_privilege" structs:"strict_least_privilege"`
+
+	// RequireTLS is rendered as the REQUIRE clause of CREATE USER into
+	// {{require_tls}}: "none", "ssl", "x509" or "subject=<name>".
+	// RoleRequireTLS overrides it per role.
+	RequireTLS     string            `json:"require_tls"      mapstructure:"require_tls"      structs:"require_tls"`
+	RoleRequireTLS map[string]string `json:"role_require_tls" mapstructure:"role_require_tls" structs:"role_require_tls"`
+
+	// UserHost is the host part of dynamic user accounts, rendered into
+	// {{host}} and used by the plugin's built-in statements. It defaults to
+	// "%" and can be narrowed to a network, like "10.0.%" or
+	// "10.0.0.0/255.255.0.0". RoleUserHost overrides it per role.
+	UserHost     string            `json:"user_host"      mapstructure:"user_host"      structs:"user_host"`
+	RoleUserHost map[string]string `json:"role_user_host" mapstructure:"role_user_host" structs:"role_user_host"`
+
+	// DefaultSchema is the database applications should use with the
+	// dynamic users. MySQL has no per-user default database, so it is only
+	// rendered into {{default_schema}} and recorded in the user's metadata:
+	// applications must still select it on connect, unless a creation
+	// statement configures it on a proxy that supports per-user defaults.
+	// RoleDefaultSchema overrides it per role.
+	DefaultSchema     string            `json:"default_schema"      mapstructure:"default_schema"      structs:"default_schema"`
+	RoleDefaultSchema map[string]string `json:"role_default_schema" mapstructure:"role_default_schema" structs:"role_default_schema"`
+
+	// PostCreationStatements run after the role's creation statements, once
+	// the user and its grants exist, e.g. to create and populate the user's
+	// schema. They are rendered with the same values as the creation
+	// statements. RolePostCreationStatements overrides them per role. They
+	// run in the creation transaction unless SplitPostCreation is set, in
+	// which case they run in a transaction of their own and a failure leaves
+	// the created user behind.
+	PostCreationStatements     []string            `json:"post_creation_statements"      mapstructure:"post_creation_statements"      structs:"post_creation_statements"`
+	RolePostCreationStatements map[string][]string `json:"role_post_creation_statements" mapstructure:"role_post_creation_statements" structs:"role_post_creation_statements"`
+	SplitPostCreation          bool                `json:"split_post_creation"           mapstructure:"split_post_creation"           structs:"split_post_creation"`
+
+	// PasswordLifetimeDays is rendered into {{password_lifetime}} as
+	// PASSWORD EXPIRE INTERVAL n DAY, so the server requires a password
+	// change after that many days regardless of the lease. Zero renders an
+	// empty clause. RolePasswordLifetimeDays overrides it per role.
+	PasswordLifetimeDays     int            `json:"password_lifetime_days"      mapstructure:"password_lifetime_days"      structs:"password_lifetime_days"`
+	RolePasswordLifetimeDays map[string]int `json:"role_password_lifetime_days" mapstructure:"role_password_lifetime_days" structs:"role_password_lifetime_days"`
+
+	// CreateLocked creates users with a locked account, to be unlocked with
+	// UnlockUser once downstream setup completes. RoleCreateLocked
+	// overrides it per role.
+	CreateLocked     bool            `json:"create_locked"      mapstructure:"create_locked"      structs:"create_locked"`
+	RoleCreateLocked map[string]bool `json:"role_create_locked" mapstructure:"role_create_locked" structs:"role_create_locked"`
+
+	// RoleExternalAuth marks roles whose users authenticate through an
+	// external plugin such as auth_pam or authentication_ldap_simple,
+	// mapping the role name to the authentication string rendered into
+	// {{auth_string}}, e.g. IDENTIFIED WITH auth_pam AS '{{auth_string}}'.
+	// The generated password is not rendered for these roles, so Vault only
+	// tracks the username and the credential lives with the external
+	// service.
+	RoleExternalAuth map[string]string `json:"role_external_auth" mapstructure:"role_external_auth" structs:"role_external_auth"`
+
+	// RoleUsernameStyles overrides the plugin's username layout per role,
+	// mapping a role name to "legacy" or "modern"
+	RoleUsernameStyles map[string]string `json:"role_username_styles" mapstructure:"role_username_styles" structs:"role_username_styles"`
+
+	// UsernamePrefix and UsernameSuffix are added to every generated username
+	// and are never truncated
+	UsernamePrefix string `json:"username_prefix" mapstructure:"username_prefix" structs:"username_prefix"`
+	UsernameSuffix string `json:"username_suffix" mapstructure:"username_suffix" structs:"username_suffix"`
+
+	// UsernameRandomLength reserves this many random characters in generated
+	// usernames, shortening the display and role names to make room
+	UsernameRandomLength int `json:"username_random_length" mapstructure:"username_random_length" structs:"username_random_length"`
+
+	// ReservedUsernames are never used for generated usernames, nor is the
+	// connection username. A generated username matching one, ignoring
+	// case, is regenerated and NewUser fails if it keeps matching. Defaults
+	// to the MySQL and MariaDB system accounts.
+	ReservedUsernames []string `json:"reserved_usernames" mapstructure:"reserved_usernames" structs:"reserved_usernames"`
+
+	// RotateOnInit rotates the connection user's password to a random value
+	// right after the connection has been verified
+	RotateOnInit bool `json:"rotate_on_init" mapstructure:"rotate_on_init" structs:"rotate_on_init"`
+
+	// PasswordChangeDisconnect kills a user's existing sessions after its
+	// password has been changed
+	PasswordChangeDisconnect bool `json:"password_change_disconnect" mapstructure:"password_change_disconnect" structs:"password_change_disconnect"`
+
+	// SuppressQueryLog sets sql_log_off on the session that changes a
+	// password, so the statement carrying it stays out of the general query
+	// log. The server can't bind the password of ALTER USER or SET PASSWORD
+	// as a parameter, and the slow query log isn't affected. Without SUPER
+	// or SYSTEM_VARIABLES_ADMIN the password is changed with a warning.
+	SuppressQueryLog bool `json:"suppress_query_log" mapstructure:"suppress_query_log" structs:"suppress_query_log"`
+
+	// AllowExpirePassword enables ExpirePassword, which locks a user out
+	// until its password is reset
+	AllowExpirePassword bool `json:"allow_expire_password" mapstructure:"allow_expire_password" structs:"allow_expire_password"`
+
+	// AllowDropAllManagedUsers enables DropAllManagedUsers, which revokes
+	// every user matching username_prefix
+	AllowDropAllManagedUsers bool `json:"allow_drop_all_managed_users" mapstructure:"allow_drop_all_managed_users" structs:"allow_drop_all_managed_users"`
+
+	// CreationSessionLabel and RevocationSessionLabel are stored in the
+	// @vault_action session variable while NewUser and DeleteUser run their
+	// statements, so server side audits can tell the two apart
+	CreationSessionLabel   string `json:"creation_session_label"   mapstructure:"creation_session_label"   structs:"creation_session_label"`
+	RevocationSessionLabel string `json:"revocation_session_label" mapstructure:"revocation_session_label" structs:"revocation_session_label"`
+
+	// RevocationRevokePrivileges and RevocationKillConnections add steps
+	// that DeleteUser runs, in this order, before the revocation statements
+	// drop the user
+	RevocationRevokePrivileges bool `json:"revocation_revoke_privileges" mapstructure:"revocation_revoke_privileges" structs:"revocation_revoke_privileges"`
+	RevocationKillConnections  bool `json:"revocation_kill_connections"  mapstructure:"revocation_kill_connections"  structs:"revocation_kill_connections"`
+
+	// DynamicRevocation makes the privilege revocation step read the user's
+	// grants with SHOW GRANTS and revoke each of them, including role and
+	// proxy grants REVOKE ALL leaves in place, instead of running a blanket
+	// REVOKE ALL. It enables the step without revocation_revoke_privileges.
+	// Grant lines it doesn't recognize fall back to REVOKE ALL.
+	DynamicRevocation bool `json:"dynamic_revocation" mapstructure:"dynamic_revocation" structs:"dynamic_revocation"`
+
+	// BackoffJitter randomizes the delays between retries, such as the pings
+	// of verify_attempts, so reconnects after an outage are spread out:
+	// "equal" (the default) waits half the delay plus up to the other half,
+	// "full" waits up to the whole delay and "none" waits the fixed delay
+	BackoffJitter string `json:"backoff_jitter" mapstructure:"backoff_jitter" structs:"backoff_jitter"`
+
+	// RetryBudgetPerMinute caps the retries of all operations combined,
+	// such as fallback revocations and username regenerations. Once used
+	// up, operations fail fast instead of retrying. Unlimited when zero.
+	RetryBudgetPerMinute int `json:"retry_budget_per_minute" mapstructure:"retry_budget_per_minute" structs:"retry_budget_per_minute"`
+
+	// CheckUsernameUniqueness makes NewUser look the generated username up
+	// in mysql.user and regenerate it if it's taken, up to
+	// UsernameUniquenessAttempts times (3 by default)
+	CheckUsernameUniqueness    bool `json:"check_username_uniqueness"    mapstructure:"check_username_uniqueness"    structs:"check_username_uniqueness"`
+	UsernameUniquenessAttempts int  `json:"username_uniqueness_attempts" mapstructure:"username_uniqueness_attempts" structs:"username_uniqueness_attempts"`
+
+	// DropUserRole makes DeleteUser drop the roles the creation statements
+	// created for the user, i.e. the CREATE ROLE statements creating a role
+	// whose name contains the username. Dropping the user leaves them
+	// behind otherwise. Only users created since the plugin was last
+	// initialized have their roles recorded.
+	DropUserRole bool `json:"drop_user_role" mapstructure:"drop_user_role" structs:"drop_user_role"`
+
+	// VerifyRevocation makes DeleteUser fail if the user still exists in
+	// mysql.user after the revocation statements ran
+	VerifyRevocation bool `json:"verify_revocation" mapstructure:"verify_revocation" structs:"verify_revocation"`
+
+	// VerifyAmbiguousCommit makes NewUser check mysql.user when the commit of
+	// the creation transaction fails because the connection was lost. The
+	// server may have applied the commit anyway, and an existing user is then
+	// treated as created instead of failing, which would make Vault retry
+	// under a new username and leak the first one. The check needs SELECT on
+	// mysql.user, and only proves the user exists: since account management
+	// statements commit implicitly, statements after the last of them may
+	// have been lost. If the check fails or finds no user, the commit error
+	// is returned as before.
+	VerifyAmbiguousCommit bool `json:"verify_ambiguous_commit" mapstructure:"verify_ambiguous_commit" structs:"verify_ambiguous_commit"`
+
+	// FallbackRevocationStatements are run by DeleteUser when the revocation
+	// statements fail with one of FallbackRevocationErrorCodes
+	FallbackRevocationStatements []string `json:"fallback_revocation_statements"  mapstructure:"fallback_revocation_statements"  structs:"fallback_revocation_statements"`
+	FallbackRevocationErrorCodes []int    `json:"fallback_revocation_error_codes" mapstructure:"fallback_revocation_error_codes" structs:"fallback_revocation_error_codes"`
+
+	// AllowCleartextPasswords enables the mysql_clear_password client plugin
+	// used by PAM/LDAP backed accounts. It requires TLS.
+	AllowCleartextPasswords bool `json:"allow_cleartext_passwords" mapstructure:"allow_cleartext_passwords" structs:"allow_cleartext_passwords"`
+
+	// InterpolateParams has the driver interpolate query arguments client
+	// side instead of preparing statements on the server, saving round
+	// trips. Statements are executed without preparing them. The values
+	// rendered into statements are generated by Vault or come from the role
+	// and connection config, not from end users, so interpolation doesn't
+	// open a new injection path.
+	InterpolateParams bool `json:"interpolate_params" mapstructure:"interpolate_params" structs:"interpolate_params"`
+
+	// TolerateDuplicateGrants treats GRANT statements failing because the
+	// grant already exists as successful, so a role's grants can be
+	// applied again
+	TolerateDuplicateGrants bool `json:"tolerate_duplicate_grants" mapstructure:"tolerate_duplicate_grants" structs:"tolerate_duplicate_grants"`
+
+	// CollectWarnings runs SHOW WARNINGS after every statement and logs the
+	// warnings the server raised for statements that otherwise succeeded
+	CollectWarnings bool `json:"collect_warnings" mapstructure:"collect_warnings" structs:"collect_warnings"`
+
+	// AllowNativePasswords and AllowOldPasswords override the driver's
+	// authentication defaults for legacy servers. The driver allows
+	// mysql_native_password and refuses the pre-4.1 hashing, which is broken
+	// and should only be enabled when a server cannot be upgraded. Native
+	// passwords are only changed when explicitly set.
+	AllowNativePasswords *bool `json:"allow_native_passwords" mapstructure:"allow_native_passwords" structs:"allow_native_passwords"`
+	AllowOldPasswords    bool  `json:"allow_old_passwords"    mapstructure:"allow_old_passwords"    structs:"allow_old_passwords"`
+
+	// RequireDatabase keeps the default database of connection_url in the
+	// DSN, which is the default. Set to false, connections are made at the
+	// server level, so a dropped database doesn't block managing server
+	// level users.
+	RequireDatabase *bool `json:"require_database" mapstructure:"require_database" structs:"require_database"`
+
 	TLSCertificateKeyData []byte `json:"tls_certificate_key" mapstructure:"tls_certificate_key" structs:"-"`
 	TLSCAData             []byte `json:"tls_ca"              mapstructure:"tls_ca"              structs:"-"`
 
+	// TLSSkipHostnameVerify verifies the server certificate chain against
+	// tls_ca but skips matching the certificate against the dialed hostname
+	TLSSkipHostnameVerify bool `json:"tls_insecure_skip_hostname_verify" mapstructure:"tls_insecure_skip_hostname_verify" structs:"tls_insecure_skip_hostname_verify"`
+
 	// tlsConfigName is a globally unique name that references the TLS config for this instance in the mysql driver
 	tlsConfigName string
 
+	// security is the connection security recorded by Init
+	security ConnectionSecurity
+
+	// sshTunnel is the SSH connection to the bastion when ssh_tunnel is set.
+	// It is registered with the driver under sshNetName.
+	sshTunnel  *sshTunnel
+	sshNetName string
+
+	// cloudSQLDialer dials the instance when auth_type is
+	// cloudsql_connector. It is registered with the driver under
+	// cloudSQLNetName.
+	cloudSQLDialer  cloudSQLDialer
+	cloudSQLNetName string
+
 	RawConfig             map[string]interface{}
 	maxConnectionLifetime time.Duration
-	Legacy                bool
-	Initialized           bool
-	db                    *sql.DB
+	lockTimeout           time.Duration
+	creationDelay         time.Duration
+	// maxReplicationLag is zero when the lag isn't checked
+	maxReplicationLag time.Duration
+	// The statement timeouts are zero when the operations are unbounded
+	creationStatementTimeout   time.Duration
+	revocationStatementTimeout time.Duration
+	rotationStatementTimeout   time.Duration
+	verifyInterval             time.Duration
+	verifyTimeout              time.Duration
+	Legacy                     bool
+	Initialized                bool
+	db                         *sql.DB
+	// expiredUserSweepInterval is zero when the sweep is disabled
+	expiredUserSweepInterval time.Duration
+	// userCountInterval is zero when the user count gauge is disabled
+	userCountInterval time.Duration
+	// poolValidationInterval is zero when the pool validator is disabled
+	poolValidationInterval time.Duration
+	// maxExecutionTime is zero when max_execution_time isn't set
+	maxExecutionTime time.Duration
+	// slowCheckoutThreshold is zero when slow checkouts aren't logged
+	slowCheckoutThreshold time.Duration
+	// standbyHealthCheckInterval is how often the primary and standby are
+	// health checked when a standby_connection_url is configured
+	standbyHealthCheckInterval time.Duration
+
+	// credentials supplies the password for each new connection. The
+	// password of the connection URL is used when nil.
+	credentials credentialProvider
+
+	// replicaDB is the read-only pool used for verification when a
+	// replica_connection_url is configured
+	replicaDB *sql.DB
+
+	// standbyDB is the warm standby pool, which becomes db once promoted.
+	// primaryFailures counts the consecutive failed primary health checks.
+	standbyDB       *sql.DB
+	standbyPromoted bool
+	primaryFailures int
 	sync.Mutex
 }
 
@@ -59,6 +587,13 @@ func (c *mySQLConnectionProducer) Init(ctx context.Context, conf map[string]inte
 		return nil, err
 	}
 
+	if c.ConnectionURLTemplate != "" {
+		c.ConnectionURL, err = c.renderConnectionURLTemplate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(c.ConnectionURL) == 0 {
 		return nil, fmt.Errorf("connection_url cannot be empty")
 	}
@@ -68,10 +603,22 @@ func (c *mySQLConnectionProducer) Init(ctx context.Context, conf map[string]inte
 
 	// QueryHelper doesn't do any SQL escaping, but if it starts to do so
 	// then maybe we won't be able to use it to do URL substitution any more.
-	c.ConnectionURL = dbutil.QueryHelper(c.ConnectionURL, map[string]string{
+	urlMap := map[string]string{
 		"username": url.PathEscape(c.Username),
 		"password": password,
-	})
+	}
+	c.ConnectionURL = dbutil.QueryHelper(c.ConnectionURL, urlMap)
+	c.ReplicaConnectionURL = dbutil.QueryHelper(c.ReplicaConnectionURL, urlMap)
+	c.StandbyConnectionURL = dbutil.QueryHelper(c.StandbyConnectionURL, urlMap)
+
+	// A standby promoted before re-initializing is replaced by the
+	// configured primary
+	if c.standbyPromoted && c.db != nil {
+		c.db.Close()
+		c.db = nil
+	}
+	c.standbyPromoted = false
+	c.primaryFailures = 0
 
 	if c.MaxOpenConnections == 0 {
 		c.MaxOpenConnections = 4
@@ -87,11 +634,215 @@ func (c *mySQLConnectionProducer) Init(ctx context.Context, conf map[string]inte
 		c.MaxConnectionLifetimeRaw = "0s"
 	}
 
+	for i, verb := range c.AllowedStatementVerbs {
+		c.AllowedStatementVerbs[i] = normalizeStatement(verb)
+	}
+
+	if len(c.FallbackRevocationErrorCodes) == 0 {
+		c.FallbackRevocationErrorCodes = defaultFallbackRevocationErrorCodes
+	}
+
 	c.maxConnectionLifetime, err = parseutil.ParseDurationSecond(c.MaxConnectionLifetimeRaw)
 	if err != nil {
 		return nil, errwrap.Wrapf("invalid max_connection_lifetime: {{err}}", err)
 	}
 
+	if c.LockTimeoutRaw == nil {
+		c.LockTimeoutRaw = "0s"
+	}
+
+	c.lockTimeout, err = parseutil.ParseDurationSecond(c.LockTimeoutRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid lock_timeout: {{err}}", err)
+	}
+
+	if c.ExpiredUserSweepIntervalRaw == nil {
+		c.ExpiredUserSweepIntervalRaw = "0s"
+	}
+
+	c.expiredUserSweepInterval, err = parseutil.ParseDurationSecond(c.ExpiredUserSweepIntervalRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid expired_user_sweep_interval: {{err}}", err)
+	}
+
+	if c.UserCountIntervalRaw == nil {
+		c.UserCountIntervalRaw = "0s"
+	}
+
+	c.userCountInterval, err = parseutil.ParseDurationSecond(c.UserCountIntervalRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid user_count_interval: {{err}}", err)
+	}
+
+	if c.PoolValidationIntervalRaw == nil {
+		c.PoolValidationIntervalRaw = "0s"
+	}
+
+	c.poolValidationInterval, err = parseutil.ParseDurationSecond(c.PoolValidationIntervalRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid pool_validation_interval: {{err}}", err)
+	}
+
+	if c.StandbyPromotionFailures == 0 {
+		c.StandbyPromotionFailures = 3
+	}
+
+	if c.StandbyHealthCheckIntervalRaw == nil {
+		c.StandbyHealthCheckIntervalRaw = "10s"
+	}
+
+	c.standbyHealthCheckInterval, err = parseutil.ParseDurationSecond(c.StandbyHealthCheckIntervalRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid standby_health_check_interval: {{err}}", err)
+	}
+
+	if c.SlowCheckoutThresholdRaw == nil {
+		c.SlowCheckoutThresholdRaw = "0s"
+	}
+
+	c.slowCheckoutThreshold, err = parseutil.ParseDurationSecond(c.SlowCheckoutThresholdRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid slow_checkout_threshold: {{err}}", err)
+	}
+
+	if c.MaxExecutionTimeRaw == nil {
+		c.MaxExecutionTimeRaw = "0s"
+	}
+
+	c.maxExecutionTime, err = parseutil.ParseDurationSecond(c.MaxExecutionTimeRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid max_execution_time: {{err}}", err)
+	}
+
+	if c.QueryTimeoutRaw == nil {
+		c.QueryTimeoutRaw = "0s"
+	}
+
+	queryTimeout, err := parseutil.ParseDurationSecond(c.QueryTimeoutRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid query_timeout: {{err}}", err)
+	}
+
+	c.creationStatementTimeout, err = parseStatementTimeout(c.CreationStatementTimeoutRaw, queryTimeout)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid creation_statement_timeout: {{err}}", err)
+	}
+	c.revocationStatementTimeout, err = parseStatementTimeout(c.RevocationStatementTimeoutRaw, queryTimeout)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid revocation_statement_timeout: {{err}}", err)
+	}
+	c.rotationStatementTimeout, err = parseStatementTimeout(c.RotationStatementTimeoutRaw, queryTimeout)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid rotation_statement_timeout: {{err}}", err)
+	}
+
+	if c.CreationDelayRaw == nil {
+		c.CreationDelayRaw = "0s"
+	}
+
+	c.creationDelay, err = parseutil.ParseDurationSecond(c.CreationDelayRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid creation_delay: {{err}}", err)
+	}
+
+	if c.MaxReplicationLagRaw == nil {
+		c.MaxReplicationLagRaw = "0s"
+	}
+
+	c.maxReplicationLag, err = parseutil.ParseDurationSecond(c.MaxReplicationLagRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid max_replication_lag: {{err}}", err)
+	}
+
+	if c.VerifyAttempts == 0 {
+		c.VerifyAttempts = 1
+	}
+
+	if c.ProxyProtocolVersion == "" {
+		c.ProxyProtocolVersion = proxyProtocolV2
+	}
+
+	if c.UserHost == "" {
+		c.UserHost = "%"
+	}
+
+	if c.UsernameUniquenessAttempts == 0 {
+		c.UsernameUniquenessAttempts = 3
+	}
+
+	if len(c.ReservedUsernames) == 0 {
+		c.ReservedUsernames = defaultReservedUsernames
+	}
+
+	if c.VerifyIntervalRaw == nil {
+		c.VerifyIntervalRaw = "1s"
+	}
+
+	c.verifyInterval, err = parseutil.ParseDurationSecond(c.VerifyIntervalRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid verify_interval: {{err}}", err)
+	}
+
+	if c.VerifyTimeoutRaw == nil {
+		c.VerifyTimeoutRaw = "30s"
+	}
+
+	c.verifyTimeout, err = parseutil.ParseDurationSecond(c.VerifyTimeoutRaw)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid verify_timeout: {{err}}", err)
+	}
+
+	if err := c.validateConfig(); err != nil {
+		return nil, err
+	}
+
+	c.credentials = nil
+	if c.PasswordFile != "" {
+		provider := filePasswordProvider(c.PasswordFile)
+		if _, err := provider.Password(ctx); err != nil {
+			return nil, err
+		}
+		c.credentials = provider
+	}
+
+	if c.sshTunnel != nil {
+		c.sshTunnel.Close()
+		c.sshTunnel = nil
+	}
+	if c.SSHTunnel {
+		c.sshTunnel, err = newSSHTunnel(c.SSHHost, c.SSHUsername, c.SSHPrivateKey, c.SSHHostKey)
+		if err != nil {
+			return nil, err
+		}
+		if c.sshNetName == "" {
+			id, err := uuid.GenerateUUID()
+			if err != nil {
+				return nil, fmt.Errorf("unable to generate UUID for the SSH tunnel: %w", err)
+			}
+			c.sshNetName = "ssh-tunnel-" + id
+		}
+		mysql.RegisterDialContext(c.sshNetName, c.sshTunnel.dialContext)
+	}
+
+	if c.cloudSQLDialer != nil {
+		c.cloudSQLDialer.Close()
+		c.cloudSQLDialer = nil
+	}
+	if c.AuthType == authTypeCloudSQLConnector {
+		c.cloudSQLDialer, err = newCloudSQLDialer(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the Cloud SQL dialer: %w", err)
+		}
+		if c.cloudSQLNetName == "" {
+			id, err := uuid.GenerateUUID()
+			if err != nil {
+				return nil, fmt.Errorf("unable to generate UUID for the Cloud SQL dialer: %w", err)
+			}
+			c.cloudSQLNetName = cloudSQLNetPrefix + id
+		}
+		mysql.RegisterDialContext(c.cloudSQLNetName, c.cloudSQLDialer.Dial)
+	}
+
 	tlsConfig, err := c.getTLSAuth()
 	if err != nil {
 		return nil, err
@@ -108,6 +859,11 @@ func (c *mySQLConnectionProducer) Init(ctx context.Context, conf map[string]inte
 		mysql.RegisterTLSConfig(c.tlsConfigName, tlsConfig)
 	}
 
+	c.security, err = c.connectionSecurity()
+	if err != nil {
+		return nil, err
+	}
+
 	// Set initialized to true at this point since all fields are set,
 	// and the connection can be established at a later time.
 	c.Initialized = true
@@ -117,69 +873,946 @@ func (c *mySQLConnectionProducer) Init(ctx context.Context, conf map[string]inte
 			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
 		}
 
-		if err := c.db.PingContext(ctx); err != nil {
+		if err := c.pingHealthy(ctx, c.db); err != nil {
 			return nil, errwrap.Wrapf("error verifying connection: {{err}}", err)
 		}
+
+		if c.ReplicaConnectionURL != "" {
+			if _, err := c.ReadConnection(ctx); err != nil {
+				return nil, errwrap.Wrapf("error verifying replica connection: {{err}}", err)
+			}
+
+			if err := c.pingHealthy(ctx, c.replicaDB); err != nil {
+				return nil, errwrap.Wrapf("error verifying replica connection: {{err}}", err)
+			}
+		}
+
+		if err := c.verifyDatabases(ctx); err != nil {
+			return nil, err
+		}
+
+		if err := c.verifyPrivileges(ctx, c.db); err != nil {
+			return nil, err
+		}
 	}
 
 	return c.RawConfig, nil
 }
 
-func (c *mySQLConnectionProducer) Connection(ctx context.Context) (interface{}, error) {
-	if !c.Initialized {
-		return nil, connutil.ErrNotInitialized
+// parseStatementTimeout parses an operation's statement timeout, which
+// defaults to the query_timeout when unset.
+func parseStatementTimeout(raw interface{}, queryTimeout time.Duration) (time.Duration, error) {
+	if raw == nil {
+		return queryTimeout, nil
 	}
+	return parseutil.ParseDurationSecond(raw)
+}
 
-	// If we already have a DB, test it and return
-	if c.db != nil {
-		if err := c.db.PingContext(ctx); err == nil {
-			return c.db, nil
-		}
-		// If the ping was unsuccessful, close it and ignore errors as we'll be
-		// reestablishing anyways
-		c.db.Close()
+// withStatementTimeout bounds ctx by timeout, leaving it unbounded when
+// timeout is zero.
+func withStatementTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	connURL, err := c.addTLStoDSN()
-	if err != nil {
-		return nil, err
+// connectionError translates server errors about the connection user into
+// actionable errors. The original error is dropped since the translated one
+// carries all the information the operator needs.
+func connectionError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
 	}
 
-	c.db, err = sql.Open("mysql", connURL)
-	if err != nil {
-		return nil, err
+	switch mysqlErr.Number {
+	case 1045: // Access denied for user
+		return ErrConnectionAuthFailed
+	case 1820, // You must reset your password before executing this statement
+		1862: // Your password has expired, refused by disconnect_on_expired_password
+		return ErrConnectionPasswordExpired
+	case 1049: // Unknown database
+		return fmt.Errorf("the default database of connection_url does not exist, set require_database to false to connect without one: %w", err)
+	default:
+		return err
 	}
+}
 
-	// Set some connection pool settings. We don't need much of this,
-	// since the request rate shouldn't be high.
-	c.db.SetMaxOpenConns(c.MaxOpenConnections)
-	c.db.SetMaxIdleConns(c.MaxIdleConnections)
-	c.db.SetConnMaxLifetime(c.maxConnectionLifetime)
+// pingHealthy pings db until verify_attempts consecutive pings succeed,
+// waiting verify_interval between them. It fails once verify_timeout passes
+// or right away if the server rejects the credentials or they expired.
+func (c *mySQLConnectionProducer) pingHealthy(ctx context.Context, db *sql.DB) error {
+	if c.VerifyAttempts <= 1 {
+		return connectionError(db.PingContext(ctx))
+	}
 
-	return c.db, nil
-}
+	ctx, cancel := context.WithTimeout(ctx, c.verifyTimeout)
+	defer cancel()
 
-func (c *mySQLConnectionProducer) SecretValues() map[string]string {
-	return map[string]string{
-		c.Password: "[password]",
+	var lastErr error
+	healthy := 0
+	for {
+		if err := db.PingContext(ctx); err != nil {
+			healthy = 0
+			// Keep the last server error rather than the expired deadline
+			if ctx.Err() == nil || lastErr == nil {
+				lastErr = connectionError(err)
+			}
+			if lastErr == ErrConnectionAuthFailed || lastErr == ErrConnectionPasswordExpired {
+				return lastErr
+			}
+		} else {
+			healthy++
+			if healthy == c.VerifyAttempts {
+				return nil
+			}
+		}
+
+		timer := time.NewTimer(jitterDelay(c.BackoffJitter, c.verifyInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return fmt.Errorf("connection was not healthy for %d consecutive pings within %s: %w", c.VerifyAttempts, c.verifyTimeout, lastErr)
+		case <-timer.C:
+		}
 	}
 }
 
-// Close attempts to close the connection
-func (c *mySQLConnectionProducer) Close() error {
-	// Grab the write lock
-	c.Lock()
-	defer c.Unlock()
-
-	if c.db != nil {
-		c.db.Close()
+// verifyDatabases checks that the connection user has access to each of the
+// verification_databases. SCHEMATA only lists the schemas the user holds a
+// privilege on, so a missing row means a missing grant.
+func (c *mySQLConnectionProducer) verifyDatabases(ctx context.Context) error {
+	if len(c.VerificationDatabases) == 0 {
+		return nil
 	}
 
-	c.db = nil
+	db, err := c.ReadConnection(ctx)
+	if err != nil {
+		return errwrap.Wrapf("error verifying connection: {{err}}", err)
+	}
+
+	for _, name := range c.VerificationDatabases {
+		var found int
+		err := db.(*sql.DB).QueryRowContext(ctx, verifyDatabaseSQL, name).Scan(&found)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("error verifying connection: no access to database %q", name)
+		}
+		if err != nil {
+			return fmt.Errorf("error verifying connection to database %q: %w", name, connectionError(err))
+		}
+	}
+
+	return nil
+}
+
+// requiredPrivileges returns the global privileges the connection user needs
+// for the configured operations.
+func (c *mySQLConnectionProducer) requiredPrivileges() []string {
+	required := []string{"CREATE USER", "GRANT OPTION"}
+	if c.RevocationKillConnections {
+		required = append(required, "PROCESS")
+	}
+	return required
+}
+
+// verifyPrivileges checks the connection user's grants for the privileges
+// the configured operations need if verify_connection_privileges is set.
+// Privileges held only through roles aren't listed by SHOW GRANTS and are
+// reported as missing.
+func (c *mySQLConnectionProducer) verifyPrivileges(ctx context.Context, db *sql.DB) error {
+	if !c.VerifyConnectionPrivileges {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, showGrantsSQL)
+	if err != nil {
+		return fmt.Errorf("error verifying connection privileges: %w", connectionError(err))
+	}
+	defer rows.Close()
+
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return fmt.Errorf("error verifying connection privileges: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error verifying connection privileges: %w", err)
+	}
+
+	if missing := missingPrivileges(grants, c.requiredPrivileges()); len(missing) > 0 {
+		return fmt.Errorf("error verifying connection privileges: connection user is missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (c *mySQLConnectionProducer) Connection(ctx context.Context) (interface{}, error) {
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	if len(c.ClusterSeeds) > 0 {
+		db, err := c.primaryConnection(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+		return c.db, nil
+	}
+
+	if c.ConnectionURLTemplate != "" {
+		c.db = c.openConnector(ctx, c.db, &credentialConnector{
+			render:   c.renderConnectionConfig,
+			provider: c.credentials,
+		})
+		return c.db, nil
+	}
+
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		return nil, err
+	}
+
+	c.db, err = c.openDB(ctx, c.db, connURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.db, nil
+}
+
+// renderConnectionURLTemplate renders connection_url_template with the
+// configured username and password and the referenced environment
+// variables.
+func (c *mySQLConnectionProducer) renderConnectionURLTemplate() (string, error) {
+	values := map[string]string{
+		"username": url.PathEscape(c.Username),
+		"password": c.Password,
+	}
+	for _, match := range envPlaceholderRe.FindAllStringSubmatch(c.ConnectionURLTemplate, -1) {
+		value, ok := os.LookupEnv(match[1])
+		if !ok {
+			return "", fmt.Errorf("connection_url_template references unset environment variable %q", match[1])
+		}
+		values["env:"+match[1]] = value
+	}
+	return dbutil.QueryHelper(c.ConnectionURLTemplate, values), nil
+}
+
+// renderConnectionConfig renders connection_url_template into a driver
+// config with the same options as connection_url.
+func (c *mySQLConnectionProducer) renderConnectionConfig() (*mysql.Config, error) {
+	rawURL, err := c.renderConnectionURLTemplate()
+	if err != nil {
+		return nil, err
+	}
+	connURL, err := c.addTLStoURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return mysql.ParseDSN(connURL)
+}
+
+// ReadConnection returns the pool used for read-only verification and health
+// operations. It falls back to the primary connection when no
+// replica_connection_url is configured.
+func (c *mySQLConnectionProducer) ReadConnection(ctx context.Context) (interface{}, error) {
+	if c.ReplicaConnectionURL == "" {
+		return c.Connection(ctx)
+	}
+
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	connURL, err := c.addTLStoURL(c.ReplicaConnectionURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.replicaDB, err = c.openDB(ctx, c.replicaDB, connURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.replicaDB, nil
+}
+
+// openDB returns the existing pool if it is still reachable, otherwise it
+// closes it and opens a new pool for the given DSN.
+func (c *mySQLConnectionProducer) openDB(ctx context.Context, db *sql.DB, connURL string) (*sql.DB, error) {
+	config, err := mysql.ParseDSN(connURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var provider credentialProvider = staticCredentialProvider(config.Passwd)
+	if c.credentials != nil {
+		provider = c.credentials
+	}
+	return c.openConnector(ctx, db, &credentialConnector{config: config, provider: provider}), nil
+}
+
+// openConnector is openDB for a connector.
+func (c *mySQLConnectionProducer) openConnector(ctx context.Context, db *sql.DB, connector driver.Connector) *sql.DB {
+	// If we already have a DB, test it and return
+	if db != nil {
+		if err := db.PingContext(ctx); err == nil {
+			return db
+		}
+		// If the ping was unsuccessful, close it and ignore errors as we'll be
+		// reestablishing anyways
+		db.Close()
+	}
+
+	db = sql.OpenDB(connector)
+
+	// Set some connection pool settings. We don't need much of this,
+	// since the request rate shouldn't be high.
+	c.applyPoolSettings(db)
+
+	return db
+}
+
+func (c *mySQLConnectionProducer) SecretValues() map[string]string {
+	secrets := map[string]string{
+		c.Password: "[password]",
+	}
+	if c.Password != "" {
+		for _, value := range passwordTemplateValues(c.Password) {
+			secrets[value] = "[password]"
+		}
+	}
+	if c.SSHPrivateKey != "" {
+		secrets[c.SSHPrivateKey] = "[ssh_private_key]"
+	}
+	if c.PasswordFile != "" {
+		if password, err := filePasswordProvider(c.PasswordFile).Password(context.Background()); err == nil {
+			for _, value := range passwordTemplateValues(password) {
+				secrets[value] = "[password]"
+			}
+		}
+	}
+	return secrets
+}
+
+// ReloadPoolSettings applies max_open_connections, max_idle_connections and
+// max_connection_lifetime from conf to the live connection pools without
+// reconnecting. Settings missing from conf keep their current value. Nothing
+// is applied if any of the given values is invalid.
+func (c *mySQLConnectionProducer) ReloadPoolSettings(conf map[string]interface{}) error {
+	var settings struct {
+		MaxOpenConnections       *int        `mapstructure:"max_open_connections"`
+		MaxIdleConnections       *int        `mapstructure:"max_idle_connections"`
+		MaxConnectionLifetimeRaw interface{} `mapstructure:"max_connection_lifetime"`
+	}
+	if err := mapstructure.WeakDecode(conf, &settings); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	maxOpen := c.MaxOpenConnections
+	if settings.MaxOpenConnections != nil {
+		maxOpen = *settings.MaxOpenConnections
+		if maxOpen == 0 {
+			maxOpen = 4
+		}
+	}
+
+	maxIdle := c.MaxIdleConnections
+	if settings.MaxIdleConnections != nil {
+		maxIdle = *settings.MaxIdleConnections
+		if maxIdle < 0 {
+			return fmt.Errorf("max_idle_connections must not be negative")
+		}
+		if maxIdle == 0 {
+			maxIdle = maxOpen
+		}
+	}
+	if maxOpen > 0 && maxIdle > maxOpen {
+		maxIdle = maxOpen
+	}
+
+	lifetime := c.maxConnectionLifetime
+	if settings.MaxConnectionLifetimeRaw != nil {
+		var err error
+		lifetime, err = parseutil.ParseDurationSecond(settings.MaxConnectionLifetimeRaw)
+		if err != nil {
+			return errwrap.Wrapf("invalid max_connection_lifetime: {{err}}", err)
+		}
+		if lifetime < 0 {
+			return fmt.Errorf("max_connection_lifetime must not be negative")
+		}
+		c.MaxConnectionLifetimeRaw = settings.MaxConnectionLifetimeRaw
+	}
+
+	c.MaxOpenConnections = maxOpen
+	c.MaxIdleConnections = maxIdle
+	c.maxConnectionLifetime = lifetime
+
+	for _, db := range []*sql.DB{c.db, c.replicaDB} {
+		if db != nil {
+			c.applyPoolSettings(db)
+		}
+	}
+
+	if c.RawConfig != nil {
+		for _, key := range []string{"max_open_connections", "max_idle_connections", "max_connection_lifetime"} {
+			if v, ok := conf[key]; ok {
+				c.RawConfig[key] = v
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyPoolSettings sets the configured pool limits on db.
+func (c *mySQLConnectionProducer) applyPoolSettings(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConnections)
+	db.SetMaxIdleConns(c.MaxIdleConnections)
+	db.SetConnMaxLifetime(c.maxConnectionLifetime)
+}
+
+// PoolStats returns the statistics of the primary connection pool. It
+// returns zero values if no connection has been established yet.
+func (c *mySQLConnectionProducer) PoolStats() sql.DBStats {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.db == nil {
+		return sql.DBStats{}
+	}
+	return c.db.Stats()
+}
+
+// checkPasswordCharacters returns an error if password contains a
+// character not in password_allowed_characters. The character isn't
+// reported, since it is part of the password.
+func (c *mySQLConnectionProducer) checkPasswordCharacters(password string) error {
+	if c.PasswordAllowedCharacters == "" {
+		return nil
+	}
+	for _, r := range password {
+		if !strings.ContainsRune(c.PasswordAllowedCharacters, r) {
+			return fmt.Errorf("password contains a character not in password_allowed_characters")
+		}
+	}
+	return nil
+}
+
+// userHost returns the host part of the accounts created for role.
+func (c *mySQLConnectionProducer) userHost(role string) string {
+	if host, ok := c.RoleUserHost[role]; ok {
+		return host
+	}
+	if c.UserHost == "" {
+		return "%"
+	}
+	return c.UserHost
+}
+
+// defaultSchema returns the default schema of the users created for role,
+// empty if none is configured.
+func (c *mySQLConnectionProducer) defaultSchema(role string) string {
+	if schema, ok := c.RoleDefaultSchema[role]; ok {
+		return schema
+	}
+	return c.DefaultSchema
+}
+
+// autocommitDisabled reports whether the statements run for users of role
+// run with autocommit disabled.
+func (c *mySQLConnectionProducer) autocommitDisabled(role string) bool {
+	if disabled, ok := c.RoleDisableAutocommit[role]; ok {
+		return disabled
+	}
+	return c.DisableAutocommit
+}
+
+// postCreationStatements returns the statements run after the creation
+// statements of role.
+func (c *mySQLConnectionProducer) postCreationStatements(role string) []string {
+	if statements, ok := c.RolePostCreationStatements[role]; ok {
+		return statements
+	}
+	return c.PostCreationStatements
+}
+
+// serverAddress returns the address connections are made to, which is the
+// host and port, socket, pipe or Cloud SQL instance. It is empty if the DSN
+// can't be assembled.
+func (c *mySQLConnectionProducer) serverAddress() string {
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		return ""
+	}
+	config, err := parseDSN(connURL)
+	if err != nil {
+		return ""
+	}
+	return config.Addr
+}
+
+// EffectiveDSN returns the DSN assembled from the connection config, with
+// the password masked, to diagnose TLS and parameter assembly. TLS material
+// is only referenced by its registered config name and never part of the
+// DSN.
+func (c *mySQLConnectionProducer) EffectiveDSN() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.Initialized {
+		return "", connutil.ErrNotInitialized
+	}
+
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		return "", err
+	}
+	config, err := parseDSN(connURL)
+	if err != nil {
+		return "", err
+	}
+	if config.Passwd != "" {
+		config.Passwd = redactedPassword
+	}
+	return config.FormatDSN(), nil
+}
+
+// lockOperation acquires the producer lock for a user operation. It gives up
+// with ErrOperationBusy once the context is done or the configured
+// lock_timeout has passed, instead of waiting behind a stuck operation
+// indefinitely.
+func (c *mySQLConnectionProducer) lockOperation(ctx context.Context) error {
+	if c.lockTimeout <= 0 && ctx.Done() == nil {
+		c.Lock()
+		return nil
+	}
+
+	acquired := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		c.Lock()
+		select {
+		case acquired <- struct{}{}:
+		case <-abandoned:
+			// Nobody is waiting for the lock anymore, so hand it back
+			c.Unlock()
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if c.lockTimeout > 0 {
+		timer := time.NewTimer(c.lockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-acquired:
+		return nil
+	case <-timeout:
+		close(abandoned)
+		return fmt.Errorf("%w: timed out after %s waiting for another operation to finish", ErrOperationBusy, c.lockTimeout)
+	case <-ctx.Done():
+		close(abandoned)
+		return fmt.Errorf("%w: %s while waiting for another operation to finish", ErrOperationBusy, ctx.Err())
+	}
+}
+
+// Close attempts to close the connection
+func (c *mySQLConnectionProducer) Close() error {
+	// Grab the write lock
+	c.Lock()
+	defer c.Unlock()
+
+	if c.db != nil {
+		c.db.Close()
+	}
+	if c.replicaDB != nil {
+		c.replicaDB.Close()
+	}
+	if c.standbyDB != nil {
+		c.standbyDB.Close()
+	}
+
+	c.db = nil
+	c.replicaDB = nil
+	c.standbyDB = nil
+
+	if c.sshTunnel != nil {
+		c.sshTunnel.Close()
+	}
+	if c.cloudSQLDialer != nil {
+		c.cloudSQLDialer.Close()
+	}
+
+	return nil
+}
+
+// validateConfig checks the decoded connection fields so that a bad value is
+// reported against the field it came from rather than as a generic driver
+// error when the DSN is assembled.
+func (c *mySQLConnectionProducer) validateConfig() error {
+	if err := validateConnectionURL("connection_url", c.ConnectionURL); err != nil {
+		return err
+	}
+	if c.ReplicaConnectionURL != "" {
+		if err := validateConnectionURL("replica_connection_url", c.ReplicaConnectionURL); err != nil {
+			return err
+		}
+	}
+
+	if c.CollationConnection != "" {
+		// Every collation but binary is named <charset>_<suffix>
+		if !sessionCharsetNameRe.MatchString(c.CollationConnection) ||
+			(c.CollationConnection != "binary" && !strings.Contains(c.CollationConnection, "_")) {
+			return fmt.Errorf("invalid collation_connection %q", c.CollationConnection)
+		}
+	}
+	if c.CharacterSetResults != "" && !sessionCharsetNameRe.MatchString(c.CharacterSetResults) {
+		return fmt.Errorf("invalid character_set_results %q", c.CharacterSetResults)
+	}
+
+	if c.PasswordFile != "" && c.Password != "" {
+		return fmt.Errorf("password and password_file are mutually exclusive")
+	}
+
+	switch c.AuthType {
+	case "", authTypePassword:
+	case authTypeCloudSQLConnector:
+		if c.InstanceConnectionName == "" {
+			return fmt.Errorf("instance_connection_name is required for auth_type %q", c.AuthType)
+		}
+		if c.Pipe != "" {
+			return fmt.Errorf("pipe cannot be used with auth_type %q", c.AuthType)
+		}
+	default:
+		return fmt.Errorf("invalid auth_type %q", c.AuthType)
+	}
+
+	switch c.ExecutionMode {
+	case "", executionModeTransaction, executionModeAutocommit:
+	default:
+		return fmt.Errorf("execution_mode must be %q or %q", executionModeTransaction, executionModeAutocommit)
+	}
+
+	if c.ParallelStatements {
+		if c.ExecutionMode != executionModeAutocommit {
+			return fmt.Errorf("parallel_statements requires execution_mode %q", executionModeAutocommit)
+		}
+		if c.CaptureCreationResults {
+			return fmt.Errorf("parallel_statements cannot be used with capture_creation_results")
+		}
+		if c.DisableAutocommit || len(c.RoleDisableAutocommit) > 0 {
+			return fmt.Errorf("parallel_statements cannot be used with disable_autocommit")
+		}
+	}
+
+	switch c.PastExpiration {
+	case "", pastExpirationReject, pastExpirationClamp:
+	default:
+		return fmt.Errorf("past_expiration must be %q or %q", pastExpirationReject, pastExpirationClamp)
+	}
+
+	switch c.RevocationMode {
+	case "", revocationModeDrop, revocationModeNoop:
+	default:
+		return fmt.Errorf("revocation_mode must be %q or %q", revocationModeDrop, revocationModeNoop)
+	}
+
+	if c.UsernameRandomLength < 0 || c.UsernameRandomLength > maxUsernameRandomLength {
+		return fmt.Errorf("username_random_length must be between 0 and %d", maxUsernameRandomLength)
+	}
+
+	switch c.RotationSyntax {
+	case "", rotationSyntaxAlterUser, rotationSyntaxSetPassword:
+	default:
+		return fmt.Errorf("rotation_syntax must be %q or %q", rotationSyntaxAlterUser, rotationSyntaxSetPassword)
+	}
+
+	for role, style := range c.RoleUsernameStyles {
+		if style != usernameStyleLegacy && style != usernameStyleModern {
+			return fmt.Errorf("role_username_styles: invalid style %q for role %q, must be %q or %q",
+				style, role, usernameStyleLegacy, usernameStyleModern)
+		}
+	}
+
+	if _, err := requireTLSClause(c.RequireTLS); err != nil {
+		return err
+	}
+	for role, value := range c.RoleRequireTLS {
+		if _, err := requireTLSClause(value); err != nil {
+			return fmt.Errorf("role_require_tls: role %q: %w", role, err)
+		}
+	}
+
+	if err := validateUserHost(c.UserHost); err != nil {
+		return err
+	}
+	for role, host := range c.RoleUserHost {
+		if err := validateUserHost(host); err != nil {
+			return fmt.Errorf("role_user_host: role %q: %w", role, err)
+		}
+	}
+
+	if c.DefaultSchema != "" && !schemaNameRe.MatchString(c.DefaultSchema) {
+		return fmt.Errorf("invalid default_schema %q", c.DefaultSchema)
+	}
+	for role, schema := range c.RoleDefaultSchema {
+		if !schemaNameRe.MatchString(schema) {
+			return fmt.Errorf("role_default_schema: invalid schema %q for role %q", schema, role)
+		}
+	}
+
+	if _, err := passwordLifetimeClause(c.PasswordLifetimeDays); err != nil {
+		return err
+	}
+	for role, days := range c.RolePasswordLifetimeDays {
+		if _, err := passwordLifetimeClause(days); err != nil {
+			return fmt.Errorf("role_password_lifetime_days: role %q: %w", role, err)
+		}
+	}
+
+	for role, authString := range c.RoleExternalAuth {
+		if authString == "" {
+			return fmt.Errorf("role_external_auth: role %q has an empty authentication string", role)
+		}
+	}
+
+	if len(c.ClusterSeeds) > 0 && (c.Pipe != "" || c.AuthType == authTypeCloudSQLConnector || c.ConnectionURLTemplate != "") {
+		return fmt.Errorf("cluster_seeds cannot be combined with pipe, connection_url_template or auth_type %q", authTypeCloudSQLConnector)
+	}
+
+	if _, ok := proxyProtocolNets[c.ProxyProtocolVersion]; !ok {
+		return fmt.Errorf("proxy_protocol_version must be %q or %q", proxyProtocolV1, proxyProtocolV2)
+	}
+	if c.SendProxyProtocol {
+		if c.Pipe != "" || c.AuthType == authTypeCloudSQLConnector {
+			return fmt.Errorf("send_proxy_protocol cannot be combined with pipe or auth_type %q", authTypeCloudSQLConnector)
+		}
+		if config, err := parseDSN(c.ConnectionURL); err == nil && config.Net != "tcp" {
+			return fmt.Errorf("send_proxy_protocol requires a tcp connection_url")
+		}
+	}
+
+	if c.SSHTunnel {
+		if c.SSHHost == "" || c.SSHUsername == "" || c.SSHPrivateKey == "" || c.SSHHostKey == "" {
+			return fmt.Errorf("ssh_tunnel requires ssh_host, ssh_username, ssh_private_key and ssh_host_key")
+		}
+		if c.Pipe != "" || c.AuthType == authTypeCloudSQLConnector || c.SendProxyProtocol {
+			return fmt.Errorf("ssh_tunnel cannot be combined with pipe, send_proxy_protocol or auth_type %q", authTypeCloudSQLConnector)
+		}
+		if config, err := parseDSN(c.ConnectionURL); err == nil && config.Net != "tcp" {
+			return fmt.Errorf("ssh_tunnel requires a tcp connection_url")
+		}
+	}
+
+	if c.Pipe != "" && !namedPipeSupported {
+		return fmt.Errorf("pipe is only supported on Windows")
+	}
+
+	if c.TLSSkipHostnameVerify && len(c.TLSCAData) == 0 {
+		return fmt.Errorf("tls_insecure_skip_hostname_verify requires tls_ca")
+	}
+
+	if c.AllowCleartextPasswords && !c.tlsEnabled() {
+		return fmt.Errorf("allow_cleartext_passwords requires TLS to be enabled")
+	}
+
+	if c.MaxIdleConnections < 0 {
+		return fmt.Errorf("max_idle_connections must not be negative")
+	}
+	if c.maxConnectionLifetime < 0 {
+		return fmt.Errorf("max_connection_lifetime must not be negative")
+	}
+	if c.lockTimeout < 0 {
+		return fmt.Errorf("lock_timeout must not be negative")
+	}
+	switch c.BackoffJitter {
+	case "", backoffJitterEqual, backoffJitterFull, backoffJitterNone:
+	default:
+		return fmt.Errorf("backoff_jitter must be %q, %q or %q", backoffJitterEqual, backoffJitterFull, backoffJitterNone)
+	}
+	if c.RetryBudgetPerMinute < 0 {
+		return fmt.Errorf("retry_budget_per_minute must not be negative")
+	}
+	if c.UsernameUniquenessAttempts < 0 {
+		return fmt.Errorf("username_uniqueness_attempts must not be negative")
+	}
+	if c.VerifyAttempts < 0 {
+		return fmt.Errorf("verify_attempts must not be negative")
+	}
+	if c.verifyInterval < 0 {
+		return fmt.Errorf("verify_interval must not be negative")
+	}
+	if c.verifyTimeout <= 0 {
+		return fmt.Errorf("verify_timeout must be positive")
+	}
+	if c.creationStatementTimeout < 0 || c.revocationStatementTimeout < 0 || c.rotationStatementTimeout < 0 {
+		return fmt.Errorf("query_timeout and the statement timeouts must not be negative")
+	}
+	if c.creationDelay < 0 {
+		return fmt.Errorf("creation_delay must not be negative")
+	}
+	if c.expiredUserSweepInterval < 0 {
+		return fmt.Errorf("expired_user_sweep_interval must not be negative")
+	}
+	if c.maxReplicationLag < 0 {
+		return fmt.Errorf("max_replication_lag must not be negative")
+	}
+	if c.maxReplicationLag > 0 && c.ReplicaConnectionURL == "" {
+		return fmt.Errorf("max_replication_lag requires replica_connection_url")
+	}
+	switch c.ReplicationLagAction {
+	case "", replicationLagWarn, replicationLagWait, replicationLagFail:
+	default:
+		return fmt.Errorf("replication_lag_action must be %q, %q or %q", replicationLagWarn, replicationLagWait, replicationLagFail)
+	}
+	if c.expiredUserSweepInterval > 0 && c.UsernamePrefix == "" {
+		return fmt.Errorf("expired_user_sweep_interval requires username_prefix to identify Vault users")
+	}
+	if c.ServerSideTTLEvents && c.ServerSideTTLEventSchema == "" {
+		return fmt.Errorf("server_side_ttl_events requires server_side_ttl_event_schema to create the events in")
+	}
+	for _, verb := range c.AllowedStatementVerbs {
+		if verb == "" {
+			return fmt.Errorf("allowed_statement_verbs must not contain empty verbs")
+		}
+	}
+	for _, entry := range c.SchemaAllowList {
+		if entry == "" || strings.Contains(strings.TrimSuffix(entry, "*"), "*") {
+			return fmt.Errorf("invalid schema_allow_list entry %q, * is only allowed at the end", entry)
+		}
+	}
+	if c.poolValidationInterval < 0 {
+		return fmt.Errorf("pool_validation_interval must not be negative")
+	}
+	if c.slowCheckoutThreshold < 0 {
+		return fmt.Errorf("slow_checkout_threshold must not be negative")
+	}
+	if c.maxExecutionTime < 0 || c.maxExecutionTime > maxMaxExecutionTime {
+		return fmt.Errorf("max_execution_time must be between 0 and %s", maxMaxExecutionTime)
+	}
+	if c.maxExecutionTime%time.Millisecond != 0 {
+		return fmt.Errorf("max_execution_time must be a whole number of milliseconds")
+	}
+	if c.StandbyConnectionURL != "" {
+		if err := validateConnectionURL("standby_connection_url", c.StandbyConnectionURL); err != nil {
+			return err
+		}
+		if len(c.ClusterSeeds) > 0 || c.ConnectionURLTemplate != "" {
+			return fmt.Errorf("standby_connection_url cannot be combined with cluster_seeds or connection_url_template")
+		}
+	}
+	if c.StandbyPromotionFailures < 0 {
+		return fmt.Errorf("standby_promotion_failures must not be negative")
+	}
+	if c.standbyHealthCheckInterval <= 0 {
+		return fmt.Errorf("standby_health_check_interval must be positive")
+	}
+	if c.userCountInterval < 0 {
+		return fmt.Errorf("user_count_interval must not be negative")
+	}
+	if c.userCountInterval > 0 && c.UsernamePrefix == "" {
+		return fmt.Errorf("user_count_interval requires username_prefix to identify Vault users")
+	}
+
+	if len(c.TLSCAData) > 0 {
+		if ok := x509.NewCertPool().AppendCertsFromPEM(c.TLSCAData); !ok {
+			return fmt.Errorf("tls_ca must contain at least one PEM encoded certificate")
+		}
+	}
+	if len(c.TLSCertificateKeyData) > 0 {
+		if _, err := tls.X509KeyPair(c.TLSCertificateKeyData, c.TLSCertificateKeyData); err != nil {
+			return fmt.Errorf("tls_certificate_key must contain a PEM encoded certificate and private key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// tlsEnabled reports whether connections will be made over TLS, either with
+// the tls_ca/tls_certificate_key settings or the tls parameter of the DSN.
+func (c *mySQLConnectionProducer) tlsEnabled() bool {
+	if len(c.TLSCAData) > 0 || len(c.TLSCertificateKeyData) > 0 {
+		return true
+	}
+
+	config, err := parseDSN(c.ConnectionURL)
+	if err != nil {
+		return false
+	}
+	// "preferred" silently falls back to an unencrypted connection
+	switch config.TLSConfig {
+	case "", "false", "preferred":
+		return false
+	default:
+		return true
+	}
+}
+
+// validateConnectionURL parses the given DSN and checks its host and port.
+// The DSN itself is never included in the error since it may hold the
+// password.
+func validateConnectionURL(field, connURL string) error {
+	config, err := parseDSN(connURL)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid DSN: %w", field, err)
+	}
+
+	if config.Net != "tcp" || config.Addr == "" {
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return fmt.Errorf("%s has an invalid host:port address", field)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("%s port must be 1-65535", field)
+	}
 
 	return nil
 }
 
+// namedPipePath expands a bare pipe name such as "MySQL" into the full local
+// pipe path. Names that are already paths are returned unchanged.
+func namedPipePath(name string) string {
+	if strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\pipe\` + name
+}
+
+// parseDSN parses a DSN with the mysql driver and repairs bracketed IPv6
+// hosts given without a port. The driver appends the default port to those
+// without noticing the brackets, producing an address like "[[::1]]:3306".
+func parseDSN(dsn string) (*mysql.Config, error) {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Net == "tcp" && strings.HasPrefix(config.Addr, "[[") {
+		if i := strings.LastIndex(config.Addr, "]:"); i > 0 {
+			host := strings.Trim(config.Addr[:i+1], "[]")
+			config.Addr = net.JoinHostPort(host, config.Addr[i+2:])
+		}
+	}
+
+	return config, nil
+}
+
 func (c *mySQLConnectionProducer) getTLSAuth() (tlsConfig *tls.Config, err error) {
 	if len(c.TLSCAData) == 0 &&
 		len(c.TLSCertificateKeyData) == 0 {
@@ -210,11 +1843,55 @@ func (c *mySQLConnectionProducer) getTLSAuth() (tlsConfig *tls.Config, err error
 		Certificates: clientCert,
 	}
 
+	if c.TLSSkipHostnameVerify {
+		// Disable the default verification, which includes the hostname
+		// check, and verify the chain ourselves instead
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChainOnly(rootCertPool)
+	}
+
 	return tlsConfig, nil
 }
 
+// verifyChainOnly returns a VerifyPeerCertificate function that verifies the
+// presented certificate chain against roots without checking the hostname.
+func verifyChainOnly(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
 func (c *mySQLConnectionProducer) addTLStoDSN() (connURL string, err error) {
-	config, err := mysql.ParseDSN(c.ConnectionURL)
+	if c.standbyPromoted {
+		return c.addTLStoURL(c.StandbyConnectionURL)
+	}
+	return c.addTLStoURL(c.ConnectionURL)
+}
+
+func (c *mySQLConnectionProducer) addTLStoURL(rawURL string) (connURL string, err error) {
+	config, err := parseDSN(rawURL)
 	if err != nil {
 		return "", fmt.Errorf("unable to parse connectionURL: %s", err)
 	}
@@ -223,6 +1900,58 @@ func (c *mySQLConnectionProducer) addTLStoDSN() (connURL string, err error) {
 		config.TLSConfig = c.tlsConfigName
 	}
 
+	if c.AllowCleartextPasswords {
+		config.AllowCleartextPasswords = true
+	}
+
+	if c.AllowNativePasswords != nil {
+		config.AllowNativePasswords = *c.AllowNativePasswords
+	}
+	if c.AllowOldPasswords {
+		config.AllowOldPasswords = true
+	}
+	if c.InterpolateParams {
+		config.InterpolateParams = true
+	}
+	if c.RequireDatabase != nil && !*c.RequireDatabase {
+		config.DBName = ""
+	}
+
+	// The driver runs SET for every parameter it doesn't know itself
+	if c.CollationConnection != "" || c.CharacterSetResults != "" || c.maxExecutionTime > 0 {
+		if config.Params == nil {
+			config.Params = make(map[string]string)
+		}
+		if c.maxExecutionTime > 0 {
+			config.Params["max_execution_time"] = strconv.FormatInt(int64(c.maxExecutionTime/time.Millisecond), 10)
+		}
+		if c.CollationConnection != "" {
+			config.Params["collation_connection"] = c.CollationConnection
+		}
+		if c.CharacterSetResults != "" {
+			config.Params["character_set_results"] = c.CharacterSetResults
+		}
+	}
+
+	if c.SendProxyProtocol {
+		registerProxyProtocolDialers()
+		config.Net = proxyProtocolNets[c.ProxyProtocolVersion]
+	}
+
+	if c.SSHTunnel && c.sshNetName != "" {
+		config.Net = c.sshNetName
+	}
+
+	if c.Pipe != "" {
+		config.Net = namedPipeNet
+		config.Addr = namedPipePath(c.Pipe)
+	}
+
+	if c.AuthType == authTypeCloudSQLConnector && c.cloudSQLNetName != "" {
+		config.Net = c.cloudSQLNetName
+		config.Addr = c.InstanceConnectionName
+	}
+
 	connURL = config.FormatDSN()
 
 	return connURL, nil
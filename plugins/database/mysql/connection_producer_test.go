@@ -2,16 +2,22 @@ package mysql
 
 import (
 	"context"
+	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	paths "path"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/hashicorp/vault/helper/testhelpers/certhelpers"
 	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
 	"github.com/ory/dockertest"
@@ -45,6 +51,21 @@ func Test_addTLStoDSN(t *testing.T) {
 			tlsConfigName:  "tlsTest101",
 			expectedResult: "user:pa?ssword?@tcp(localhost:3306)/test?tls=tlsTest101&foo=bar",
 		},
+		"ipv6 host and port": {
+			rootUrl:        "user:password@tcp([::1]:3306)/test",
+			tlsConfigName:  "",
+			expectedResult: "user:password@tcp([::1]:3306)/test",
+		},
+		"ipv6 bracketed host without port": {
+			rootUrl:        "user:password@tcp([2001:db8::10])/test",
+			tlsConfigName:  "",
+			expectedResult: "user:password@tcp([2001:db8::10]:3306)/test",
+		},
+		"ipv6 host without brackets": {
+			rootUrl:        "user:password@tcp(::1)/test",
+			tlsConfigName:  "",
+			expectedResult: "user:password@tcp([::1]:3306)/test",
+		},
 		"tls, valid tls parameter in query string": {
 			rootUrl:        "user:password@tcp(localhost:3306)/test?tls=true",
 			tlsConfigName:  "",
@@ -70,6 +91,769 @@ func Test_addTLStoDSN(t *testing.T) {
 	}
 }
 
+func Test_addTLStoDSN_authParams(t *testing.T) {
+	disabled := false
+
+	type testCase struct {
+		allowNative    *bool
+		allowOld       bool
+		expectedResult string
+	}
+
+	tests := map[string]testCase{
+		"driver defaults": {
+			expectedResult: "user:password@tcp(localhost:3306)/test",
+		},
+		"native passwords disabled": {
+			allowNative:    &disabled,
+			expectedResult: "user:password@tcp(localhost:3306)/test?allowNativePasswords=false",
+		},
+		"old passwords": {
+			allowOld:       true,
+			expectedResult: "user:password@tcp(localhost:3306)/test?allowOldPasswords=true",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tCase := mySQLConnectionProducer{
+				ConnectionURL:        "user:password@tcp(localhost:3306)/test",
+				AllowNativePasswords: test.allowNative,
+				AllowOldPasswords:    test.allowOld,
+			}
+
+			actual, err := tCase.addTLStoDSN()
+			if err != nil {
+				t.Fatalf("error occurred in test: %s", err)
+			}
+			if actual != test.expectedResult {
+				t.Fatalf("generated: %s, expected: %s", actual, test.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_addTLStoDSN_requireDatabase(t *testing.T) {
+	required, notRequired := true, false
+
+	type testCase struct {
+		requireDatabase *bool
+		expectedResult  string
+	}
+
+	tests := map[string]testCase{
+		"default": {
+			expectedResult: "user:password@tcp(localhost:3306)/test",
+		},
+		"required": {
+			requireDatabase: &required,
+			expectedResult:  "user:password@tcp(localhost:3306)/test",
+		},
+		"not required": {
+			requireDatabase: &notRequired,
+			expectedResult:  "user:password@tcp(localhost:3306)/",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tCase := mySQLConnectionProducer{
+				ConnectionURL:   "user:password@tcp(localhost:3306)/test",
+				RequireDatabase: test.requireDatabase,
+			}
+
+			actual, err := tCase.addTLStoDSN()
+			if err != nil {
+				t.Fatalf("error occurred in test: %s", err)
+			}
+			if actual != test.expectedResult {
+				t.Fatalf("generated: %s, expected: %s", actual, test.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_addTLStoDSN_interpolateParams(t *testing.T) {
+	tCase := mySQLConnectionProducer{
+		ConnectionURL:     "user:password@tcp(localhost:3306)/test",
+		InterpolateParams: true,
+	}
+
+	actual, err := tCase.addTLStoDSN()
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+
+	expected := "user:password@tcp(localhost:3306)/test?interpolateParams=true"
+	if actual != expected {
+		t.Fatalf("generated: %s, expected: %s", actual, expected)
+	}
+}
+
+func Test_addTLStoDSN_namedPipe(t *testing.T) {
+	type testCase struct {
+		pipe           string
+		expectedResult string
+	}
+
+	tests := map[string]testCase{
+		"pipe name": {
+			pipe:           "MySQL",
+			expectedResult: `user:password@np(\\.\pipe\MySQL)/test`,
+		},
+		"pipe path": {
+			pipe:           `\\db01\pipe\MySQL`,
+			expectedResult: `user:password@np(\\db01\pipe\MySQL)/test`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tCase := mySQLConnectionProducer{
+				ConnectionURL: "user:password@tcp(localhost:3306)/test",
+				Pipe:          test.pipe,
+			}
+
+			actual, err := tCase.addTLStoDSN()
+			if err != nil {
+				t.Fatalf("error occurred in test: %s", err)
+			}
+			if actual != test.expectedResult {
+				t.Fatalf("generated: %s, expected: %s", actual, test.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_addTLStoDSN_sessionCharset(t *testing.T) {
+	tCase := mySQLConnectionProducer{
+		ConnectionURL:       "user:password@tcp(localhost:3306)/test?charset=utf8mb4",
+		CollationConnection: "utf8mb4_unicode_ci",
+		CharacterSetResults: "utf8mb4",
+	}
+
+	actual, err := tCase.addTLStoDSN()
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+
+	expected := "user:password@tcp(localhost:3306)/test?character_set_results=utf8mb4&charset=utf8mb4&collation_connection=utf8mb4_unicode_ci"
+	if actual != expected {
+		t.Fatalf("generated: %s, expected: %s", actual, expected)
+	}
+}
+
+func Test_addTLStoDSN_maxExecutionTime(t *testing.T) {
+	tCase := mySQLConnectionProducer{
+		ConnectionURL:    "user:password@tcp(localhost:3306)/test",
+		maxExecutionTime: 1500 * time.Millisecond,
+	}
+
+	actual, err := tCase.addTLStoDSN()
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+
+	expected := "user:password@tcp(localhost:3306)/test?max_execution_time=1500"
+	if actual != expected {
+		t.Fatalf("generated: %s, expected: %s", actual, expected)
+	}
+}
+
+func TestInit_validateConfig(t *testing.T) {
+	type testCase struct {
+		conf        map[string]interface{}
+		expectedErr string
+	}
+
+	tests := map[string]testCase{
+		"valid": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+			},
+		},
+		"invalid dsn": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)",
+			},
+			expectedErr: "connection_url is not a valid DSN",
+		},
+		"port out of range": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:70000)/test",
+			},
+			expectedErr: "connection_url port must be 1-65535",
+		},
+		"ipv6 host": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp([::1])/test",
+			},
+		},
+		"replica port out of range": {
+			conf: map[string]interface{}{
+				"connection_url":         "user:password@tcp(localhost:3306)/test",
+				"replica_connection_url": "user:password@tcp(replica:0)/test",
+			},
+			expectedErr: "replica_connection_url port must be 1-65535",
+		},
+		"negative idle connections": {
+			conf: map[string]interface{}{
+				"connection_url":       "user:password@tcp(localhost:3306)/test",
+				"max_idle_connections": -1,
+			},
+			expectedErr: "max_idle_connections must not be negative",
+		},
+		"negative verify_attempts": {
+			conf: map[string]interface{}{
+				"connection_url":  "user:password@tcp(localhost:3306)/test",
+				"verify_attempts": -1,
+			},
+			expectedErr: "verify_attempts must not be negative",
+		},
+		"negative max_execution_time": {
+			conf: map[string]interface{}{
+				"connection_url":     "user:password@tcp(localhost:3306)/test",
+				"max_execution_time": "-1s",
+			},
+			expectedErr: "max_execution_time must be between",
+		},
+		"sub-millisecond max_execution_time": {
+			conf: map[string]interface{}{
+				"connection_url":     "user:password@tcp(localhost:3306)/test",
+				"max_execution_time": "1500us",
+			},
+			expectedErr: "max_execution_time must be a whole number of milliseconds",
+		},
+		"invalid default_schema": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+				"default_schema": "app`; DROP DATABASE app",
+			},
+			expectedErr: "invalid default_schema",
+		},
+		"invalid past_expiration": {
+			conf: map[string]interface{}{
+				"connection_url":  "user:password@tcp(localhost:3306)/test",
+				"past_expiration": "ignore",
+			},
+			expectedErr: "past_expiration must be",
+		},
+		"parallel_statements in a transaction": {
+			conf: map[string]interface{}{
+				"connection_url":      "user:password@tcp(localhost:3306)/test",
+				"parallel_statements": true,
+			},
+			expectedErr: "parallel_statements requires execution_mode",
+		},
+		"max_replication_lag without replica": {
+			conf: map[string]interface{}{
+				"connection_url":      "user:password@tcp(localhost:3306)/test",
+				"max_replication_lag": "10s",
+			},
+			expectedErr: "max_replication_lag requires replica_connection_url",
+		},
+		"invalid replication_lag_action": {
+			conf: map[string]interface{}{
+				"connection_url":         "user:password@tcp(localhost:3306)/test",
+				"replication_lag_action": "ignore",
+			},
+			expectedErr: "replication_lag_action must be",
+		},
+		"invalid backoff_jitter": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+				"backoff_jitter": "decorrelated",
+			},
+			expectedErr: "backoff_jitter must be",
+		},
+		"invalid schema_allow_list": {
+			conf: map[string]interface{}{
+				"connection_url":    "user:password@tcp(localhost:3306)/test",
+				"schema_allow_list": []string{"tenant_*_app"},
+			},
+			expectedErr: "invalid schema_allow_list entry",
+		},
+		"server_side_ttl_events without schema": {
+			conf: map[string]interface{}{
+				"connection_url":         "user:password@tcp(localhost:3306)/test",
+				"server_side_ttl_events": true,
+			},
+			expectedErr: "server_side_ttl_events requires server_side_ttl_event_schema",
+		},
+		"invalid revocation_mode": {
+			conf: map[string]interface{}{
+				"connection_url":  "user:password@tcp(localhost:3306)/test",
+				"revocation_mode": "skip",
+			},
+			expectedErr: "revocation_mode must be",
+		},
+		"invalid collation_connection": {
+			conf: map[string]interface{}{
+				"connection_url":       "user:password@tcp(localhost:3306)/test",
+				"collation_connection": "utf8mb4; DROP DATABASE app",
+			},
+			expectedErr: "invalid collation_connection",
+		},
+		"invalid character_set_results": {
+			conf: map[string]interface{}{
+				"connection_url":        "user:password@tcp(localhost:3306)/test",
+				"character_set_results": "utf8 mb4",
+			},
+			expectedErr: "invalid character_set_results",
+		},
+		"cleartext passwords without tls": {
+			conf: map[string]interface{}{
+				"connection_url":            "user:password@tcp(localhost:3306)/test",
+				"allow_cleartext_passwords": true,
+			},
+			expectedErr: "allow_cleartext_passwords requires TLS to be enabled",
+		},
+		"cleartext passwords with tls": {
+			conf: map[string]interface{}{
+				"connection_url":            "user:password@tcp(localhost:3306)/test?tls=true",
+				"allow_cleartext_passwords": true,
+			},
+		},
+		"invalid auth_type": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+				"auth_type":      "kerberos",
+			},
+			expectedErr: `invalid auth_type "kerberos"`,
+		},
+		"cloudsql connector without instance": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+				"auth_type":      "cloudsql_connector",
+			},
+			expectedErr: "instance_connection_name is required",
+		},
+		"invalid tls_ca": {
+			conf: map[string]interface{}{
+				"connection_url": "user:password@tcp(localhost:3306)/test",
+				"tls_ca":         "not a certificate",
+			},
+			expectedErr: "tls_ca must contain at least one PEM encoded certificate",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &mySQLConnectionProducer{}
+
+			_, err := c.Init(context.Background(), test.conf, false)
+			if test.expectedErr == "" && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Fatalf("expected error containing %q, got: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestLockOperation_timeout(t *testing.T) {
+	c := &mySQLConnectionProducer{
+		lockTimeout: 50 * time.Millisecond,
+	}
+
+	c.Lock()
+	if err := c.lockOperation(context.Background()); !errors.Is(err, ErrOperationBusy) {
+		t.Fatalf("expected lock acquisition to time out, got: %v", err)
+	}
+	c.Unlock()
+
+	// The abandoned acquisition must hand the lock back
+	if err := c.lockOperation(context.Background()); err != nil {
+		t.Fatalf("expected lock to be acquired, got: %s", err)
+	}
+	c.Unlock()
+}
+
+func TestLockOperation_contextDeadline(t *testing.T) {
+	c := &mySQLConnectionProducer{}
+
+	c.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.lockOperation(ctx); !errors.Is(err, ErrOperationBusy) {
+		t.Fatalf("expected lock acquisition to give up at the deadline, got: %v", err)
+	}
+	c.Unlock()
+
+	if err := c.lockOperation(context.Background()); err != nil {
+		t.Fatalf("expected lock to be acquired, got: %s", err)
+	}
+	c.Unlock()
+}
+
+func TestVerifyChainOnly(t *testing.T) {
+	caCert := certhelpers.NewCert(t,
+		certhelpers.CommonName("test certificate authority"),
+		certhelpers.IsCA(true),
+		certhelpers.SelfSign(),
+	)
+	otherCA := certhelpers.NewCert(t,
+		certhelpers.CommonName("other certificate authority"),
+		certhelpers.IsCA(true),
+		certhelpers.SelfSign(),
+	)
+	serverCert := certhelpers.NewCert(t,
+		certhelpers.CommonName("server"),
+		certhelpers.DNS("db.internal"),
+		certhelpers.Parent(caCert),
+	)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert.Pem)
+
+	verify := verifyChainOnly(roots)
+	if err := verify([][]byte{serverCert.RawCert}, nil); err != nil {
+		t.Fatalf("expected certificate for another hostname to verify, got: %s", err)
+	}
+
+	otherRoots := x509.NewCertPool()
+	otherRoots.AppendCertsFromPEM(otherCA.Pem)
+
+	verify = verifyChainOnly(otherRoots)
+	if err := verify([][]byte{serverCert.RawCert}, nil); err == nil {
+		t.Fatalf("expected certificate from an untrusted CA to fail verification")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	c := &mySQLConnectionProducer{
+		ConnectionURL:      "user:password@tcp(localhost:3306)/test",
+		MaxOpenConnections: 4,
+	}
+	defer c.Close()
+
+	if stats := c.PoolStats(); stats != (sql.DBStats{}) {
+		t.Fatalf("expected zero stats before initialization, got: %#v", stats)
+	}
+
+	c.Initialized = true
+	if _, err := c.Connection(context.Background()); err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+
+	if stats := c.PoolStats(); stats.MaxOpenConnections != 4 {
+		t.Fatalf("expected max open connections of 4, got: %d", stats.MaxOpenConnections)
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	accessDenied := &mysql.MySQLError{
+		Number:  1045,
+		Message: "Access denied for user 'vault'@'10.0.0.1' (using password: YES)",
+	}
+
+	err := connectionError(fmt.Errorf("ping: %w", accessDenied))
+	if err != ErrConnectionAuthFailed {
+		t.Fatalf("expected ErrConnectionAuthFailed, got: %v", err)
+	}
+
+	unknownDB := &mysql.MySQLError{Number: 1049, Message: "Unknown database 'test'"}
+	if err := connectionError(unknownDB); !errors.Is(err, unknownDB) || !strings.Contains(err.Error(), "require_database") {
+		t.Fatalf("expected unknown database error to mention require_database, got: %v", err)
+	}
+
+	for _, number := range []uint16{1820, 1862} {
+		expired := &mysql.MySQLError{Number: number, Message: "You must reset your password using ALTER USER statement before executing this statement."}
+		if err := connectionError(expired); err != ErrConnectionPasswordExpired {
+			t.Fatalf("expected ErrConnectionPasswordExpired for %d, got: %v", number, err)
+		}
+	}
+
+	other := &mysql.MySQLError{Number: 1064}
+	if err := connectionError(other); err != other {
+		t.Fatalf("expected other errors to be returned unchanged, got: %v", err)
+	}
+}
+
+func TestPingHealthy(t *testing.T) {
+	c := &mySQLConnectionProducer{
+		VerifyAttempts: 3,
+		verifyInterval: time.Millisecond,
+		verifyTimeout:  time.Second,
+	}
+	if err := c.pingHealthy(context.Background(), sql.OpenDB(&fakeDriver{})); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	conf := map[string]interface{}{
+		"connection_url":  "user:password@tcp(127.0.0.1:1)/test",
+		"verify_attempts": 2,
+		"verify_interval": "10ms",
+		"verify_timeout":  "100ms",
+	}
+	_, err := c.Init(context.Background(), conf, true)
+	if err == nil || !strings.Contains(err.Error(), "not healthy for 2 consecutive pings") {
+		t.Fatalf("expected health check error, got: %v", err)
+	}
+}
+
+func TestVerifyPrivileges(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			showGrantsSQL: {
+				columns: []string{"Grants for vault@%"},
+				values:  [][]driver.Value{{"GRANT CREATE USER ON *.* TO `vault`@`%` WITH GRANT OPTION"}},
+			},
+		},
+	}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	c := &mySQLConnectionProducer{VerifyConnectionPrivileges: true}
+	if err := c.verifyPrivileges(context.Background(), db); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	c.RevocationKillConnections = true
+	err := c.verifyPrivileges(context.Background(), db)
+	if err == nil || !strings.Contains(err.Error(), "connection user is missing PROCESS") {
+		t.Fatalf("expected missing PROCESS error, got: %v", err)
+	}
+}
+
+func TestVerifyDatabases(t *testing.T) {
+	type testCase struct {
+		databases   map[string]error
+		checked     []string
+		expectedErr string
+	}
+
+	tests := map[string]testCase{
+		"all granted": {
+			databases: map[string]error{"app": nil, "reporting": nil},
+			checked:   []string{"app", "reporting"},
+		},
+		"missing grant": {
+			databases:   map[string]error{"app": nil, "reporting": sql.ErrNoRows},
+			checked:     []string{"app", "reporting"},
+			expectedErr: `no access to database "reporting"`,
+		},
+		"access denied": {
+			databases:   map[string]error{"app": nil, "reporting": &mysql.MySQLError{Number: 1044}},
+			checked:     []string{"app", "reporting"},
+			expectedErr: `error verifying connection to database "reporting"`,
+		},
+		"first failing database": {
+			databases:   map[string]error{"app": sql.ErrNoRows, "reporting": sql.ErrNoRows},
+			checked:     []string{"app"},
+			expectedErr: `no access to database "app"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var queried []string
+			d := &fakeDriver{
+				onQuery: func(query string, args []driver.NamedValue) (fakeRows, error) {
+					name := args[0].Value.(string)
+					queried = append(queried, name)
+					switch err := test.databases[name]; err {
+					case nil:
+						return fakeRows{values: [][]driver.Value{{int64(1)}}}, nil
+					case sql.ErrNoRows:
+						return fakeRows{}, nil
+					default:
+						return fakeRows{}, err
+					}
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.VerificationDatabases = []string{"app", "reporting"}
+
+			err := db.verifyDatabases(context.Background())
+			if test.expectedErr == "" && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+				t.Fatalf("expected error containing %q, got: %v", test.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(queried, test.checked) {
+				t.Fatalf("expected databases %v to be checked, got: %v", test.checked, queried)
+			}
+		})
+	}
+}
+
+func TestInit_connectionURLTemplate(t *testing.T) {
+	os.Setenv("VAULT_TEST_MYSQL_HOST", "db01")
+	defer os.Unsetenv("VAULT_TEST_MYSQL_HOST")
+
+	c := &mySQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url":          "ignored:ignored@tcp(localhost:3306)/test",
+		"connection_url_template": "{{username}}:{{password}}@tcp({{env:VAULT_TEST_MYSQL_HOST}}:3306)/test",
+		"username":                "vault",
+		"password":                "secret",
+	}
+	if _, err := c.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if c.ConnectionURL != "vault:secret@tcp(db01:3306)/test" {
+		t.Fatalf("unexpected connection URL: %s", c.ConnectionURL)
+	}
+
+	// The template is rendered again for every new connection
+	os.Setenv("VAULT_TEST_MYSQL_HOST", "db02")
+	config, err := c.renderConnectionConfig()
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if config.Addr != "db02:3306" || config.Passwd != "secret" {
+		t.Fatalf("unexpected config: %s %s", config.Addr, config.Passwd)
+	}
+
+	conf["connection_url_template"] = "vault:secret@tcp({{env:VAULT_TEST_MYSQL_UNSET}})/test"
+	if _, err := c.Init(context.Background(), conf, false); err == nil || !strings.Contains(err.Error(), "VAULT_TEST_MYSQL_UNSET") {
+		t.Fatalf("expected error for unset environment variable, got: %v", err)
+	}
+}
+
+func TestInit_cloudSQLConnector(t *testing.T) {
+	defer func(f func(context.Context) (cloudSQLDialer, error)) {
+		newCloudSQLDialer = f
+	}(newCloudSQLDialer)
+
+	var dialers []*fakeCloudSQLDialer
+	newCloudSQLDialer = func(context.Context) (cloudSQLDialer, error) {
+		d := &fakeCloudSQLDialer{dialed: make(chan string, 1)}
+		dialers = append(dialers, d)
+		return d, nil
+	}
+
+	c := &mySQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url":           "user:password@tcp(localhost:3306)/test",
+		"auth_type":                "cloudsql_connector",
+		"instance_connection_name": "project:region:instance",
+		"verify_attempts":          1,
+	}
+	if _, err := c.Init(context.Background(), conf, true); err == nil {
+		t.Fatalf("err expected, got nil")
+	}
+
+	select {
+	case instance := <-dialers[0].dialed:
+		if instance != "project:region:instance" {
+			t.Fatalf("expected the instance connection name to be dialed, got %q", instance)
+		}
+	default:
+		t.Fatalf("expected the Cloud SQL connector to be dialed")
+	}
+
+	// Re-initializing replaces the instance's dialer, and closing the
+	// producer closes it
+	if _, err := c.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if len(dialers) != 2 || !dialers[0].closed || dialers[1].closed {
+		t.Fatalf("expected the first dialer to be replaced")
+	}
+	c.Close()
+	if !dialers[1].closed {
+		t.Fatalf("expected the dialer to be closed with the producer")
+	}
+
+	other := &mySQLConnectionProducer{}
+	if _, err := other.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	defer other.Close()
+	if other.cloudSQLNetName == c.cloudSQLNetName {
+		t.Fatalf("expected each producer to register its own dialer")
+	}
+}
+
+type fakeCloudSQLDialer struct {
+	dialed chan string
+	closed bool
+}
+
+func (d *fakeCloudSQLDialer) Dial(_ context.Context, instance string) (net.Conn, error) {
+	select {
+	case d.dialed <- instance:
+	default:
+	}
+	return nil, errors.New("dial refused")
+}
+
+func (d *fakeCloudSQLDialer) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestReloadPoolSettings(t *testing.T) {
+	c := &mySQLConnectionProducer{}
+	_, err := c.Init(context.Background(), map[string]interface{}{
+		"connection_url":       "user:password@tcp(localhost:3306)/test",
+		"max_open_connections": 4,
+	}, false)
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Connection(context.Background()); err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+
+	err = c.ReloadPoolSettings(map[string]interface{}{
+		"max_open_connections":    "10",
+		"max_connection_lifetime": "1h",
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if stats := c.PoolStats(); stats.MaxOpenConnections != 10 {
+		t.Fatalf("expected max open connections of 10, got: %d", stats.MaxOpenConnections)
+	}
+	if c.maxConnectionLifetime != time.Hour || c.RawConfig["max_open_connections"] != "10" {
+		t.Fatalf("expected settings to be recorded, got lifetime %s and config %#v", c.maxConnectionLifetime, c.RawConfig)
+	}
+
+	err = c.ReloadPoolSettings(map[string]interface{}{
+		"max_open_connections": 2,
+		"max_idle_connections": -1,
+	})
+	if err == nil {
+		t.Fatalf("expected error for negative max_idle_connections")
+	}
+	if stats := c.PoolStats(); stats.MaxOpenConnections != 10 {
+		t.Fatalf("expected invalid settings not to be applied, got: %d", stats.MaxOpenConnections)
+	}
+}
+
+func TestReadConnection_replicaFallback(t *testing.T) {
+	c := &mySQLConnectionProducer{
+		ConnectionURL: "user:password@tcp(localhost:3306)/test",
+		Initialized:   true,
+	}
+	defer c.Close()
+
+	read, err := c.ReadConnection(context.Background())
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+	if read.(*sql.DB) != c.db || c.replicaDB != nil {
+		t.Fatalf("expected read connection to fall back to the primary")
+	}
+
+	c.ReplicaConnectionURL = "user:password@tcp(replica:3306)/test"
+	read, err = c.ReadConnection(context.Background())
+	if err != nil {
+		t.Fatalf("error occurred in test: %s", err)
+	}
+	if read.(*sql.DB) != c.replicaDB || c.replicaDB == c.db {
+		t.Fatalf("expected read connection to use the replica pool")
+	}
+}
+
 func TestInit_clientTLS(t *testing.T) {
 	t.Skip("Skipping this test because CircleCI can't mount the files we need without further investigation: " +
 		"https://support.circleci.com/hc/en-us/articles/360007324514-How-can-I-mount-volumes-to-docker-containers-")
@@ -314,3 +1098,97 @@ func writeFile(t *testing.T, filename string, data []byte, perms os.FileMode) {
 		t.Fatalf("Unable to write to file [%s]: %s", filename, err)
 	}
 }
+
+func TestEffectiveDSN(t *testing.T) {
+	db := new(false)
+	if _, err := db.EffectiveDSN(); err == nil {
+		t.Fatalf("err expected before Initialize, got nil")
+	}
+
+	conf := map[string]interface{}{
+		"connection_url":     "{{username}}:{{password}}@tcp(localhost:3306)/test?tls=skip-verify",
+		"username":           "vault",
+		"password":           "s3cr3t",
+		"interpolate_params": true,
+	}
+	if _, err := db.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	dsn, err := db.EffectiveDSN()
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if strings.Contains(dsn, "s3cr3t") {
+		t.Fatalf("password leaked in DSN: %s", dsn)
+	}
+
+	expected := "vault:[redacted]@tcp(localhost:3306)/test?interpolateParams=true&tls=skip-verify"
+	if dsn != expected {
+		t.Fatalf("expected %q, got %q", expected, dsn)
+	}
+}
+
+func TestInit_statementTimeouts(t *testing.T) {
+	type testCase struct {
+		conf             map[string]interface{}
+		expectCreation   time.Duration
+		expectRevocation time.Duration
+		expectRotation   time.Duration
+		expectErr        bool
+	}
+
+	tests := map[string]testCase{
+		"unbounded by default": {
+			conf: map[string]interface{}{},
+		},
+		"query_timeout applies to every operation": {
+			conf: map[string]interface{}{
+				"query_timeout": "10s",
+			},
+			expectCreation:   10 * time.Second,
+			expectRevocation: 10 * time.Second,
+			expectRotation:   10 * time.Second,
+		},
+		"statement timeouts override query_timeout": {
+			conf: map[string]interface{}{
+				"query_timeout":              "10s",
+				"creation_statement_timeout": "1m",
+				"rotation_statement_timeout": 5,
+			},
+			expectCreation:   time.Minute,
+			expectRevocation: 10 * time.Second,
+			expectRotation:   5 * time.Second,
+		},
+		"negative timeout": {
+			conf: map[string]interface{}{
+				"revocation_statement_timeout": "-1s",
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.conf["connection_url"] = "user:password@tcp(localhost:3306)/test"
+
+			c := &mySQLConnectionProducer{}
+			_, err := c.Init(context.Background(), test.conf, false)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			actual := []time.Duration{c.creationStatementTimeout, c.revocationStatementTimeout, c.rotationStatementTimeout}
+			expected := []time.Duration{test.expectCreation, test.expectRevocation, test.expectRotation}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected timeouts %v, got %v", expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// credentialProvider supplies the password for every new connection, so
+// short lived credentials like cloud IAM tokens can be fetched right before
+// dialing instead of being fixed when the pool is opened.
+type credentialProvider interface {
+	Password(ctx context.Context) (string, error)
+}
+
+// staticCredentialProvider always returns the same password. It is used when
+// no other provider is configured, with the password of the connection URL.
+type staticCredentialProvider string
+
+func (p staticCredentialProvider) Password(context.Context) (string, error) {
+	return string(p), nil
+}
+
+// filePasswordProvider reads the password from the file at the given path
+// on every dial, so a password rotated by a secret injector is picked up by
+// new connections. A trailing newline is ignored.
+type filePasswordProvider string
+
+func (p filePasswordProvider) Password(context.Context) (string, error) {
+	content, err := ioutil.ReadFile(string(p))
+	if err != nil {
+		return "", fmt.Errorf("failed to read password_file: %w", err)
+	}
+
+	password := strings.TrimRight(string(content), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password_file %q is empty", string(p))
+	}
+	return password, nil
+}
+
+var _ driver.Connector = (*credentialConnector)(nil)
+
+// credentialConnector opens connections for config with the password the
+// provider returns at dial time. When render is set, the config is rendered
+// for every connection instead. Without a provider the password of the
+// config is used.
+type credentialConnector struct {
+	config   *mysql.Config
+	render   func() (*mysql.Config, error)
+	provider credentialProvider
+}
+
+func (c *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	config := c.config
+	if c.render != nil {
+		var err error
+		config, err = c.render()
+		if err != nil {
+			return nil, err
+		}
+	}
+	config = config.Clone()
+
+	if c.provider != nil {
+		password, err := c.provider.Password(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get connection password: %w", err)
+		}
+		config.Passwd = password
+	}
+
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *credentialConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type countingCredentialProvider struct {
+	calls int
+	err   error
+}
+
+func (p *countingCredentialProvider) Password(context.Context) (string, error) {
+	p.calls++
+	return "", p.err
+}
+
+func TestOpenDB_credentialProvider(t *testing.T) {
+	provider := &countingCredentialProvider{err: errors.New("token expired")}
+	c := &mySQLConnectionProducer{credentials: provider}
+
+	db, err := c.openDB(context.Background(), nil, "user:password@tcp(127.0.0.1:1)/test")
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		err = db.PingContext(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "token expired") {
+			t.Fatalf("expected provider error, got: %v", err)
+		}
+	}
+	if provider.calls < 2 {
+		t.Fatalf("expected the provider to be asked on every dial, got %d calls", provider.calls)
+	}
+}
+
+func TestStaticCredentialProvider(t *testing.T) {
+	password, err := staticCredentialProvider("secret").Password(context.Background())
+	if err != nil || password != "secret" {
+		t.Fatalf("expected secret, got %q, %v", password, err)
+	}
+}
+
+func TestFilePasswordProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysql-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	provider := filePasswordProvider(path)
+
+	if _, err := provider.Password(context.Background()); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Password(context.Background()); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Fatalf("expected error for empty file, got: %v", err)
+	}
+
+	for _, expected := range []string{"first", "rotated"} {
+		if err := ioutil.WriteFile(path, []byte(expected+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		password, err := provider.Password(context.Background())
+		if err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+		if password != expected {
+			t.Fatalf("expected %q, got %q", expected, password)
+		}
+	}
+
+	c := &mySQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url": "user:{{password}}@tcp(localhost:3306)/test",
+		"password_file":  path,
+	}
+	if _, err := c.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if c.credentials != provider {
+		t.Fatalf("expected the file provider to be used, got: %#v", c.credentials)
+	}
+	if c.SecretValues()["rotated"] != "[password]" {
+		t.Fatalf("expected the file password in the secret values")
+	}
+
+	conf["password"] = "secret"
+	if _, err := c.Init(context.Background(), conf, false); err == nil {
+		t.Fatalf("expected error with both password and password_file")
+	}
+}
@@ -0,0 +1,226 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver is a minimal database/sql driver that records the calls made
+// against it, so statement execution can be tested without a MySQL server.
+type fakeDriver struct {
+	mu  sync.Mutex
+	log []string
+
+	// errs fails any prepare or exec of a query starting with the key
+	errs map[string]error
+	// prepareErrs fails the prepare of a query starting with the key, the
+	// query can still be executed without preparing it
+	prepareErrs map[string]error
+	// rows are returned by queries starting with the key
+	rows map[string]fakeRows
+	// onExec is called before each executed query
+	onExec func(query string)
+	// onQuery answers unprepared queries in place of errs and rows, for
+	// results that depend on the query's arguments
+	onQuery func(query string, args []driver.NamedValue) (fakeRows, error)
+	// pingErr fails every ping of a connection
+	pingErr error
+	// commitErr fails every commit
+	commitErr error
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+var _ driver.Connector = (*fakeDriver)(nil)
+
+// newFakeMySQL returns an initialized MySQL whose connection is backed by
+// the fake driver.
+func newFakeMySQL(t *testing.T, d *fakeDriver) *MySQL {
+	t.Helper()
+
+	db := new(false)
+	db.Initialized = true
+	db.db = sql.OpenDB(d)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func (d *fakeDriver) record(entry string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, entry)
+}
+
+// calls returns the recorded calls.
+func (d *fakeDriver) calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.log...)
+}
+
+func lookupPrefix(m map[string]error, query string) error {
+	for prefix, err := range m {
+		if strings.HasPrefix(query, prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fakeDriver) exec(query string) error {
+	if d.onExec != nil {
+		d.onExec(query)
+	}
+	d.record("exec: " + query)
+	return lookupPrefix(d.errs, query)
+}
+
+func (d *fakeDriver) query(query string) (driver.Rows, error) {
+	d.record("query: " + query)
+	if err := lookupPrefix(d.errs, query); err != nil {
+		return nil, err
+	}
+	for prefix, rows := range d.rows {
+		if strings.HasPrefix(query, prefix) {
+			return &fakeResultRows{rows: rows}, nil
+		}
+	}
+	return &fakeResultRows{}, nil
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+func (d *fakeDriver) Driver() driver.Driver {
+	return fakeDriverOpener{d}
+}
+
+type fakeDriverOpener struct {
+	d *fakeDriver
+}
+
+func (o fakeDriverOpener) Open(string) (driver.Conn, error) {
+	return &fakeConn{d: o.d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.record("prepare: " + query)
+	if err := lookupPrefix(c.d.prepareErrs, query); err != nil {
+		return nil, err
+	}
+	if err := lookupPrefix(c.d.errs, query); err != nil {
+		return nil, err
+	}
+	return &fakeStmt{d: c.d, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	return c.d.pingErr
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.d.record("begin")
+	return &fakeTx{d: c.d}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.d.exec(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.d.onQuery == nil {
+		return c.d.query(query)
+	}
+
+	c.d.record("query: " + query)
+	rows, err := c.d.onQuery(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeResultRows{rows: rows}, nil
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if err := s.d.exec(s.query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return s.d.query(s.query)
+}
+
+type fakeTx struct {
+	d *fakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.d.record("commit")
+	return tx.d.commitErr
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.d.record("rollback")
+	return nil
+}
+
+type fakeResultRows struct {
+	rows fakeRows
+	next int
+}
+
+func (r *fakeResultRows) Columns() []string {
+	if r.rows.columns == nil {
+		return []string{"result"}
+	}
+	return r.rows.columns
+}
+
+func (r *fakeResultRows) Close() error {
+	return nil
+}
+
+func (r *fakeResultRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows.values) {
+		return io.EOF
+	}
+	copy(dest, r.rows.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// primaryMemberSQL returns the current primary of a single-primary Group
+// Replication group, such as an InnoDB Cluster.
+const primaryMemberSQL = `
+	SELECT MEMBER_HOST, MEMBER_PORT FROM performance_schema.replication_group_members
+	WHERE MEMBER_ROLE = 'PRIMARY' AND MEMBER_STATE = 'ONLINE'
+`
+
+// primaryConnection returns the pool for the group's current primary,
+// discovering it through the cluster seeds whenever the pool is unreachable.
+func (c *mySQLConnectionProducer) primaryConnection(ctx context.Context) (*sql.DB, error) {
+	if c.db != nil {
+		if err := c.db.PingContext(ctx); err == nil {
+			return c.db, nil
+		}
+		c.db.Close()
+		c.db = nil
+	}
+
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		return nil, err
+	}
+	config, err := mysql.ParseDSN(connURL)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := c.discoverPrimary(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	config, err = configWithAddr(config, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.openConnector(ctx, nil, &credentialConnector{config: config, provider: c.credentials}), nil
+}
+
+// discoverPrimary asks each cluster seed in turn for the address of the
+// group's current primary.
+func (c *mySQLConnectionProducer) discoverPrimary(ctx context.Context, config *mysql.Config) (string, error) {
+	var errs error
+	for _, seed := range c.ClusterSeeds {
+		seedConfig, err := configWithAddr(config, seed)
+		if err != nil {
+			return "", err
+		}
+
+		db := sql.OpenDB(&credentialConnector{config: seedConfig, provider: c.credentials})
+		var host string
+		var port int
+		err = db.QueryRowContext(ctx, primaryMemberSQL).Scan(&host, &port)
+		db.Close()
+		if err == nil {
+			return net.JoinHostPort(host, strconv.Itoa(port)), nil
+		}
+		errs = multierror.Append(errs, fmt.Errorf("seed %s: %w", seed, err))
+	}
+
+	return "", fmt.Errorf("failed to discover the group replication primary: %w", errs)
+}
+
+// configWithAddr returns a copy of config that connects to addr. The TLS
+// server name is derived from the address when a DSN is parsed, so the copy
+// is parsed again instead of only changing Addr, which would verify the
+// server's certificate against the connection_url host.
+func configWithAddr(config *mysql.Config, addr string) (*mysql.Config, error) {
+	clone := config.Clone()
+	clone.Addr = addr
+	return mysql.ParseDSN(clone.FormatDSN())
+}
+
+// isReadOnlyError reports whether err was caused by writing to a read-only
+// server, which happens after the primary of a group has moved:
+// 1290: The MySQL server is running with the --read-only option
+// 1836: Running in read-only mode
+func isReadOnlyError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1290 || mysqlErr.Number == 1836
+}
+
+// invalidatePrimary closes the primary pool db after a write was rejected by
+// a read-only server, so the next operation discovers the new primary. A
+// pool that was already replaced by a concurrent operation is left alone.
+func (c *mySQLConnectionProducer) invalidatePrimary(db *sql.DB) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.ClusterSeeds) == 0 || c.db == nil || c.db != db {
+		return
+	}
+	c.db.Close()
+	c.db = nil
+}
@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+	"github.com/hashicorp/vault/helper/testhelpers/certhelpers"
+)
+
+func TestIsReadOnlyError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"read-only":        {err: &stdmysql.MySQLError{Number: 1290}, expected: true},
+		"wrapped":          {err: fmt.Errorf("exec: %w", &stdmysql.MySQLError{Number: 1836}), expected: true},
+		"other error code": {err: &stdmysql.MySQLError{Number: 1396}},
+		"nil":              {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := isReadOnlyError(test.err); actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMySQL_readOnlyWriteInvalidatesPrimary(t *testing.T) {
+	d := &fakeDriver{
+		errs: map[string]error{
+			"CREATE USER": &stdmysql.MySQLError{Number: 1290},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.ClusterSeeds = []string{"db01:3306"}
+
+	err := db.executePreparedStatementsWithMap(context.Background(), []string{"CREATE USER 'v_test'@'%'"}, nil)
+	if !isReadOnlyError(err) {
+		t.Fatalf("expected read-only error, got: %v", err)
+	}
+	if db.db != nil {
+		t.Fatalf("expected the primary pool to be closed for rediscovery")
+	}
+}
+
+func TestDiscoverPrimary_unreachableSeeds(t *testing.T) {
+	c := &mySQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url": "user:password@tcp(localhost:3306)/test?timeout=1s",
+		"cluster_seeds":  []string{"127.0.0.1:1", "127.0.0.1:2"},
+	}
+	if _, err := c.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	_, err := c.Connection(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "seed 127.0.0.1:1") || !strings.Contains(err.Error(), "seed 127.0.0.1:2") {
+		t.Fatalf("expected discovery error for both seeds, got: %v", err)
+	}
+
+	conf["connection_url_template"] = "user:password@tcp(localhost:3306)/test"
+	if _, err := c.Init(context.Background(), conf, false); err == nil || !strings.Contains(err.Error(), "cluster_seeds cannot be combined") {
+		t.Fatalf("expected error combining cluster_seeds and connection_url_template, got: %v", err)
+	}
+}
+
+func TestConfigWithAddr_tlsServerName(t *testing.T) {
+	caCert := certhelpers.NewCert(t,
+		certhelpers.CommonName("test certificate authority"),
+		certhelpers.IsCA(true),
+		certhelpers.SelfSign(),
+	)
+	serverCert := certhelpers.NewCert(t,
+		certhelpers.CommonName("db02"),
+		certhelpers.DNS("db02"),
+		certhelpers.Parent(caCert),
+	)
+
+	c := &mySQLConnectionProducer{}
+	conf := map[string]interface{}{
+		"connection_url": "user:password@tcp(db01:3306)/test",
+		"cluster_seeds":  []string{"db02:3306"},
+		"tls_ca":         string(caCert.Pem),
+	}
+	if _, err := c.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	defer c.Close()
+
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	config, err := stdmysql.ParseDSN(connURL)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	seedConfig, err := configWithAddr(config, "db02:3306")
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	// The driver keeps the TLS config unexported, so the handshake it would
+	// run is reproduced with the config it holds
+	handshake := func(config *stdmysql.Config) error {
+		tlsConfig := (*tls.Config)(unsafe.Pointer(reflect.ValueOf(config).Elem().FieldByName("tls").Pointer()))
+		if tlsConfig == nil {
+			t.Fatalf("expected a TLS config")
+		}
+
+		clientConn, serverConn := net.Pipe()
+		defer clientConn.Close()
+		defer serverConn.Close()
+
+		certificate, err := tls.X509KeyPair(serverCert.Pem, serverCert.PrivateKeyPEM())
+		if err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+		server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{certificate}})
+		go server.Handshake()
+
+		return tls.Client(clientConn, tlsConfig).Handshake()
+	}
+
+	if err := handshake(seedConfig); err != nil {
+		t.Fatalf("expected the seed's certificate to verify, got: %s", err)
+	}
+	if err := handshake(config); err == nil {
+		t.Fatalf("expected the certificate of db02 not to verify for db01")
+	}
+}
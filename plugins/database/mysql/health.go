@@ -0,0 +1,114 @@
+package mysql
+
+import (
+	"strings"
+	"sync"
+)
+
+// HealthState is the connection health reported to health callbacks.
+type HealthState string
+
+// Health states reported to health callbacks
+const (
+	HealthHealthy   HealthState = "healthy"
+	HealthUnhealthy HealthState = "unhealthy"
+)
+
+// healthCallbackBuffer is how many transitions a slow callback can fall
+// behind before further transitions are dropped for it
+const healthCallbackBuffer = 16
+
+// HealthTransition describes a change of the connection health.
+type HealthTransition struct {
+	State HealthState
+	// Error is the error that made the connection unhealthy with the
+	// connection secrets removed, empty when healthy
+	Error string
+}
+
+// healthWatchers tracks the connection health detected by the pool
+// validator and the standby health checks, and notifies the registered
+// callbacks when it changes.
+type healthWatchers struct {
+	sync.Mutex
+	state    HealthState
+	watchers map[int]chan HealthTransition
+	nextID   int
+}
+
+// OnHealthTransition registers fn to be called whenever the connection
+// health detected by pool_validation_interval or the standby health checks
+// changes between healthy and unhealthy. Callbacks run on a goroutine of
+// their own, one transition at a time and in order, so a slow callback
+// doesn't stall operations: transitions it falls too far behind on are
+// dropped. The returned function unregisters fn.
+func (m *MySQL) OnHealthTransition(fn func(HealthTransition)) func() {
+	ch := make(chan HealthTransition, healthCallbackBuffer)
+	go func() {
+		for transition := range ch {
+			fn(transition)
+		}
+	}()
+
+	m.health.Lock()
+	defer m.health.Unlock()
+
+	id := m.health.nextID
+	m.health.nextID++
+	if m.health.watchers == nil {
+		m.health.watchers = make(map[int]chan HealthTransition)
+	}
+	m.health.watchers[id] = ch
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.health.Lock()
+			defer m.health.Unlock()
+			delete(m.health.watchers, id)
+			close(ch)
+		})
+	}
+}
+
+// reportHealth records the outcome of a health check, nil for a healthy
+// connection, and notifies the callbacks if the health changed.
+func (m *MySQL) reportHealth(err error) {
+	transition := HealthTransition{State: HealthHealthy}
+	if err != nil {
+		transition = HealthTransition{
+			State: HealthUnhealthy,
+			Error: m.sanitizeError(err),
+		}
+	}
+
+	m.health.Lock()
+	defer m.health.Unlock()
+
+	if m.health.state == transition.State {
+		return
+	}
+	m.health.state = transition.State
+	m.logger.Debug("connection health changed", "state", transition.State)
+
+	for _, ch := range m.health.watchers {
+		select {
+		case ch <- transition:
+		default:
+			m.logger.Warn("health callback is falling behind, dropping transition", "state", transition.State)
+		}
+	}
+}
+
+// sanitizeError returns the message of err with the connection secrets
+// replaced, like the error sanitizer middleware does for operation errors.
+func (m *MySQL) sanitizeError(err error) string {
+	msg := err.Error()
+	for secret, replacement := range m.SecretValues() {
+		if secret == "" {
+			continue
+		}
+		msg = strings.Replace(msg, secret, replacement, -1)
+	}
+	return msg
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMySQL_OnHealthTransition(t *testing.T) {
+	db := new(false)
+	db.Password = "secret"
+
+	transitions := make(chan HealthTransition, 10)
+	unregister := db.OnHealthTransition(func(transition HealthTransition) {
+		transitions <- transition
+	})
+
+	next := func() HealthTransition {
+		t.Helper()
+		select {
+		case transition := <-transitions:
+			return transition
+		case <-time.After(time.Second):
+			t.Fatalf("expected a transition")
+			return HealthTransition{}
+		}
+	}
+
+	db.reportHealth(nil)
+	if transition := next(); transition.State != HealthHealthy {
+		t.Fatalf("expected a healthy transition, got: %#v", transition)
+	}
+
+	// Repeated reports of the same state aren't transitions
+	db.reportHealth(nil)
+	db.reportHealth(errors.New("access denied for password secret"))
+	transition := next()
+	if transition.State != HealthUnhealthy {
+		t.Fatalf("expected an unhealthy transition, got: %#v", transition)
+	}
+	if transition.Error != "access denied for password [password]" {
+		t.Fatalf("expected a sanitized error, got: %q", transition.Error)
+	}
+
+	unregister()
+	unregister()
+	db.reportHealth(nil)
+	select {
+	case transition := <-transitions:
+		t.Fatalf("expected no transition after unregistering, got: %#v", transition)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMySQL_OnHealthTransition_slowCallback(t *testing.T) {
+	db := new(false)
+
+	block := make(chan struct{})
+	defer close(block)
+	db.OnHealthTransition(func(HealthTransition) {
+		<-block
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*healthCallbackBuffer; i++ {
+			db.reportHealth(nil)
+			db.reportHealth(errors.New("connection refused"))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a slow callback not to block health reports")
+	}
+}
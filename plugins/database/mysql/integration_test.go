@@ -0,0 +1,125 @@
+package mysql
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	mysqlhelper "github.com/hashicorp/vault/helper/testhelpers/mysql"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// prepareMySQL returns the connection URL of a MySQL server for integration
+// tests, starting a container unless MYSQL_URL is set. The test is skipped
+// when neither is available.
+func prepareMySQL(t *testing.T, legacy bool) string {
+	t.Helper()
+
+	if os.Getenv("MYSQL_URL") == "" && !dockerAvailable() {
+		t.Skip("docker is not available, set MYSQL_URL to run against an existing server")
+	}
+
+	cleanup, connURL := mysqlhelper.PrepareTestContainer(t, legacy, "secret")
+	t.Cleanup(cleanup)
+	return connURL
+}
+
+// dockerAvailable reports whether the docker daemon responds.
+func dockerAvailable() bool {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithVersion("1.39"))
+	if err != nil {
+		return false
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = cli.Ping(ctx)
+	return err == nil
+}
+
+func TestMySQL_integrationLifecycle(t *testing.T) {
+	type testCase struct {
+		legacy bool
+	}
+
+	tests := map[string]testCase{
+		"modern": {legacy: false},
+		"legacy": {legacy: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			connURL := prepareMySQL(t, test.legacy)
+			ctx := context.Background()
+
+			db := new(test.legacy)
+			defer db.Close()
+
+			initReq := dbplugin.InitializeRequest{
+				Config: map[string]interface{}{
+					"connection_url": connURL,
+				},
+				VerifyConnection: true,
+			}
+			if _, err := db.Initialize(ctx, initReq); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			// PREPARE isn't supported in the prepared statement protocol, so
+			// these statements exercise the 1295 fallback
+			createReq := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "test",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{`
+						CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+						set @grants=CONCAT("GRANT SELECT ON ", "*", ".* TO '{{name}}'@'%'");
+						PREPARE grantStmt from @grants;
+						EXECUTE grantStmt;
+						DEALLOCATE PREPARE grantStmt;`,
+					},
+				},
+				Password:   "09g8hanbdfkVSM",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			createResp, err := db.NewUser(ctx, createReq)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := mysqlhelper.TestCredsExist(t, connURL, createResp.Username, createReq.Password); err != nil {
+				t.Fatalf("could not connect with new credentials: %s", err)
+			}
+
+			updateReq := dbplugin.UpdateUserRequest{
+				Username: createResp.Username,
+				Password: &dbplugin.ChangePassword{
+					NewPassword: "0hk2bnSIsdfvM9",
+				},
+			}
+			if _, err := db.UpdateUser(ctx, updateReq); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := mysqlhelper.TestCredsExist(t, connURL, createResp.Username, updateReq.Password.NewPassword); err != nil {
+				t.Fatalf("could not connect with updated credentials: %s", err)
+			}
+			if err := mysqlhelper.TestCredsExist(t, connURL, createResp.Username, createReq.Password); err == nil {
+				t.Fatalf("old credentials still work")
+			}
+
+			deleteReq := dbplugin.DeleteUserRequest{
+				Username: createResp.Username,
+			}
+			if _, err := db.DeleteUser(ctx, deleteReq); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := mysqlhelper.TestCredsExist(t, connURL, createResp.Username, updateReq.Password.NewPassword); err == nil {
+				t.Fatalf("credentials still work after revocation")
+			}
+		})
+	}
+}
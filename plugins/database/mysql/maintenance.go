@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+
+	multierror "github.com/hashicorp/go-multierror"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+const (
+	managedUsersSQL = `
+		SELECT DISTINCT User FROM mysql.user WHERE User LIKE ? ORDER BY User
+	`
+
+	// dropAllBatchSize is the number of users DropAllManagedUsers revokes
+	// between progress logs and cancellation checks
+	dropAllBatchSize = 50
+)
+
+// DropAllManagedUsers revokes every user whose name starts with
+// username_prefix, running each through DeleteUser with the default
+// revocation statements. The connection user and reserved_usernames are
+// never dropped, even when they share the prefix. It returns the number of users dropped along with
+// the failures of the users it couldn't drop. This is meant for tearing
+// down test environments and requires allow_drop_all_managed_users.
+func (m *MySQL) DropAllManagedUsers(ctx context.Context) (int, error) {
+	if !m.AllowDropAllManagedUsers {
+		return 0, fmt.Errorf("dropping all managed users requires allow_drop_all_managed_users")
+	}
+	if m.UsernamePrefix == "" {
+		return 0, fmt.Errorf("dropping all managed users requires username_prefix to identify Vault users")
+	}
+
+	usernames, err := m.managedUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list managed users: %w", err)
+	}
+
+	m.logger.Warn("dropping all managed users", "prefix", m.UsernamePrefix, "users", len(usernames))
+
+	var errs *multierror.Error
+	dropped := 0
+	for start := 0; start < len(usernames); start += dropAllBatchSize {
+		if err := ctx.Err(); err != nil {
+			errs = multierror.Append(errs, err)
+			break
+		}
+
+		end := minInt(start+dropAllBatchSize, len(usernames))
+		for _, username := range usernames[start:end] {
+			if _, err := m.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: username}); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("user %q: %w", username, err))
+				continue
+			}
+			dropped++
+		}
+		m.logger.Info("dropped managed users", "dropped", dropped, "remaining", len(usernames)-end)
+	}
+
+	return dropped, errs.ErrorOrNil()
+}
+
+// managedUsers returns the names of the users matching username_prefix,
+// leaving out the connection user and reserved_usernames.
+func (m *MySQL) managedUsers(ctx context.Context) ([]string, error) {
+	db, err := m.operationConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, managedUsersSQL, likePrefix(m.UsernamePrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		if m.isReservedUsername(username) {
+			m.logger.Warn("not dropping reserved user matching username_prefix", "username", username)
+			continue
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
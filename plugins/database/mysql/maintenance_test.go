@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+func TestMySQL_DropAllManagedUsers(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			managedUsersSQL: {
+				columns: []string{"User"},
+				values:  [][]driver.Value{{"vault_a"}, {"vault_b"}, {"vault_c"}},
+			},
+		},
+		errs: map[string]error{
+			"DROP USER 'vault_b'": errors.New("drop failed"),
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.UsernamePrefix = "vault_"
+
+	if _, err := db.DropAllManagedUsers(context.Background()); err == nil {
+		t.Fatalf("err expected without allow_drop_all_managed_users, got nil")
+	}
+	if len(d.calls()) != 0 {
+		t.Fatalf("expected no calls while not allowed, got: %v", d.calls())
+	}
+
+	db.AllowDropAllManagedUsers = true
+	dropped, err := db.DropAllManagedUsers(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `user "vault_b"`) {
+		t.Fatalf("expected error for vault_b, got: %v", err)
+	}
+	if dropped != 2 {
+		t.Fatalf("expected 2 users dropped, got: %d", dropped)
+	}
+
+	for _, call := range []string{"exec: DROP USER 'vault_a'@'%'", "exec: DROP USER 'vault_c'@'%'"} {
+		if !strutil.StrListContains(d.calls(), call) {
+			t.Fatalf("expected %q in calls:\n%s", call, strings.Join(d.calls(), "\n"))
+		}
+	}
+}
+
+func TestMySQL_DropAllManagedUsers_reserved(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			managedUsersSQL: {
+				columns: []string{"User"},
+				values:  [][]driver.Value{{"vault_a"}, {"vault_admin"}, {"Vault_Backup"}},
+			},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.UsernamePrefix = "vault_"
+	db.Username = "vault_admin"
+	db.ReservedUsernames = []string{"vault_backup"}
+	db.AllowDropAllManagedUsers = true
+
+	dropped, err := db.DropAllManagedUsers(context.Background())
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if dropped != 1 {
+		t.Fatalf("expected 1 user dropped, got: %d", dropped)
+	}
+
+	for _, call := range d.calls() {
+		if strings.Contains(call, "vault_admin") || strings.Contains(call, "Vault_Backup") {
+			t.Fatalf("expected reserved users to be kept, got call: %s", call)
+		}
+	}
+	if !strutil.StrListContains(d.calls(), "exec: DROP USER 'vault_a'@'%'") {
+		t.Fatalf("expected vault_a to be dropped, got:\n%s", strings.Join(d.calls(), "\n"))
+	}
+}
+
+func TestMySQL_DropAllManagedUsers_requiresPrefix(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.AllowDropAllManagedUsers = true
+
+	if _, err := db.DropAllManagedUsers(context.Background()); err == nil {
+		t.Fatalf("err expected without username_prefix, got nil")
+	}
+	if len(d.calls()) != 0 {
+		t.Fatalf("expected no calls without username_prefix, got: %v", d.calls())
+	}
+}
@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"strings"
+	"sync"
+)
+
+// Creation metadata template keys available to revocation statements in
+// addition to {{name}} and {{username}}.
+const (
+	metadataRoleName    = "role_name"
+	metadataDisplayName = "display_name"
+	metadataExpiration  = "expiration"
+	metadataHost        = "host"
+	metadataGrants      = "grants"
+	metadataSchema      = "default_schema"
+)
+
+// metadataUserRoles are the roles created for the user, recorded for
+// drop_user_role
+const metadataUserRoles = "user_roles"
+
+// Metadata recorded for auditing which server a user was created on. These
+// aren't available to revocation statements.
+const (
+	metadataCreatedAt     = "created_at"
+	metadataServerAddress = "server_address"
+	metadataServerVersion = "server_version"
+	// metadataReplicationLag is the replica lag at creation, recorded when
+	// it exceeded max_replication_lag
+	metadataReplicationLag = "replication_lag"
+)
+
+var revocationMetadataKeys = []string{
+	metadataRoleName,
+	metadataDisplayName,
+	metadataExpiration,
+	metadataGrants,
+	metadataSchema,
+}
+
+// userMetadata is the non-secret context recorded when a user is created.
+type userMetadata map[string]string
+
+// userMetadataStore keeps the creation metadata of the users created by this
+// plugin instance so that later operations on the same user can reference
+// it. The store lives in memory only: users created before the plugin was
+// last initialized have no recorded metadata.
+type userMetadataStore struct {
+	sync.RWMutex
+	users map[string]userMetadata
+}
+
+func newUserMetadataStore() *userMetadataStore {
+	return &userMetadataStore{
+		users: make(map[string]userMetadata),
+	}
+}
+
+func (s *userMetadataStore) put(username string, md userMetadata) {
+	s.Lock()
+	defer s.Unlock()
+	s.users[username] = md
+}
+
+func (s *userMetadataStore) get(username string) (userMetadata, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	md, ok := s.users[username]
+	return md, ok
+}
+
+func (s *userMetadataStore) delete(username string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.users, username)
+}
+
+// unresolvedMetadataKey returns the first creation metadata key that any of
+// the statements still reference after rendering, which happens when no
+// metadata was recorded for the user.
+func unresolvedMetadataKey(queries []string) (string, bool) {
+	for _, query := range queries {
+		for _, key := range revocationMetadataKeys {
+			if strings.Contains(query, "{{"+key+"}}") {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestUserMetadataStore(t *testing.T) {
+	store := newUserMetadataStore()
+
+	if _, ok := store.get("v_test"); ok {
+		t.Fatalf("expected no metadata for unknown user")
+	}
+
+	store.put("v_test", userMetadata{metadataRoleName: "app"})
+	md, ok := store.get("v_test")
+	if !ok || md[metadataRoleName] != "app" {
+		t.Fatalf("expected recorded role name, got: %#v", md)
+	}
+
+	store.delete("v_test")
+	if _, ok := store.get("v_test"); ok {
+		t.Fatalf("expected metadata to be removed")
+	}
+}
+
+func TestUnresolvedMetadataKey(t *testing.T) {
+	type testCase struct {
+		queries  []string
+		expected string
+	}
+
+	tests := map[string]testCase{
+		"rendered": {
+			queries: []string{"DROP SCHEMA app_reader"},
+		},
+		"unrendered role name": {
+			queries:  []string{"DROP USER 'v_test'@'%'", "DROP SCHEMA app_{{role_name}}"},
+			expected: "role_name",
+		},
+		"unknown template key": {
+			queries: []string{"DROP SCHEMA {{other}}"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, ok := unresolvedMetadataKey(test.queries)
+			if key != test.expected || ok != (test.expected != "") {
+				t.Fatalf("expected unresolved key %q, got %q", test.expected, key)
+			}
+		})
+	}
+}
@@ -3,12 +3,23 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	stdmysql "github.com/go-sql-driver/mysql"
 	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
 	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 	"github.com/hashicorp/vault/sdk/database/helper/credsutil"
 	"github.com/hashicorp/vault/sdk/database/helper/dbutil"
@@ -17,17 +28,110 @@ import (
 
 const (
 	defaultMysqlRevocationStmts = `
-		REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'%'; 
-		DROP USER '{{name}}'@'%'
+		REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'{{host}}'; 
+		DROP USER '{{name}}'@'{{host}}'
 	`
 
 	defaultMySQLRotateCredentialsSQL = `
-		ALTER USER '{{username}}'@'%' IDENTIFIED BY '{{password}}';
+		ALTER USER '{{username}}'@'{{host}}' IDENTIFIED BY '{{password}}';
+	`
+
+	defaultMySQLSetPasswordSQL = `
+		SET PASSWORD FOR '{{username}}'@'{{host}}' = PASSWORD('{{password}}');
+	`
+
+	serverVersionSQL = "SELECT VERSION()"
+
+	lockAccountSQL = `
+		ALTER USER '{{name}}'@'{{host}}' ACCOUNT LOCK;
+	`
+
+	unlockAccountSQL = `
+		ALTER USER '{{name}}'@'{{host}}' ACCOUNT UNLOCK;
+	`
+
+	expirePasswordSQL = `
+		ALTER USER '{{username}}'@'{{host}}' PASSWORD EXPIRE;
+	`
+
+	revokePrivilegesSQL = "REVOKE ALL PRIVILEGES, GRANT OPTION FROM '%s'@'%s'"
+	showGrantsForSQL    = "SHOW GRANTS FOR '%s'@'%s'"
+
+	showWarningsSQL = "SHOW WARNINGS"
+
+	setSessionLabelSQL   = "SET @vault_action = ?"
+	resetSessionLabelSQL = "SET @vault_action = NULL"
+
+	disableAutocommitSQL = "SET autocommit = 0"
+	enableAutocommitSQL  = "SET autocommit = 1"
+	commitSQL            = "COMMIT"
+	rollbackSQL          = "ROLLBACK"
+
+	disableQueryLogSQL = "SET SESSION sql_log_off = 1"
+	restoreQueryLogSQL = "SET SESSION sql_log_off = DEFAULT"
+
+	userExistsSQL = `
+		SELECT COUNT(*) FROM mysql.user WHERE User = ?
+	`
+
+	// dropRoleSQL needs MySQL 8.0 or MariaDB 10.1.3
+	dropRoleSQL = "DROP ROLE IF EXISTS %s"
+
+	userProcesslistSQL = `
+		SELECT ID FROM INFORMATION_SCHEMA.PROCESSLIST WHERE USER = ?
 	`
 
 	mySQLTypeName = "mysql"
+
+	executionModeTransaction = "transaction"
+	executionModeAutocommit  = "autocommit"
+
+	revocationModeDrop = "drop"
+	revocationModeNoop = "noop"
+
+	pastExpirationReject = "reject"
+	pastExpirationClamp  = "clamp"
+
+	// minExpirationTTL is the TTL a past expiration is clamped to
+	minExpirationTTL = time.Minute
+
+	backoffJitterNone  = "none"
+	backoffJitterFull  = "full"
+	backoffJitterEqual = "equal"
+
+	replicationLagWarn = "warn"
+	replicationLagWait = "wait"
+	replicationLagFail = "fail"
+
+	rotationSyntaxAlterUser   = "alter_user"
+	rotationSyntaxSetPassword = "set_password"
+
+	usernameStyleLegacy = "legacy"
+	usernameStyleModern = "modern"
 )
 
+// maxUsernameRandomLength is the length of the random part credsutil
+// generates for usernames
+const maxUsernameRandomLength = 20
+
+// minGeneratedUsernameLen is the shortest generated part of a username that
+// is accepted, leaving at least 6 random characters after "v_"
+const minGeneratedUsernameLen = 8
+
+// reservedUsernameAttempts is how many usernames are generated before
+// NewUser gives up on avoiding reserved usernames
+const reservedUsernameAttempts = 3
+
+// defaultReservedUsernames are the system accounts of MySQL and MariaDB
+var defaultReservedUsernames = []string{
+	"root",
+	"mysql.sys",
+	"mysql.session",
+	"mysql.infoschema",
+	"mariadb.sys",
+	"debian-sys-maint",
+}
+
 var (
 	MetadataLen       int = 10
 	LegacyMetadataLen int = 4
@@ -35,11 +139,61 @@ var (
 	LegacyUsernameLen int = 16
 )
 
+// defaultFallbackRevocationErrorCodes are the server errors after which the
+// fallback revocation statements are attempted:
+// 1141: There is no such grant defined for user
+// 1147: There is no such grant defined for user on table
+// 1269: Can't revoke all privileges for one or more of the requested users
+// 1396: Operation failed for user
+var defaultFallbackRevocationErrorCodes = []int{1141, 1147, 1269, 1396}
+
+// duplicateGrantErrorCodes are the errors of a GRANT statement that
+// tolerate_duplicate_grants treats as the grant already existing:
+// 1062: Duplicate entry for key, raised by concurrent or repeated grants
+// writing the same grant table row
+var duplicateGrantErrorCodes = []int{1062}
+
 var _ dbplugin.Database = (*MySQL)(nil)
 
 type MySQL struct {
 	*mySQLConnectionProducer
-	legacy bool
+	legacy   bool
+	logger   log.Logger
+	metadata *userMetadataStore
+
+	// sweeperStopCh stops the expired user sweep, nil when it isn't running
+	sweeperStopCh chan struct{}
+	// userCounterStopCh stops the user count gauge, nil when it isn't running
+	userCounterStopCh chan struct{}
+	// poolValidatorStopCh stops the pool validator, nil when it isn't running
+	poolValidatorStopCh chan struct{}
+	// standbyStopCh stops the standby health checks, nil when they aren't
+	// running
+	standbyStopCh chan struct{}
+	// audit receives a JSON record per operation, nil when no
+	// audit_log_path is configured
+	audit *auditLog
+	// serverMaxUsernameLen is the longest username the server accepts as
+	// detected on Initialize, 0 when it couldn't be detected
+	serverMaxUsernameLen int
+	// detectedServerVersion is the server version detected on Initialize,
+	// empty when it couldn't be detected
+	detectedServerVersion string
+	// serverIdentity caches the {{server_id}} and {{server_uuid}} values
+	serverIdentity *serverIdentityCache
+	// capabilities caches the result of Capabilities
+	capabilities *capabilitiesCache
+	// clock is the server clock offset used with use_server_time
+	clock *serverClock
+	// health notifies the OnHealthTransition callbacks
+	health *healthWatchers
+	// prometheus holds the *prometheusMetrics once RegisterPrometheus was
+	// called, prometheusMu serializes the registration
+	prometheus   atomic.Value
+	prometheusMu sync.Mutex
+	// retries is the retry budget shared by all operations, nil when
+	// unlimited
+	retries *retryBudget
 }
 
 // New implements builtinplugins.BuiltinFactory
@@ -59,6 +213,12 @@ func new(legacy bool) *MySQL {
 	return &MySQL{
 		mySQLConnectionProducer: connProducer,
 		legacy:                  legacy,
+		logger:                  log.Default().Named(mySQLTypeName),
+		metadata:                newUserMetadataStore(),
+		serverIdentity:          newServerIdentityCache(),
+		capabilities:            &capabilitiesCache{},
+		clock:                   &serverClock{},
+		health:                  &healthWatchers{},
 	}
 }
 
@@ -66,11 +226,58 @@ func (m *MySQL) Type() (string, error) {
 	return mySQLTypeName, nil
 }
 
+// Close stops any background work and closes the connection
+func (m *MySQL) Close() error {
+	m.stopSweeper()
+	m.stopUserCounter()
+	m.stopPoolValidator()
+	m.stopStandbyMonitor()
+	m.closeAuditLog()
+	return m.mySQLConnectionProducer.Close()
+}
+
 func (m *MySQL) getConnection(ctx context.Context) (*sql.DB, error) {
 	db, err := m.Connection(ctx)
 	if err != nil {
+		return nil, connectionError(err)
+	}
+
+	return db.(*sql.DB), nil
+}
+
+// operationConnection returns the connection for a user operation. The
+// producer lock is only held while the pool is looked up or reopened, so
+// concurrent operations run their statements on connections of their own
+// rather than one after another.
+func (m *MySQL) operationConnection(ctx context.Context) (*sql.DB, error) {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
+		return nil, err
+	}
+	defer m.Unlock()
+
+	return m.getConnection(ctx)
+}
+
+// readOperationConnection returns the read connection for an operation,
+// holding the lock only while the pool is looked up.
+func (m *MySQL) readOperationConnection(ctx context.Context) (*sql.DB, error) {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
 		return nil, err
 	}
+	defer m.Unlock()
+
+	return m.getReadConnection(ctx)
+}
+
+// getReadConnection returns the connection used for read-only verification
+// queries, which is the replica when one is configured.
+func (m *MySQL) getReadConnection(ctx context.Context) (*sql.DB, error) {
+	db, err := m.ReadConnection(ctx)
+	if err != nil {
+		return nil, connectionError(err)
+	}
 
 	return db.(*sql.DB), nil
 }
@@ -80,47 +287,430 @@ func (m *MySQL) Initialize(ctx context.Context, req dbplugin.InitializeRequest)
 	if err != nil {
 		return dbplugin.InitializeResponse{}, err
 	}
+
+	m.closeAuditLog()
+	if m.AuditLogPath != "" {
+		m.audit, err = openAuditLog(m.AuditLogPath)
+		if err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+	}
+
+	m.retries = newRetryBudget(m.RetryBudgetPerMinute)
+	m.serverMaxUsernameLen = 0
+	m.detectedServerVersion = ""
+	m.serverIdentity.reset()
+	m.capabilities.reset()
+	m.clock.reset()
+	if req.VerifyConnection {
+		if err := m.detectMaxUsernameLen(ctx); err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+		if m.UseServerTime {
+			if _, err := m.serverClockOffset(ctx); err != nil {
+				m.logger.Warn("unable to read the server's clock", "error", err)
+			}
+		}
+	}
+
+	// Rotate last, so nothing can fail once the server has the new password
+	// but Vault hasn't saved it
+	config := req.Config
+	if m.RotateOnInit {
+		config, err = m.rotateOnInit(ctx, req)
+		if err != nil {
+			return dbplugin.InitializeResponse{}, err
+		}
+	}
+
+	// Start background work after rotating, since rotateOnInit replaces the pool
+	m.startSweeper()
+	m.startUserCounter()
+	m.startPoolValidator()
+	m.startStandbyMonitor()
+
 	resp := dbplugin.InitializeResponse{
-		Config: req.Config,
+		Config: config,
 	}
 	return resp, nil
 }
 
+// rotateOnInit replaces the connection user's bootstrap password with a
+// random one and re-initializes the producer with it. The returned config
+// holds the new password and has rotate_on_init cleared so the rotation is
+// not repeated when Vault re-initializes the plugin from the saved config.
+func (m *MySQL) rotateOnInit(ctx context.Context, req dbplugin.InitializeRequest) (map[string]interface{}, error) {
+	if !req.VerifyConnection {
+		return nil, fmt.Errorf("rotate_on_init requires verify_connection")
+	}
+	if m.Username == "" {
+		return nil, fmt.Errorf("rotate_on_init requires username to be set")
+	}
+	if connURL, _ := req.Config["connection_url"].(string); !strings.Contains(connURL, "{{password}}") {
+		return nil, fmt.Errorf("rotate_on_init requires connection_url to use the {{password}} template")
+	}
+
+	newPassword, err := credsutil.RandomAlphaNumeric(32, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate password: %w", err)
+	}
+
+	bootstrapPassword := m.Password
+	if err := m.changeUserPassword(ctx, m.Username, newPassword, nil); err != nil {
+		return nil, fmt.Errorf("failed to rotate connection password: %w", err)
+	}
+
+	config := make(map[string]interface{}, len(req.Config))
+	for k, v := range req.Config {
+		config[k] = v
+	}
+	config["password"] = newPassword
+	config["rotate_on_init"] = false
+
+	// Drop the pool opened with the bootstrap password before
+	// re-initializing. The audit log opened by Initialize stays open.
+	if err := m.mySQLConnectionProducer.Close(); err != nil {
+		return nil, err
+	}
+	if err := initializeProducer(ctx, m, config, true); err != nil {
+		err = errwrap.Wrapf("error verifying connection with rotated password: {{err}}", err)
+		return nil, m.restoreBootstrapPassword(ctx, req.Config, config, bootstrapPassword, err)
+	}
+
+	return config, nil
+}
+
+// restoreBootstrapPassword changes the connection user's password back
+// after the rotated one couldn't be verified. Vault only saves the config
+// when Initialize succeeds, so the rotated password would otherwise be
+// lost along with the root credential. The producer is left initialized
+// with the bootstrap config.
+func (m *MySQL) restoreBootstrapPassword(ctx context.Context, bootstrapConfig, rotatedConfig map[string]interface{}, bootstrapPassword string, verifyErr error) error {
+	err := initializeProducer(ctx, m, rotatedConfig, false)
+	if err == nil {
+		err = m.changeUserPassword(ctx, m.Username, bootstrapPassword, nil)
+	}
+	if closeErr := m.mySQLConnectionProducer.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = initializeProducer(ctx, m, bootstrapConfig, false)
+	}
+	if err != nil {
+		m.logger.Error("failed to restore the bootstrap password after rotate_on_init, the connection user's password must be reset on the server", "error", err)
+		return fmt.Errorf("%w; restoring the bootstrap password failed, reset the connection user's password on the server: %s", verifyErr, err)
+	}
+	return fmt.Errorf("%w; the bootstrap password was restored", verifyErr)
+}
+
+// initializeProducer initializes the connection producer with config. Tests
+// replace it, since the fake driver can't be reached through a connection
+// URL.
+var initializeProducer = func(ctx context.Context, m *MySQL, config map[string]interface{}, verifyConnection bool) error {
+	return m.mySQLConnectionProducer.Initialize(ctx, config, verifyConnection)
+}
+
 func (m *MySQL) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
+	start := time.Now()
+	ctx = withRole(m.withAnnotation(ctx, auditNewUser, req.UsernameConfig.RoleName), req.UsernameConfig.RoleName)
+	resp, err := m.newUser(ctx, req)
+	m.auditOperation(auditNewUser, start, resp.Username, req.UsernameConfig.RoleName, err)
+	m.metrics().observeOperation(auditNewUser, start, err)
+	return resp, err
+}
+
+func (m *MySQL) newUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
+	ctx, cancel := withStatementTimeout(ctx, m.creationStatementTimeout)
+	defer cancel()
+
 	if len(req.Statements.Commands) == 0 {
 		return dbplugin.NewUserResponse{}, dbutil.ErrEmptyCreationStatement
 	}
 
-	username, err := m.generateUsername(req)
+	expiration, err := m.checkExpiration(req.Expiration)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	req.Expiration = expiration
+
+	// Externally authenticated users have no password, the generated one is
+	// neither required nor rendered
+	authString, externalAuth := m.RoleExternalAuth[req.UsernameConfig.RoleName]
+
+	if req.Password == "" && !m.AllowEmptyPassword && !externalAuth {
+		return dbplugin.NewUserResponse{}, fmt.Errorf("password cannot be empty unless allow_empty_password is set")
+	}
+	if !externalAuth {
+		if err := m.checkPasswordCharacters(req.Password); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	username, err := m.uniqueUsername(ctx, req)
 	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
 
 	password := req.Password
 
-	expirationStr := req.Expiration.Format("2006-01-02 15:04:05-0700")
+	// The expiration is rendered in the server's clock, the TTL is relative
+	serverExpiration := m.serverTime(ctx, req.Expiration)
+	expirationStr := serverExpiration.Format("2006-01-02 15:04:05-0700")
 
-	queryMap := map[string]string{
-		"name":       username,
-		"username":   username,
-		"password":   password,
-		"expiration": expirationStr,
+	var queryMap map[string]string
+	if externalAuth {
+		password = ""
+		queryMap = map[string]string{"auth_string": escapeString(authString)}
+	} else {
+		queryMap = passwordTemplateValues(password)
+	}
+	queryMap["name"] = username
+	queryMap["username"] = username
+	queryMap["expiration"] = expirationStr
+	queryMap["ttl_seconds"] = ttlSeconds(req.Expiration)
+
+	host := m.userHost(req.UsernameConfig.RoleName)
+	queryMap[metadataHost] = host
+	schema := m.defaultSchema(req.UsernameConfig.RoleName)
+	queryMap[metadataSchema] = schema
+
+	// The post creation statements are checked and rendered along with the
+	// creation statements
+	postStatements := m.postCreationStatements(req.UsernameConfig.RoleName)
+	commands := append(req.Statements.Commands[:len(req.Statements.Commands):len(req.Statements.Commands)], postStatements...)
+
+	identity, err := m.serverIdentityValues(ctx, commands)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	for k, v := range identity {
+		queryMap[k] = v
+	}
+
+	requireTLS := m.RequireTLS
+	if value, ok := m.RoleRequireTLS[req.UsernameConfig.RoleName]; ok {
+		requireTLS = value
+	}
+	queryMap["require_tls"], err = requireTLSClause(requireTLS)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	lifetimeDays := m.PasswordLifetimeDays
+	if days, ok := m.RolePasswordLifetimeDays[req.UsernameConfig.RoleName]; ok {
+		lifetimeDays = days
+	}
+	queryMap["password_lifetime"], err = passwordLifetimeClause(lifetimeDays)
+	if err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	if lifetimeDays > 0 {
+		if err := m.checkPasswordLifetimeSupport(ctx); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+	}
+
+	if found := broadGrants(commands, queryMap); len(found) > 0 {
+		sort.Strings(found)
+		if m.StrictLeastPrivilege {
+			return dbplugin.NewUserResponse{}, fmt.Errorf("creation statements are not least privilege: %s", strings.Join(found, ", "))
+		}
+		m.logger.Warn("creation statements are not least privilege", "role", req.UsernameConfig.RoleName, "findings", found)
+	}
+
+	if err := checkStatementVerbs(renderQueries(commands, queryMap), m.AllowedStatementVerbs); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+	if err := checkGrantSchemas(renderQueries(commands, queryMap), m.SchemaAllowList); err != nil {
+		return dbplugin.NewUserResponse{}, err
+	}
+
+	statements := commands
+	if m.SplitPostCreation {
+		statements = req.Statements.Commands
+	}
+
+	createLocked := m.CreateLocked
+	if locked, ok := m.RoleCreateLocked[req.UsernameConfig.RoleName]; ok {
+		createLocked = locked
+	}
+	if createLocked {
+		if err := m.checkAccountLockSupport(ctx); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+		statements = append(statements[:len(statements):len(statements)], lockAccountSQL)
+	}
+
+	if m.expiredUserSweepInterval > 0 {
+		queryMap["expiration_unix"] = expirationUnix(serverExpiration)
+		statements = append(statements[:len(statements):len(statements)], recordExpirationSQL)
+	}
+
+	if m.ServerSideTTLEvents {
+		if err := m.checkTTLEventSupport(ctx); err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+		queryMap["ttl_event"] = ttlEventName(m.ServerSideTTLEventSchema, username)
+		queryMap["expiration_unix"] = expirationUnix(serverExpiration)
+		statements = append(statements[:len(statements):len(statements)], createTTLEventSQL)
+	}
+
+	// Capture the results of the role's final creation statement, which
+	// comes before any statements added by the plugin
+	captureIndex := -1
+	if m.CaptureCreationResults {
+		captureIndex = len(renderQueries(req.Statements.Commands, queryMap)) - 1
 	}
 
-	if err := m.executePreparedStatementsWithMap(ctx, req.Statements.Commands, queryMap); err != nil {
+	lag, err := m.checkReplicationLag(ctx)
+	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
 
+	results, err := m.executeStatements(ctx, statements, queryMap, captureIndex, m.CreationSessionLabel)
+	if err != nil {
+		err = m.resolveAmbiguousCommit(ctx, username, err)
+	}
+	if err != nil {
+		return dbplugin.NewUserResponse{}, redactPasswords(err, password)
+	}
+
+	if m.SplitPostCreation && len(postStatements) > 0 {
+		if _, err := m.executeStatements(ctx, postStatements, queryMap, -1, m.CreationSessionLabel); err != nil {
+			return dbplugin.NewUserResponse{}, redactPasswords(fmt.Errorf("failed to run post creation statements: %w", err), password)
+		}
+	}
+
+	md := userMetadata{}
+	for k, v := range results {
+		md[k] = v
+	}
+	md[metadataRoleName] = req.UsernameConfig.RoleName
+	md[metadataDisplayName] = req.UsernameConfig.DisplayName
+	md[metadataExpiration] = expirationStr
+	md[metadataHost] = host
+	if schema != "" {
+		md[metadataSchema] = schema
+	}
+	if m.RecordGrants {
+		md[metadataGrants] = grantSummary(renderQueries(commands, queryMap))
+	}
+	if m.DropUserRole {
+		if roles := userRoles(renderQueries(commands, queryMap), username); roles != "" {
+			md[metadataUserRoles] = roles
+		}
+	}
+	md[metadataCreatedAt] = time.Now().UTC().Format(time.RFC3339)
+	if addr := m.serverAddress(); addr != "" {
+		md[metadataServerAddress] = addr
+	}
+	if m.detectedServerVersion != "" {
+		md[metadataServerVersion] = m.detectedServerVersion
+	}
+	if lag > 0 {
+		md[metadataReplicationLag] = lag.String()
+	}
+	m.metadata.put(username, md)
+
+	// The user already exists at this point, so a canceled context only cuts
+	// the delay short. Returning an error would leave a user Vault never
+	// revokes.
+	if m.creationDelay > 0 {
+		timer := time.NewTimer(m.creationDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
 	resp := dbplugin.NewUserResponse{
 		Username: username,
 	}
 	return resp, nil
 }
 
+// uniqueUsername generates a username for the request. With
+// check_username_uniqueness set, names that already exist in mysql.user are
+// regenerated up to username_uniqueness_attempts times.
+func (m *MySQL) uniqueUsername(ctx context.Context, req dbplugin.NewUserRequest) (string, error) {
+	if !m.CheckUsernameUniqueness {
+		return m.generateUsername(req)
+	}
+
+	db, err := m.operationConnection(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 0; attempt < m.UsernameUniquenessAttempts; attempt++ {
+		username, err := m.generateUsername(req)
+		if err != nil {
+			return "", err
+		}
+
+		var count int
+		if err := db.QueryRowContext(ctx, userExistsSQL, username).Scan(&count); err != nil {
+			return "", fmt.Errorf("failed to check username uniqueness: %w", err)
+		}
+		if count == 0 {
+			return username, nil
+		}
+		if attempt+1 < m.UsernameUniquenessAttempts && !m.retries.take() {
+			return "", fmt.Errorf("%w, not regenerating username %q that already exists", ErrRetryBudgetExhausted, username)
+		}
+		m.metrics().retry(retryUsernameRegeneration)
+		m.logger.Debug("generated username already exists, regenerating", "username", username)
+	}
+
+	return "", fmt.Errorf("all %d generated usernames already exist, increase username_random_length or username_uniqueness_attempts", m.UsernameUniquenessAttempts)
+}
+
+// generateUsername generates a username for req that isn't reserved.
 func (m *MySQL) generateUsername(req dbplugin.NewUserRequest) (string, error) {
+	var username string
+	for attempt := 0; attempt < reservedUsernameAttempts; attempt++ {
+		var err error
+		username, err = m.formatUsername(req)
+		if err != nil {
+			return "", err
+		}
+		if !m.isReservedUsername(username) {
+			return username, nil
+		}
+		m.logger.Warn("generated username is reserved, regenerating", "username", username)
+	}
+	return "", fmt.Errorf("generated username %q is reserved, change the display name, role name or username_prefix", username)
+}
+
+// isReservedUsername reports whether username is one of the
+// reserved_usernames or the connection username, ignoring case.
+func (m *MySQL) isReservedUsername(username string) bool {
+	if m.Username != "" && strings.EqualFold(username, m.Username) {
+		return true
+	}
+	reserved := m.ReservedUsernames
+	if len(reserved) == 0 {
+		reserved = defaultReservedUsernames
+	}
+	for _, name := range reserved {
+		if strings.EqualFold(username, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatUsername formats a new username from the display and role names.
+func (m *MySQL) formatUsername(req dbplugin.NewUserRequest) (string, error) {
 	var dispNameLen, roleNameLen, maxLen int
 
-	if m.legacy {
+	legacy := m.legacy
+	if style, ok := m.RoleUsernameStyles[req.UsernameConfig.RoleName]; ok {
+		legacy = style == usernameStyleLegacy
+	}
+
+	if legacy {
 		dispNameLen = LegacyUsernameLen
 		roleNameLen = LegacyMetadataLen
 		maxLen = LegacyUsernameLen
@@ -130,79 +720,390 @@ func (m *MySQL) generateUsername(req dbplugin.NewUserRequest) (string, error) {
 		maxLen = UsernameLen
 	}
 
+	// Never generate names longer than the server accepts
+	if m.serverMaxUsernameLen > 0 && m.serverMaxUsernameLen < maxLen {
+		maxLen = m.serverMaxUsernameLen
+	}
+
+	// Reserve room for the prefix and suffix so only the variable part of
+	// the username is truncated
+	affixLen := len(m.UsernamePrefix) + len(m.UsernameSuffix)
+	if affixLen >= maxLen {
+		return "", fmt.Errorf("username_prefix and username_suffix must be shorter than %d characters combined", maxLen)
+	}
+	maxLen -= affixLen
+
+	displayName := req.UsernameConfig.DisplayName
+	roleName := req.UsernameConfig.RoleName
+	if m.UsernameRandomLength > 0 {
+		// The random part follows "v_" and the names with their separators
+		budget := maxLen - len("v_") - m.UsernameRandomLength
+		if budget < 0 {
+			return "", fmt.Errorf("username_random_length of %d does not fit in usernames of %d characters", m.UsernameRandomLength, maxLen)
+		}
+		dispLen, roleLen := fitNames(minInt(dispNameLen, len(displayName)), minInt(roleNameLen, len(roleName)), budget)
+		displayName, roleName = displayName[:dispLen], roleName[:roleLen]
+		dispNameLen, roleNameLen = dispLen, roleLen
+	}
+
 	username, err := credsutil.GenerateUsername(
-		credsutil.DisplayName(req.UsernameConfig.DisplayName, dispNameLen),
-		credsutil.RoleName(req.UsernameConfig.RoleName, roleNameLen),
+		credsutil.DisplayName(displayName, dispNameLen),
+		credsutil.RoleName(roleName, roleNameLen),
 		credsutil.MaxLength(maxLen),
 	)
 	if err != nil {
 		return "", errwrap.Wrapf("error generating username: {{err}}", err)
 	}
+	if len(username) < minGeneratedUsernameLen {
+		return "", fmt.Errorf("generated username %q is shorter than %d characters, shorten username_prefix or username_suffix", username, minGeneratedUsernameLen)
+	}
+
+	return m.UsernamePrefix + username + m.UsernameSuffix, nil
+}
+
+// ttlSeconds returns the whole seconds left until expiration for the
+// {{ttl_seconds}} template value, or 0 if it has already passed.
+func ttlSeconds(expiration time.Time) string {
+	ttl := int64(time.Until(expiration) / time.Second)
+	if ttl < 0 {
+		ttl = 0
+	}
+	return strconv.FormatInt(ttl, 10)
+}
+
+// checkExpiration applies the past_expiration policy to an expiration that
+// has already passed: it is rejected, or clamped to minExpirationTTL from
+// now. A zero expiration is returned unchanged.
+func (m *MySQL) checkExpiration(expiration time.Time) (time.Time, error) {
+	if expiration.IsZero() || expiration.After(time.Now()) {
+		return expiration, nil
+	}
+	if m.PastExpiration == pastExpirationClamp {
+		m.logger.Warn("expiration has already passed, clamping it", "expiration", expiration, "ttl", minExpirationTTL)
+		return time.Now().Add(minExpirationTTL), nil
+	}
+	return time.Time{}, fmt.Errorf("expiration %s has already passed", expiration.Format(time.RFC3339))
+}
+
+// fitNames shortens the display and role name lengths, the longer one
+// first, until both names and their separators fit in budget characters. A
+// name shortened to nothing is left out along with its separator.
+func fitNames(dispLen, roleLen, budget int) (int, int) {
+	cost := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return n + 1
+	}
+
+	for cost(dispLen)+cost(roleLen) > budget {
+		if dispLen >= roleLen {
+			dispLen--
+		} else {
+			roleLen--
+		}
+	}
+	return dispLen, roleLen
+}
 
-	return username, nil
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
 
+// DeleteUser revokes the given user. Depending on the configuration it first
+// revokes the user's privileges and then kills its sessions, before running
+// the revocation statements that drop the user. Besides {{name}} and
+// {{username}}, the revocation statements may reference {{role_name}},
+// {{display_name}} and {{expiration}}, which are taken from the metadata
+// recorded when this plugin instance created the user.
 func (m *MySQL) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
-	// Grab the read lock
-	m.Lock()
-	defer m.Unlock()
+	start := time.Now()
+	md, _ := m.metadata.get(req.Username)
+	ctx = withRole(m.withAnnotation(ctx, auditDeleteUser, md[metadataRoleName]), md[metadataRoleName])
+	resp, err := m.deleteUser(ctx, req)
+	m.auditOperation(auditDeleteUser, start, req.Username, md[metadataRoleName], err)
+	m.metrics().observeOperation(auditDeleteUser, start, err)
+	return resp, err
+}
+
+func (m *MySQL) deleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
+	if m.RevocationMode == revocationModeNoop {
+		m.logger.Info("revocation_mode is noop, user was not revoked on the server", "username", req.Username)
+		m.metadata.delete(req.Username)
+		return dbplugin.DeleteUserResponse{}, nil
+	}
+
+	ctx, cancel := withStatementTimeout(ctx, m.revocationStatementTimeout)
+	defer cancel()
 
 	// Get the connection
-	db, err := m.getConnection(ctx)
+	db, err := m.operationConnection(ctx)
 	if err != nil {
 		return dbplugin.DeleteUserResponse{}, err
 	}
 
+	queryMap := map[string]string{}
+	if md, ok := m.metadata.get(req.Username); ok {
+		for k, v := range md {
+			queryMap[k] = v
+		}
+	}
+	queryMap["name"] = req.Username
+	queryMap["username"] = req.Username
+	// Users created before the plugin was last initialized have no recorded
+	// host, so assume the configured one
+	if _, ok := queryMap[metadataHost]; !ok {
+		queryMap[metadataHost] = m.userHost("")
+	}
+
 	revocationStmts := req.Statements.Commands
 	// Use a default SQL statement for revocation if one cannot be fetched from the role
 	if len(revocationStmts) == 0 {
 		revocationStmts = []string{defaultMysqlRevocationStmts}
+		queryMap = escapeTemplateValues(queryMap)
 	}
 
-	// Start a transaction
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
+	revocationStmts = expandRevokeGrants(revocationStmts, queryMap)
+
+	// The event would otherwise still fire after the user was revoked
+	if err := m.dropTTLEvent(ctx, db, req.Username); err != nil {
 		return dbplugin.DeleteUserResponse{}, err
 	}
-	defer tx.Rollback()
 
-	for _, stmt := range revocationStmts {
-		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
-			query = strings.TrimSpace(query)
-			if len(query) == 0 {
-				continue
-			}
+	if err := m.revokePrivileges(ctx, db, req.Username, queryMap[metadataHost]); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
 
-			// This is not a prepared statement because not all commands are supported
-			// 1295: This command is not supported in the prepared statement protocol yet
-			// Reference https://mariadb.com/kb/en/mariadb/prepare-statement/
-			query = strings.Replace(query, "{{name}}", req.Username, -1)
-			query = strings.Replace(query, "{{username}}", req.Username, -1)
-			_, err = tx.ExecContext(ctx, query)
-			if err != nil {
-				return dbplugin.DeleteUserResponse{}, err
-			}
+	if m.RevocationKillConnections {
+		if err := m.killSessions(ctx, db, req.Username); err != nil {
+			return dbplugin.DeleteUserResponse{}, fmt.Errorf("failed to disconnect existing sessions: %w", err)
 		}
 	}
 
-	// Commit the transaction
-	err = tx.Commit()
-	return dbplugin.DeleteUserResponse{}, err
-}
+	err = m.revokeUser(ctx, db, revocationStmts, queryMap)
+	if err != nil && len(m.FallbackRevocationStatements) > 0 && m.isFallbackRevocationError(err) {
+		if !m.retries.take() {
+			return dbplugin.DeleteUserResponse{}, fmt.Errorf("%w, not running fallback revocation statements: %s", ErrRetryBudgetExhausted, err)
+		}
+		m.metrics().retry(retryFallbackRevocation)
+		m.logger.Warn("revocation statements failed, running fallback revocation statements", "username", req.Username, "error", err)
+		if err := m.revokeUser(ctx, db, m.FallbackRevocationStatements, queryMap); err != nil {
+			return dbplugin.DeleteUserResponse{}, err
+		}
+		m.logger.Info("user revoked with fallback revocation statements", "username", req.Username)
+	} else if err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	} else {
+		m.logger.Debug("user revoked with revocation statements", "username", req.Username)
+	}
 
-func (m *MySQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+	if err := m.verifyRevocation(ctx, db, req.Username); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+
+	md, _ := m.metadata.get(req.Username)
+	if err := m.dropUserRoles(ctx, db, req.Username, md[metadataUserRoles]); err != nil {
+		return dbplugin.DeleteUserResponse{}, err
+	}
+
+	m.metadata.delete(req.Username)
+	return dbplugin.DeleteUserResponse{}, nil
+}
+
+// dropUserRoles drops the roles created alongside the user when
+// drop_user_role is set. roles is the recorded metadataUserRoles value,
+// users without one had no role created for them or were created before
+// the plugin was last initialized. Roles that were already dropped are
+// skipped.
+func (m *MySQL) dropUserRoles(ctx context.Context, db *sql.DB, username, roles string) error {
+	if !m.DropUserRole {
+		return nil
+	}
+	if roles == "" {
+		m.logger.Debug("no role recorded for user, not dropping any", "username", username)
+		return nil
+	}
+
+	for _, role := range strings.Split(roles, ";") {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(dropRoleSQL, role)); err != nil {
+			return fmt.Errorf("failed to drop role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// verifyRevocation returns an error if verify_revocation is set and the user
+// still exists after the revocation statements ran. If the connection user
+// can't read mysql.user, the check is skipped with a warning.
+func (m *MySQL) verifyRevocation(ctx context.Context, db *sql.DB, username string) error {
+	if !m.VerifyRevocation {
+		return nil
+	}
+
+	var count int
+	err := db.QueryRowContext(ctx, userExistsSQL, username).Scan(&count)
+	if isAccessDeniedError(err) {
+		m.logger.Warn("unable to verify revocation, mysql.user is not readable", "username", username, "error", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify revocation: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("user %q still exists after revocation", username)
+	}
+	return nil
+}
+
+// isAccessDeniedError reports whether err is a privilege error:
+// 1044: Access denied for user to database
+// 1142: Command denied to user for table
+// 1227: Access denied, a privilege like SUPER is needed for the operation
+func isAccessDeniedError(err error) bool {
+	var mysqlErr *stdmysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1044 || mysqlErr.Number == 1142 || mysqlErr.Number == 1227
+}
+
+// revokePrivileges revokes every privilege of the user if
+// revocation_revoke_privileges is set, or each grant SHOW GRANTS lists for
+// the user if dynamic_revocation is. Errors the fallback revocation
+// statements would handle, like an already dropped user, are left for the
+// revocation statements to run into.
+func (m *MySQL) revokePrivileges(ctx context.Context, db *sql.DB, username, host string) error {
+	if !m.RevocationRevokePrivileges && !m.DynamicRevocation {
+		return nil
+	}
+
+	queries := []string{fmt.Sprintf(revokePrivilegesSQL, escapeString(username), escapeString(host))}
+	if m.DynamicRevocation {
+		grants, err := showGrants(ctx, db, username, host)
+		switch {
+		case err != nil && m.isFallbackRevocationError(err):
+			m.logger.Debug("failed to read grants before revocation statements", "username", username, "error", err)
+			return nil
+		case err != nil:
+			m.logger.Warn("failed to read grants, revoking all privileges", "username", username, "error", err)
+		default:
+			account := fmt.Sprintf("'%s'@'%s'", escapeString(username), escapeString(host))
+			revokes, unrecognized := revokeStatements(grants, account)
+			if unrecognized > 0 {
+				m.logger.Warn("grants not recognized, revoking all privileges as well", "username", username, "unrecognized", unrecognized)
+				revokes = append(revokes, queries...)
+			}
+			queries = revokes
+		}
+	}
+
+	for _, query := range queries {
+		_, err := db.ExecContext(ctx, query)
+		if err != nil && m.isFallbackRevocationError(err) {
+			m.logger.Debug("failed to revoke privileges before revocation statements", "username", username, "error", err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revoke privileges: %w", err)
+		}
+	}
+	return nil
+}
+
+// showGrants returns the grant lines reported by SHOW GRANTS for the user
+// at host. SHOW GRANTS does not accept placeholders, so the account is
+// quoted.
+func showGrants(ctx context.Context, db *sql.DB, username, host string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(showGrantsForSQL, escapeString(username), escapeString(host)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// revokeUser renders the given revocation statements with queryMap and runs
+// them according to the execution mode.
+func (m *MySQL) revokeUser(ctx context.Context, db *sql.DB, revocationStmts []string, queryMap map[string]string) error {
+	queries := renderQueries(revocationStmts, queryMap)
+
+	// Metadata is only recorded in memory, so revoke users created before
+	// the plugin was last initialized with the default statements rather
+	// than leaving them unrevocable
+	if key, ok := unresolvedMetadataKey(queries); ok {
+		m.logger.Warn("revocation statements reference creation metadata that isn't recorded for the user, using the default revocation statements", "username", queryMap["username"], "key", key)
+		queries = renderQueries([]string{defaultMysqlRevocationStmts}, escapeTemplateValues(queryMap))
+	}
+	if err := checkStatementVerbs(queries, m.AllowedStatementVerbs); err != nil {
+		return err
+	}
+
+	return m.runQueries(ctx, db, queries, m.RevocationSessionLabel, withAnnotations(executeUnprepared))
+}
+
+// isFallbackRevocationError reports whether err is one of the configured
+// server errors that allow the fallback revocation statements to run.
+func (m *MySQL) isFallbackRevocationError(err error) bool {
+	var mysqlErr *stdmysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	for _, code := range m.FallbackRevocationErrorCodes {
+		if int(mysqlErr.Number) == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MySQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+	start := time.Now()
+	md, _ := m.metadata.get(req.Username)
+	ctx = withRole(m.withAnnotation(ctx, auditUpdateUser, md[metadataRoleName]), md[metadataRoleName])
+	resp, err := m.updateUser(ctx, req)
+	m.auditOperation(auditUpdateUser, start, req.Username, md[metadataRoleName], err)
+	m.metrics().observeOperation(auditUpdateUser, start, err)
+	return resp, err
+}
+
+func (m *MySQL) updateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
 	if req.Password == nil && req.Expiration == nil {
 		return dbplugin.UpdateUserResponse{}, fmt.Errorf("no change requested")
 	}
 
 	if req.Password != nil {
+		ctx, cancel := withStatementTimeout(ctx, m.rotationStatementTimeout)
+		defer cancel()
+
 		err := m.changeUserPassword(ctx, req.Username, req.Password.NewPassword, req.Password.Statements.Commands)
 		if err != nil {
 			return dbplugin.UpdateUserResponse{}, fmt.Errorf("failed to change password: %w", err)
 		}
 	}
 
-	// Expiration change/update is currently a no-op
+	// Expiration changes only reschedule the server_side_ttl_events event
+	if req.Expiration != nil {
+		if err := m.rescheduleTTLEvent(ctx, req.Username, req.Expiration.NewExpiration); err != nil {
+			return dbplugin.UpdateUserResponse{}, fmt.Errorf("failed to change expiration: %w", err)
+		}
+	}
 
 	return dbplugin.UpdateUserResponse{}, nil
 }
@@ -211,20 +1112,381 @@ func (m *MySQL) changeUserPassword(ctx context.Context, username, password strin
 	if username == "" || password == "" {
 		return errors.New("must provide both username and password")
 	}
+	if err := m.checkPasswordCharacters(password); err != nil {
+		return err
+	}
 
-	if len(rotateStatements) == 0 {
-		rotateStatements = []string{defaultMySQLRotateCredentialsSQL}
+	queryMap := passwordTemplateValues(password)
+	queryMap["name"] = username
+	queryMap["username"] = username
+	queryMap[metadataHost] = m.accountHost(username)
+
+	if m.SuppressQueryLog {
+		ctx = withQueryLogSuppressed(ctx)
 	}
 
-	queryMap := map[string]string{
-		"name":     username,
-		"username": username,
-		"password": password,
+	if len(rotateStatements) == 0 {
+		stmt, err := m.defaultRotationStatement(ctx)
+		if err != nil {
+			return err
+		}
+		rotateStatements = []string{stmt}
+		queryMap = escapeTemplateValues(queryMap)
 	}
 
 	if err := m.executePreparedStatementsWithMap(ctx, rotateStatements, queryMap); err != nil {
+		return redactPasswords(err, password)
+	}
+
+	if m.PasswordChangeDisconnect {
+		if err := m.killUserConnections(ctx, username); err != nil {
+			return fmt.Errorf("password changed but failed to disconnect existing sessions: %w", err)
+		}
+	}
+	return nil
+}
+
+// defaultRotationStatement returns the rotation statement for the configured
+// rotation_syntax, or for the server's version when none is configured.
+func (m *MySQL) defaultRotationStatement(ctx context.Context) (string, error) {
+	switch m.RotationSyntax {
+	case rotationSyntaxAlterUser:
+		return defaultMySQLRotateCredentialsSQL, nil
+	case rotationSyntaxSetPassword:
+		return defaultMySQLSetPasswordSQL, nil
+	}
+
+	version, err := m.serverVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect server version for rotation_syntax: %w", err)
+	}
+	if !supportsAlterUser(version) {
+		return defaultMySQLSetPasswordSQL, nil
+	}
+	return defaultMySQLRotateCredentialsSQL, nil
+}
+
+// serverVersion returns the version reported by the server.
+func (m *MySQL) serverVersion(ctx context.Context) (string, error) {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
+		return "", err
+	}
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var version string
+	if err := db.QueryRowContext(ctx, serverVersionSQL).Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// detectMaxUsernameLen stores the server version and the longest username
+// the server accepts. The UsernameLen and LegacyUsernameLen defaults are
+// used if it can't be detected. As the first statement run on Initialize,
+// it only fails if the connection user's password has expired, which a
+// ping doesn't detect.
+func (m *MySQL) detectMaxUsernameLen(ctx context.Context) error {
+	version, err := m.serverVersion(ctx)
+	if err != nil {
+		if connectionError(err) == ErrConnectionPasswordExpired {
+			return ErrConnectionPasswordExpired
+		}
+		m.logger.Debug("failed to detect the maximum username length", "error", err)
+		return nil
+	}
+	m.detectedServerVersion = version
+	m.serverMaxUsernameLen = maxUsernameLength(version)
+	return nil
+}
+
+// maxUsernameLength returns the longest username a server of the given
+// version accepts. MySQL allows 32 characters since 5.7.8 and 16 before,
+// MariaDB allows 80.
+func maxUsernameLength(version string) int {
+	switch {
+	case strings.Contains(strings.ToLower(version), "mariadb"):
+		return 80
+	case versionAtLeast(version, []int{5, 7, 8}, nil):
+		return 32
+	default:
+		return 16
+	}
+}
+
+// supportsAlterUser reports whether a server of the given version can change
+// passwords with ALTER USER, which MySQL supports since 5.7.6 and MariaDB
+// since 10.2.
+func supportsAlterUser(version string) bool {
+	return versionAtLeast(version, []int{5, 7, 6}, []int{10, 2, 0})
+}
+
+// supportsAccountLock reports whether a server of the given version supports
+// ACCOUNT LOCK, which MySQL does since 5.7.6 and MariaDB since 10.4.2.
+func supportsAccountLock(version string) bool {
+	return versionAtLeast(version, []int{5, 7, 6}, []int{10, 4, 2})
+}
+
+// supportsPasswordLifetime reports whether a server of the given version
+// accepts PASSWORD EXPIRE INTERVAL in CREATE USER, which MySQL does since
+// 5.7.6 and MariaDB since 10.4.3.
+func supportsPasswordLifetime(version string) bool {
+	return versionAtLeast(version, []int{5, 7, 6}, []int{10, 4, 3})
+}
+
+// versionAtLeast compares a server version against the MySQL or MariaDB
+// minimum. Versions that can't be parsed are assumed to be recent enough.
+func versionAtLeast(version string, mysqlMin, mariaDBMin []int) bool {
+	minimum := mysqlMin
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		minimum = mariaDBMin
+	}
+
+	parts := strings.Split(strings.SplitN(version, "-", 2)[0], ".")
+	for i, min := range minimum {
+		if i >= len(parts) {
+			return true
+		}
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return true
+		}
+		if n != min {
+			return n > min
+		}
+	}
+	return true
+}
+
+// UnlockUser unlocks an account created locked by create_locked once its
+// downstream setup has completed.
+func (m *MySQL) UnlockUser(ctx context.Context, username string) error {
+	if username == "" {
+		return errors.New("must provide a username")
+	}
+	if err := m.checkAccountLockSupport(ctx); err != nil {
 		return err
 	}
+
+	queryMap := escapeTemplateValues(map[string]string{
+		"name":       username,
+		"username":   username,
+		metadataHost: m.accountHost(username),
+	})
+
+	if err := m.executePreparedStatementsWithMap(ctx, []string{unlockAccountSQL}, queryMap); err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return nil
+}
+
+// checkAccountLockSupport returns an error if the server doesn't support
+// locking accounts.
+func (m *MySQL) checkAccountLockSupport(ctx context.Context) error {
+	version, err := m.serverVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to detect server version for account locking: %w", err)
+	}
+	if !supportsAccountLock(version) {
+		return fmt.Errorf("server version %s does not support account locking", version)
+	}
+	return nil
+}
+
+// checkPasswordLifetimeSupport returns an error if the server can't create
+// users with a password lifetime.
+func (m *MySQL) checkPasswordLifetimeSupport(ctx context.Context) error {
+	version, err := m.serverVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to detect server version for password lifetimes: %w", err)
+	}
+	if !supportsPasswordLifetime(version) {
+		return fmt.Errorf("server version %s does not support password lifetimes", version)
+	}
+	return nil
+}
+
+// ExpirePassword marks the user's password as expired, so new sessions
+// can't be used until the password is reset. Existing sessions are left
+// open. Requires allow_expire_password.
+func (m *MySQL) ExpirePassword(ctx context.Context, username string) error {
+	if !m.AllowExpirePassword {
+		return fmt.Errorf("expiring passwords requires allow_expire_password")
+	}
+	if username == "" {
+		return errors.New("must provide a username")
+	}
+
+	queryMap := escapeTemplateValues(map[string]string{
+		"name":       username,
+		"username":   username,
+		metadataHost: m.accountHost(username),
+	})
+
+	if err := m.executePreparedStatementsWithMap(ctx, []string{expirePasswordSQL}, queryMap); err != nil {
+		return fmt.Errorf("failed to expire password: %w", err)
+	}
+	return nil
+}
+
+// accountHost returns the host part of username's account: the host
+// recorded when the user was created, else the user_host of its role. The
+// connection user isn't a dynamic user and is assumed to be at '%'.
+func (m *MySQL) accountHost(username string) string {
+	if m.Username != "" && username == m.Username {
+		return "%"
+	}
+	md, _ := m.metadata.get(username)
+	if host, ok := md[metadataHost]; ok {
+		return host
+	}
+	return m.userHost(md[metadataRoleName])
+}
+
+// UserMetadata returns the metadata recorded when this plugin instance
+// created the given user, including any values captured from the creation
+// statements' results. The second return value is false if nothing is
+// recorded for the user.
+func (m *MySQL) UserMetadata(username string) (map[string]string, bool) {
+	md, ok := m.metadata.get(username)
+	if !ok {
+		return nil, false
+	}
+
+	result := make(map[string]string, len(md))
+	for k, v := range md {
+		result[k] = v
+	}
+	return result, true
+}
+
+// UserGrants returns the grant lines reported by SHOW GRANTS for the given
+// user. The query runs on the read connection.
+func (m *MySQL) UserGrants(ctx context.Context, username string) ([]string, error) {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
+		return nil, err
+	}
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getReadConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return showGrants(ctx, db, username, m.accountHost(username))
+}
+
+// passwordTemplateValues returns the statement template values for a
+// password: the plaintext as {{password}}, the encoded variants some
+// authentication plugins expect as {{password_base64}} and {{password_hex}},
+// and {{password_escaped}} with quotes and backslashes escaped for use in a
+// single quoted string literal. The escaping assumes the default sql_mode,
+// without NO_BACKSLASH_ESCAPES.
+func passwordTemplateValues(password string) map[string]string {
+	return map[string]string{
+		"password":         password,
+		"password_base64":  base64.StdEncoding.EncodeToString([]byte(password)),
+		"password_hex":     hex.EncodeToString([]byte(password)),
+		"password_escaped": escapeString(password),
+	}
+}
+
+// redactPasswords removes the password and its encoded variants from the
+// error message, since server errors may quote the failing statement.
+func redactPasswords(err error, password string) error {
+	if err == nil || password == "" {
+		return err
+	}
+
+	msg := err.Error()
+	redacted := strings.Replace(msg, escapeString(password), "[password]", -1)
+	for _, value := range passwordTemplateValues(password) {
+		redacted = strings.Replace(redacted, value, "[password]", -1)
+	}
+	if redacted == msg {
+		return err
+	}
+	return errors.New(redacted)
+}
+
+// escapeTemplateValues returns a copy of queryMap with every value escaped
+// for use inside a single quoted string literal. MySQL doesn't accept
+// placeholders for account names and passwords, so the default statements
+// are rendered with escaped values instead of bound ones. Role supplied
+// statements keep the raw values they have always been rendered with.
+func escapeTemplateValues(queryMap map[string]string) map[string]string {
+	escaped := make(map[string]string, len(queryMap))
+	for k, v := range queryMap {
+		escaped[k] = escapeString(v)
+	}
+	return escaped
+}
+
+// escapeString escapes backslashes and single quotes so s can be used
+// inside a single quoted SQL string literal.
+func escapeString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, `'`, `\'`, -1)
+}
+
+// killUserConnections terminates every session currently open for the given
+// user, as listed in the server's processlist.
+func (m *MySQL) killUserConnections(ctx context.Context, username string) error {
+	// Grab the lock
+	if err := m.lockOperation(ctx); err != nil {
+		return err
+	}
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.killSessions(ctx, db, username)
+}
+
+// killSessions kills the user's sessions like killUserConnections, for
+// callers already holding the lock.
+func (m *MySQL) killSessions(ctx context.Context, db *sql.DB, username string) error {
+	rows, err := db.QueryContext(ctx, userProcesslistSQL, username)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := db.ExecContext(ctx, fmt.Sprintf("KILL %d", id))
+		// 1094: Unknown thread id, the session has already gone away
+		if e, ok := err.(*stdmysql.MySQLError); ok && e.Number == 1094 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -232,64 +1494,518 @@ func (m *MySQL) changeUserPassword(ctx context.Context, username, password strin
 // applies the map to them, interpolating values into the templates, returning
 // the resulting username and password
 func (m *MySQL) executePreparedStatementsWithMap(ctx context.Context, statements []string, queryMap map[string]string) error {
-	// Grab the lock
-	m.Lock()
-	defer m.Unlock()
+	if err := checkStatementVerbs(renderQueries(statements, queryMap), m.AllowedStatementVerbs); err != nil {
+		return err
+	}
+	if err := checkGrantSchemas(renderQueries(statements, queryMap), m.SchemaAllowList); err != nil {
+		return err
+	}
 
+	_, err := m.executeStatements(ctx, statements, queryMap, -1, "")
+	return err
+}
+
+// executeStatements renders and executes the statements like
+// executePreparedStatementsWithMap. The rendered query at captureIndex is
+// run as a query instead and the columns of the first row of each of its
+// result sets are returned. A negative captureIndex captures nothing. The
+// session label is set as described by runQueries.
+func (m *MySQL) executeStatements(ctx context.Context, statements []string, queryMap map[string]string, captureIndex int, label string) (map[string]string, error) {
 	// Get the connection
-	db, err := m.getConnection(ctx)
+	db, err := m.operationConnection(ctx)
 	if err != nil {
+		return nil, err
+	}
+
+	// With interpolate_params the driver sends statements without
+	// arguments as plain queries, so preparing them only adds round trips
+	execute := m.executePrepared
+	if m.InterpolateParams {
+		execute = executeUnprepared
+	}
+
+	queries := renderQueries(statements, queryMap)
+	if captureIndex < 0 || captureIndex >= len(queries) {
+		return nil, m.runQueries(ctx, db, queries, label, m.withWarnings(m.withDuplicateGrants(withAnnotations(execute))))
+	}
+
+	var results map[string]string
+	i := 0
+	run := func(ctx context.Context, execer queryExecer, query string) error {
+		defer func() { i++ }()
+		if i != captureIndex {
+			return execute(ctx, execer, query)
+		}
+
+		var err error
+		results, err = captureResults(ctx, execer, query)
 		return err
 	}
-	// Start a transaction
-	tx, err := db.BeginTx(ctx, nil)
+
+	if err := m.runQueries(ctx, db, queries, label, m.withWarnings(m.withDuplicateGrants(withAnnotations(run)))); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// captureResults runs the query and collects the first row of every result
+// set it returns, keyed by column name. Later result sets override columns
+// of the same name.
+func captureResults(ctx context.Context, execer queryExecer, query string) (map[string]string, error) {
+	rows, err := execer.QueryContext(ctx, query)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[string]string)
+	for {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+
+		if rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+			for i, column := range columns {
+				results[column] = values[i].String
+			}
+			// Drain the remaining rows so the next result set can be read
+			for rows.Next() {
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+
+	return results, rows.Err()
+}
+
+// withWarnings wraps run to log the warnings of every query that succeeded
+// when collect_warnings is set. A failed query returns its own error, and
+// failing to read the warnings is only logged.
+func (m *MySQL) withWarnings(run queryRunner) queryRunner {
+	if !m.CollectWarnings {
+		return run
+	}
+
+	return func(ctx context.Context, execer queryExecer, query string) error {
+		if err := run(ctx, execer, query); err != nil {
+			return err
+		}
+
+		warnings, err := collectWarnings(ctx, execer)
+		if err != nil {
+			m.logger.Debug("failed to collect statement warnings", "error", err)
+			return nil
+		}
+		if len(warnings) > 0 {
+			m.logger.Warn("statement succeeded with warnings", "warnings", warnings)
+		}
+		return nil
+	}
+}
+
+// withDuplicateGrants wraps run to ignore GRANT statements failing because
+// the grant already exists when tolerate_duplicate_grants is set.
+func (m *MySQL) withDuplicateGrants(run queryRunner) queryRunner {
+	if !m.TolerateDuplicateGrants {
+		return run
+	}
+
+	return func(ctx context.Context, execer queryExecer, query string) error {
+		err := run(ctx, execer, query)
+		if err != nil && strings.HasPrefix(normalizeStatement(query), "GRANT ") && isDuplicateGrantError(err) {
+			m.logger.Debug("ignoring duplicate grant", "error", err)
+			return nil
+		}
 		return err
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+}
+
+// isDuplicateGrantError reports whether err is one of
+// duplicateGrantErrorCodes.
+func isDuplicateGrantError(err error) bool {
+	var mysqlErr *stdmysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
 
-	// Execute each query
+	for _, code := range duplicateGrantErrorCodes {
+		if int(mysqlErr.Number) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// collectWarnings returns the warnings raised by the previous statement on
+// the session, formatted as "Level Code: Message".
+func collectWarnings(ctx context.Context, execer queryExecer) ([]string, error) {
+	rows, err := execer.QueryContext(ctx, showWarningsSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warnings []string
+	for rows.Next() {
+		var level, code, message string
+		if err := rows.Scan(&level, &code, &message); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %s: %s", level, code, message))
+	}
+	return warnings, rows.Err()
+}
+
+// renderQueries splits the templated statements into individual queries and
+// applies queryMap to each of them.
+func renderQueries(statements []string, queryMap map[string]string) []string {
+	var queries []string
 	for _, stmt := range statements {
 		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
 			query = strings.TrimSpace(query)
 			if len(query) == 0 {
 				continue
 			}
+			queries = append(queries, dbutil.QueryHelper(query, queryMap))
+		}
+	}
+	return queries
+}
+
+// queryExecer is implemented by both *sql.DB and *sql.Tx so statements can
+// run inside or outside of a transaction.
+type queryExecer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
 
-			query = dbutil.QueryHelper(query, queryMap)
+// queryRunner executes a single rendered query.
+type queryRunner func(ctx context.Context, execer queryExecer, query string) error
 
-			stmt, err := tx.PrepareContext(ctx, query)
-			if err != nil {
-				// If the error code we get back is Error 1295: This command is not
-				// supported in the prepared statement protocol yet, we will execute
-				// the statement without preparing it. This allows the caller to
-				// manually prepare statements, as well as run other not yet
-				// prepare supported commands. If there is no error when running we
-				// will continue to the next statement.
-				if e, ok := err.(*stdmysql.MySQLError); ok && e.Number == 1295 {
-					_, err = tx.ExecContext(ctx, query)
-					if err != nil {
-						stmt.Close()
-						return err
-					}
-					continue
+// runQueries executes the rendered queries with run. In the default
+// transaction execution mode they run in a single transaction, in autocommit
+// mode each query is run and committed on its own. A non-empty label is
+// stored in the @vault_action session variable while the queries run. A
+// write rejected by a read-only server makes the next operation rediscover
+// the cluster primary.
+func (m *MySQL) runQueries(ctx context.Context, db *sql.DB, queries []string, label string, run queryRunner) (err error) {
+	defer func() {
+		if isReadOnlyError(err) {
+			m.invalidatePrimary(db)
+		}
+	}()
+
+	if m.ParallelStatements {
+		return m.runParallel(ctx, db, queries, label, run)
+	}
+
+	// The queries run on a single checked out session, also in autocommit
+	// mode, since the label and warnings belong to the session
+	conn, err := m.checkoutConn(ctx, db)
+	if err != nil {
+		return connectionError(err)
+	}
+	defer conn.Close()
+
+	resetLabel, err := setSessionLabel(ctx, conn, label)
+	if err != nil {
+		return err
+	}
+	defer resetLabel()
+
+	restoreQueryLog, err := m.suppressQueryLog(ctx, conn)
+	if err != nil {
+		return connectionError(err)
+	}
+	defer restoreQueryLog()
+
+	// With autocommit disabled the session always has a transaction open,
+	// BeginTx and Commit still delimit it in the transaction execution
+	// mode, the autocommit mode ends it explicitly
+	autocommit := !m.autocommitDisabled(roleFromContext(ctx))
+	if !autocommit {
+		if _, err := conn.ExecContext(ctx, disableAutocommitSQL); err != nil {
+			return fmt.Errorf("failed to disable autocommit: %w", err)
+		}
+		// Enabling autocommit commits an open transaction, so it must only
+		// run once the queries were committed or rolled back
+		defer func() {
+			_, _ = conn.ExecContext(context.Background(), enableAutocommitSQL)
+		}()
+	}
+
+	if m.ExecutionMode == executionModeAutocommit {
+		if !autocommit {
+			defer func() {
+				if err != nil {
+					_, _ = conn.ExecContext(context.Background(), rollbackSQL)
 				}
+			}()
+		}
 
+		for _, query := range queries {
+			if err := ctx.Err(); err != nil {
 				return err
 			}
-			if _, err := stmt.ExecContext(ctx); err != nil {
-				stmt.Close()
-				return err
+			if err := run(ctx, conn, query); err != nil {
+				return connectionError(err)
+			}
+		}
+
+		if !autocommit {
+			if _, err := conn.ExecContext(ctx, commitSQL); err != nil {
+				return connectionError(err)
 			}
-			stmt.Close()
 		}
+		return nil
 	}
 
-	// Commit the transaction
+	// Start a transaction
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return connectionError(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Execute each query. Stop between statements once the context is
+	// done, since not every server honors cancellation mid statement. The
+	// transaction is then rolled back and its connection discarded by
+	// database/sql.
+	for _, query := range queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := run(ctx, tx, query); err != nil {
+			return connectionError(err)
+		}
+	}
+
+	// Commit the transaction. Losing the connection while committing leaves
+	// the outcome unknown, the server may have applied it.
 	if err := tx.Commit(); err != nil {
+		if isConnectionLostError(err) {
+			return &ambiguousCommitError{err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// setSessionLabel stores a non-empty label in the @vault_action session
+// variable and returns a function clearing it again.
+func setSessionLabel(ctx context.Context, conn *sql.Conn, label string) (func(), error) {
+	if label == "" {
+		return func() {}, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, setSessionLabelSQL, label); err != nil {
+		return nil, fmt.Errorf("failed to set session label: %w", err)
+	}
+	// The session returns to the pool afterwards, so don't leave the label
+	// behind for unrelated operations
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), resetSessionLabelSQL)
+	}, nil
+}
+
+// suppressQueryLog turns sql_log_off on for the session when ctx asks for
+// it, so the statements that follow stay out of the general query log, and
+// returns a function setting it back to the server default. Setting it
+// needs SUPER or SYSTEM_VARIABLES_ADMIN; without the privilege the
+// statements are logged as usual.
+func (m *MySQL) suppressQueryLog(ctx context.Context, conn *sql.Conn) (func(), error) {
+	if !queryLogSuppressed(ctx) {
+		return func() {}, nil
+	}
+
+	_, err := conn.ExecContext(ctx, disableQueryLogSQL)
+	if isAccessDeniedError(err) {
+		m.logger.Warn("unable to suppress the query log, the connection user can't set sql_log_off", "error", err)
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to suppress the query log: %w", err)
+	}
+	// Like the label, the setting mustn't stay with the pooled session
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), restoreQueryLogSQL)
+	}, nil
+}
+
+// runParallel executes the queries for parallel_statements. The queries of
+// each batch returned by parallelBatches run concurrently, every query on
+// its own session and committed on its own, and the next batch starts once
+// they are all done. The error of the first failed query of a batch is
+// returned and the remaining batches are skipped.
+func (m *MySQL) runParallel(ctx context.Context, db *sql.DB, queries []string, label string, run queryRunner) error {
+	for _, batch := range parallelBatches(queries) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i, query := range batch {
+			wg.Add(1)
+			go func(i int, query string) {
+				defer wg.Done()
+				errs[i] = m.runOnSession(ctx, db, query, label, run)
+			}(i, query)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runOnSession runs a single query with run on a session of its own.
+func (m *MySQL) runOnSession(ctx context.Context, db *sql.DB, query, label string, run queryRunner) error {
+	conn, err := m.checkoutConn(ctx, db)
+	if err != nil {
+		return connectionError(err)
+	}
+	defer conn.Close()
+
+	resetLabel, err := setSessionLabel(ctx, conn, label)
+	if err != nil {
 		return err
 	}
+	defer resetLabel()
+
+	restoreQueryLog, err := m.suppressQueryLog(ctx, conn)
+	if err != nil {
+		return connectionError(err)
+	}
+	defer restoreQueryLog()
+
+	return connectionError(run(ctx, conn, query))
+}
+
+// parallelBatches splits the queries into the batches run by runParallel.
+// Consecutive GRANT statements are independent of each other and share a
+// batch, every other query is a batch of its own, so a GRANT never runs
+// before the CREATE USER preceding it.
+func parallelBatches(queries []string) [][]string {
+	var batches [][]string
+	grants := false
+	for _, query := range queries {
+		grant := strings.HasPrefix(normalizeStatement(query), "GRANT ")
+		if grant && grants {
+			batches[len(batches)-1] = append(batches[len(batches)-1], query)
+		} else {
+			batches = append(batches, []string{query})
+		}
+		grants = grant
+	}
+	return batches
+}
+
+// ambiguousCommitError is returned by runQueries when the connection was
+// lost during the commit, so the queries may or may not have been applied.
+type ambiguousCommitError struct {
+	err error
+}
+
+func (e *ambiguousCommitError) Error() string {
+	return fmt.Sprintf("connection lost during commit, the outcome is unknown: %s", e.err)
+}
+
+func (e *ambiguousCommitError) Unwrap() error {
+	return e.err
+}
+
+// isConnectionLostError reports whether err means the connection to the
+// server broke, as opposed to the server rejecting the statement.
+func isConnectionLostError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, stdmysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// resolveAmbiguousCommit checks whether the user exists after the commit of
+// its creation statements lost the connection. With verify_ambiguous_commit
+// set, an existing user means the commit was applied and nil is returned.
+// Otherwise err is returned unchanged.
+func (m *MySQL) resolveAmbiguousCommit(ctx context.Context, username string, err error) error {
+	var commitErr *ambiguousCommitError
+	if !m.VerifyAmbiguousCommit || !errors.As(err, &commitErr) {
+		return err
+	}
+
+	db, connErr := m.operationConnection(ctx)
+	if connErr != nil {
+		m.logger.Warn("unable to verify ambiguous commit", "username", username, "error", connErr)
+		return err
+	}
+
+	var count int
+	if verifyErr := db.QueryRowContext(ctx, userExistsSQL, username).Scan(&count); verifyErr != nil {
+		m.logger.Warn("unable to verify ambiguous commit", "username", username, "error", verifyErr)
+		return err
+	}
+	if count == 0 {
+		return err
+	}
+
+	m.logger.Warn("connection lost during commit but the user exists, treating it as created", "username", username, "error", commitErr.err)
 	return nil
 }
+
+// executePrepared runs the query as a prepared statement.
+func (m *MySQL) executePrepared(ctx context.Context, execer queryExecer, query string) error {
+	stmt, err := execer.PrepareContext(ctx, query)
+	if err != nil {
+		// If the error code we get back is Error 1295: This command is not
+		// supported in the prepared statement protocol yet, we will execute
+		// the statement without preparing it. This allows the caller to
+		// manually prepare statements, as well as run other not yet
+		// prepare supported commands. If there is no error when running we
+		// will continue to the next statement.
+		if e, ok := err.(*stdmysql.MySQLError); ok && e.Number == 1295 {
+			m.metrics().preparedFallback()
+			_, err = execer.ExecContext(ctx, query)
+			return err
+		}
+
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// executeUnprepared runs the query without preparing it.
+func executeUnprepared(ctx context.Context, execer queryExecer, query string) error {
+	// This is not a prepared statement because not all commands are supported
+	// 1295: This command is not supported in the prepared statement protocol yet
+	// Reference https://mariadb.com/kb/en/mariadb/prepare-statement/
+	_, err := execer.ExecContext(ctx, query)
+	return err
+}
@@ -3,7 +3,12 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -93,6 +98,33 @@ func TestMySQL_CreateUser(t *testing.T) {
 		}
 	})
 
+	t.Run("empty password", func(t *testing.T) {
+		db := new(false)
+
+		createReq := dbplugin.NewUserRequest{
+			UsernameConfig: dbplugin.UsernameMetadata{
+				DisplayName: "test",
+				RoleName:    "test",
+			},
+			Statements: dbplugin.Statements{
+				Commands: []string{`
+					CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+					GRANT SELECT ON *.* TO '{{name}}'@'%';`,
+				},
+			},
+			Password:   "",
+			Expiration: time.Now().Add(time.Minute),
+		}
+
+		userResp, err := db.NewUser(context.Background(), createReq)
+		if err == nil {
+			t.Fatalf("expected err, got nil")
+		}
+		if userResp.Username != "" {
+			t.Fatalf("expected empty username, got [%s]", userResp.Username)
+		}
+	})
+
 	t.Run("non-legacy", func(t *testing.T) {
 		// Shared test container for speed - there should not be any overlap between the tests
 		cleanup, connURL := mysqlhelper.PrepareTestContainer(t, false, "secret")
@@ -512,6 +544,2717 @@ func TestMySQL_Initialize_ReservedChars(t *testing.T) {
 	}
 }
 
+func TestMySQL_generateUsername(t *testing.T) {
+	type testCase struct {
+		legacy    bool
+		styles    map[string]string
+		prefix    string
+		suffix    string
+		maxLen    int
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"no affixes": {},
+		"prefix": {
+			prefix: "vault_",
+		},
+		"prefix and suffix": {
+			prefix: "vault_",
+			suffix: "_x",
+		},
+		"legacy prefix": {
+			legacy: true,
+			prefix: "vault_",
+			maxLen: LegacyUsernameLen,
+		},
+		"role overrides to legacy": {
+			styles: map[string]string{"a-long-role-name": usernameStyleLegacy},
+			maxLen: LegacyUsernameLen,
+		},
+		"role overrides to modern": {
+			legacy: true,
+			styles: map[string]string{"a-long-role-name": usernameStyleModern},
+		},
+		"other role keeps instance style": {
+			legacy: true,
+			styles: map[string]string{"other": usernameStyleModern},
+			maxLen: LegacyUsernameLen,
+		},
+		"prefix too long": {
+			legacy:    true,
+			prefix:    "this_prefix_is_long",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := new(test.legacy)
+			db.RoleUsernameStyles = test.styles
+			db.UsernamePrefix = test.prefix
+			db.UsernameSuffix = test.suffix
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "token-with-a-long-display-name",
+					RoleName:    "a-long-role-name",
+				},
+			}
+
+			username, err := db.generateUsername(req)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.expectErr {
+				return
+			}
+
+			maxLen := UsernameLen
+			if test.maxLen > 0 {
+				maxLen = test.maxLen
+			}
+			if len(username) != maxLen {
+				t.Fatalf("username %q is not %d characters long", username, maxLen)
+			}
+			if !strings.HasPrefix(username, test.prefix) || !strings.HasSuffix(username, test.suffix) {
+				t.Fatalf("username %q is missing prefix %q or suffix %q", username, test.prefix, test.suffix)
+			}
+		})
+	}
+}
+
+func TestMySQL_generateUsername_minimumLength(t *testing.T) {
+	type testCase struct {
+		legacy    bool
+		prefix    string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"modern": {},
+		"legacy": {
+			legacy: true,
+		},
+		"legacy with room for the minimum": {
+			legacy: true,
+			prefix: "vault_ro",
+		},
+		"legacy with a long prefix": {
+			legacy:    true,
+			prefix:    "vault_ro_",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := new(test.legacy)
+			db.UsernamePrefix = test.prefix
+
+			username, err := db.generateUsername(dbplugin.NewUserRequest{})
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got username %q", username)
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if !test.expectErr && len(username)-len(test.prefix) < minGeneratedUsernameLen {
+				t.Fatalf("username %q is too short", username)
+			}
+		})
+	}
+}
+
+func TestMySQL_generateUsername_serverMaxLength(t *testing.T) {
+	type testCase struct {
+		rows      map[string]fakeRows
+		expectMax int
+	}
+
+	tests := map[string]testCase{
+		"mysql 5.6 clamps modern usernames": {
+			rows: map[string]fakeRows{
+				serverVersionSQL: {
+					columns: []string{"VERSION()"},
+					values:  [][]driver.Value{{"5.6.51-log"}},
+				},
+			},
+			expectMax: 16,
+		},
+		"mariadb keeps the default": {
+			rows: map[string]fakeRows{
+				serverVersionSQL: {
+					columns: []string{"VERSION()"},
+					values:  [][]driver.Value{{"10.5.8-MariaDB"}},
+				},
+			},
+			expectMax: UsernameLen,
+		},
+		"detection failure falls back to the default": {
+			expectMax: UsernameLen,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newFakeMySQL(t, &fakeDriver{rows: test.rows})
+			db.detectMaxUsernameLen(context.Background())
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "a-very-long-display-name",
+					RoleName:    "a-very-long-role-name",
+				},
+			}
+			username, err := db.generateUsername(req)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if len(username) != test.expectMax {
+				t.Fatalf("expected a username of %d characters, got %q", test.expectMax, username)
+			}
+		})
+	}
+}
+
+func TestMySQL_uniqueUsername(t *testing.T) {
+	type testCase struct {
+		existing  int64
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"unique":          {existing: 0},
+		"always collides": {existing: 1, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					userExistsSQL: {
+						columns: []string{"COUNT(*)"},
+						values:  [][]driver.Value{{test.existing}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.CheckUsernameUniqueness = true
+			db.UsernameUniquenessAttempts = 3
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "test",
+				},
+			}
+			username, err := db.uniqueUsername(context.Background(), req)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got username %q", username)
+				}
+				if checks := len(d.calls()); checks != 3 {
+					t.Fatalf("expected 3 uniqueness checks, got %d", checks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if username == "" {
+				t.Fatalf("expected a username")
+			}
+		})
+	}
+}
+
+func TestMySQL_generateUsername_randomLength(t *testing.T) {
+	type testCase struct {
+		legacy       bool
+		randomLength int
+		expectErr    bool
+	}
+
+	tests := map[string]testCase{
+		"legacy": {
+			legacy:       true,
+			randomLength: 6,
+		},
+		"modern": {
+			randomLength: 20,
+		},
+		"too long": {
+			legacy:       true,
+			randomLength: 15,
+			expectErr:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := new(test.legacy)
+			db.UsernameRandomLength = test.randomLength
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "a-long-display-name",
+					RoleName:    "a-long-role-name",
+				},
+			}
+
+			username, err := db.generateUsername(req)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.expectErr {
+				return
+			}
+
+			parts := strings.Split(username, "_")
+			if len(parts) < 4 || len(parts[3]) < test.randomLength {
+				t.Fatalf("username %q does not keep %d random characters", username, test.randomLength)
+			}
+		})
+	}
+}
+
+func TestTTLSeconds(t *testing.T) {
+	if actual := ttlSeconds(time.Now().Add(time.Hour + time.Second/2)); actual != "3600" {
+		t.Fatalf("expected 3600, got %s", actual)
+	}
+	if actual := ttlSeconds(time.Now().Add(-time.Minute)); actual != "0" {
+		t.Fatalf("expected 0 for an expired request, got %s", actual)
+	}
+}
+
+func TestMySQL_executionMode(t *testing.T) {
+	statements := []string{`
+		CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+		GRANT SELECT ON app.* TO '{{name}}'@'%';`,
+	}
+	queryMap := map[string]string{
+		"name":     "v_test",
+		"password": "secret",
+	}
+
+	type testCase struct {
+		mode        string
+		prepareErrs map[string]error
+		expected    []string
+	}
+
+	tests := map[string]testCase{
+		"transaction": {
+			mode: executionModeTransaction,
+			expected: []string{
+				"begin",
+				"prepare: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"exec: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"prepare: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"commit",
+			},
+		},
+		"autocommit": {
+			mode: executionModeAutocommit,
+			expected: []string{
+				"prepare: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"exec: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"prepare: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+			},
+		},
+		"autocommit with 1295 fallback": {
+			mode: executionModeAutocommit,
+			prepareErrs: map[string]error{
+				"GRANT": &stdmysql.MySQLError{Number: 1295},
+			},
+			expected: []string{
+				"prepare: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"exec: CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"prepare: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{prepareErrs: test.prepareErrs}
+			db := newFakeMySQL(t, d)
+			db.ExecutionMode = test.mode
+
+			err := db.executePreparedStatementsWithMap(context.Background(), statements, queryMap)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestParallelBatches(t *testing.T) {
+	queries := []string{
+		"CREATE USER 'v_test'@'%'",
+		"GRANT SELECT ON a.* TO 'v_test'@'%'",
+		"grant SELECT ON b.* TO 'v_test'@'%'",
+		"ALTER USER 'v_test'@'%' ACCOUNT LOCK",
+		"GRANT SELECT ON c.* TO 'v_test'@'%'",
+	}
+	expected := [][]string{
+		{"CREATE USER 'v_test'@'%'"},
+		{"GRANT SELECT ON a.* TO 'v_test'@'%'", "grant SELECT ON b.* TO 'v_test'@'%'"},
+		{"ALTER USER 'v_test'@'%' ACCOUNT LOCK"},
+		{"GRANT SELECT ON c.* TO 'v_test'@'%'"},
+	}
+
+	if actual := parallelBatches(queries); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestMySQL_parallelStatements(t *testing.T) {
+	statements := []string{`
+		CREATE USER '{{name}}'@'%';
+		GRANT SELECT ON a.* TO '{{name}}'@'%';
+		GRANT SELECT ON b.* TO '{{name}}'@'%';`,
+	}
+	queryMap := map[string]string{"name": "v_test"}
+
+	t.Run("grants run concurrently", func(t *testing.T) {
+		// Each GRANT waits for the other one to start, which only happens
+		// when they run concurrently
+		var started sync.WaitGroup
+		started.Add(2)
+		done := make(chan struct{})
+		d := &fakeDriver{
+			onExec: func(query string) {
+				if !strings.HasPrefix(query, "GRANT") {
+					return
+				}
+				started.Done()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+				}
+			},
+		}
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+
+		db := newFakeMySQL(t, d)
+		db.ExecutionMode = executionModeAutocommit
+		db.ParallelStatements = true
+
+		if err := db.executePreparedStatementsWithMap(context.Background(), statements, queryMap); err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+		select {
+		case <-done:
+		default:
+			t.Fatalf("expected the grants to run concurrently, calls: %v", d.calls())
+		}
+		if actual := d.calls(); actual[0] != "prepare: CREATE USER 'v_test'@'%'" {
+			t.Fatalf("expected CREATE USER to run first, calls: %v", actual)
+		}
+	})
+
+	t.Run("first error", func(t *testing.T) {
+		d := &fakeDriver{
+			errs: map[string]error{
+				"GRANT SELECT ON a": &stdmysql.MySQLError{Number: 1044, Message: "a denied"},
+				"GRANT SELECT ON b": &stdmysql.MySQLError{Number: 1044, Message: "b denied"},
+			},
+		}
+		db := newFakeMySQL(t, d)
+		db.ExecutionMode = executionModeAutocommit
+		db.ParallelStatements = true
+
+		err := db.executePreparedStatementsWithMap(context.Background(), statements, queryMap)
+		if err == nil || !strings.Contains(err.Error(), "a denied") {
+			t.Fatalf("expected the error of the first grant, got: %v", err)
+		}
+	})
+}
+
+func TestMySQL_passwordExpired(t *testing.T) {
+	expired := &stdmysql.MySQLError{
+		Number:  1820,
+		Message: "You must reset your password using ALTER USER statement before executing this statement.",
+	}
+	d := &fakeDriver{
+		errs: map[string]error{
+			serverVersionSQL: expired,
+			"CREATE USER":    expired,
+		},
+	}
+	db := newFakeMySQL(t, d)
+
+	if err := db.detectMaxUsernameLen(context.Background()); err != ErrConnectionPasswordExpired {
+		t.Fatalf("expected ErrConnectionPasswordExpired on Initialize, got: %v", err)
+	}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	if _, err := db.NewUser(context.Background(), req); err != ErrConnectionPasswordExpired {
+		t.Fatalf("expected ErrConnectionPasswordExpired from NewUser, got: %v", err)
+	}
+}
+
+func TestMySQL_disableAutocommit(t *testing.T) {
+	type testCase struct {
+		mode     string
+		role     string
+		errs     map[string]error
+		expected []string
+	}
+
+	tests := map[string]testCase{
+		"role without override": {
+			role: "other",
+			expected: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"commit",
+			},
+		},
+		"transaction": {
+			role: "provisioning",
+			expected: []string{
+				"exec: SET autocommit = 0",
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"commit",
+				"exec: SET autocommit = 1",
+			},
+		},
+		"transaction rollback": {
+			role: "provisioning",
+			errs: map[string]error{"GRANT": &stdmysql.MySQLError{Number: 1044}},
+			expected: []string{
+				"exec: SET autocommit = 0",
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"rollback",
+				"exec: SET autocommit = 1",
+			},
+		},
+		"autocommit": {
+			mode: executionModeAutocommit,
+			role: "provisioning",
+			expected: []string{
+				"exec: SET autocommit = 0",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"exec: COMMIT",
+				"exec: SET autocommit = 1",
+			},
+		},
+		"autocommit rollback": {
+			mode: executionModeAutocommit,
+			role: "provisioning",
+			errs: map[string]error{"GRANT": &stdmysql.MySQLError{Number: 1044}},
+			expected: []string{
+				"exec: SET autocommit = 0",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"exec: ROLLBACK",
+				"exec: SET autocommit = 1",
+			},
+		},
+	}
+
+	queries := []string{
+		"CREATE USER 'v_test'@'%'",
+		"GRANT SELECT ON app.* TO 'v_test'@'%'",
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{errs: test.errs}
+			db := newFakeMySQL(t, d)
+			db.ExecutionMode = test.mode
+			db.RoleDisableAutocommit = map[string]bool{"provisioning": true}
+
+			ctx := withRole(context.Background(), test.role)
+			err := db.runQueries(ctx, db.db, queries, "", executeUnprepared)
+			if test.errs == nil && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.errs != nil && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_interpolateParams(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.InterpolateParams = true
+
+	statements := []string{"CREATE USER '{{name}}'@'%'; GRANT SELECT ON app.* TO '{{name}}'@'%'"}
+	if err := db.executePreparedStatementsWithMap(context.Background(), statements, map[string]string{"name": "v_test"}); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		"begin",
+		"exec: CREATE USER 'v_test'@'%'",
+		"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+		"commit",
+	}
+	if actual := d.calls(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+// BenchmarkMySQL_interpolateParams compares the driver round trips of the
+// creation statements with and without interpolate_params.
+func BenchmarkMySQL_interpolateParams(b *testing.B) {
+	statements := []string{`
+		CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+		GRANT SELECT ON app.* TO '{{name}}'@'%';
+		GRANT INSERT ON app.* TO '{{name}}'@'%';`,
+	}
+	queryMap := map[string]string{
+		"name":     "v_test",
+		"password": "secret",
+	}
+
+	for _, interpolate := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interpolate_params=%t", interpolate), func(b *testing.B) {
+			d := &fakeDriver{}
+			db := new(false)
+			db.Initialized = true
+			db.db = sql.OpenDB(d)
+			db.InterpolateParams = interpolate
+			defer db.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := db.executePreparedStatementsWithMap(context.Background(), statements, queryMap); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(d.calls()))/float64(b.N), "roundtrips/op")
+		})
+	}
+}
+
+func TestMySQL_NewUser_concurrent(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	d := &fakeDriver{
+		onExec: func(query string) {
+			if strings.HasPrefix(query, "CREATE USER") {
+				arrived <- struct{}{}
+				<-release
+			}
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.UsernameUniquenessAttempts = 3
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := db.NewUser(context.Background(), req)
+			errs <- err
+		}()
+	}
+
+	// Both creations must be running their statements at the same time
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-arrived:
+		case <-timeout:
+			close(release)
+			t.Fatalf("expected concurrent NewUser calls to run their statements concurrently")
+		}
+	}
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+	}
+}
+
+// BenchmarkMySQL_NewUser_parallel measures the throughput of concurrent
+// NewUser calls against a server with 1ms statement latency, compared to
+// running them one at a time as the plugin did while the producer lock was
+// held for the whole operation.
+func BenchmarkMySQL_NewUser_parallel(b *testing.B) {
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT SELECT ON app.* TO '{{name}}'@'%';`,
+			},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Hour),
+	}
+
+	for _, serialized := range []bool{true, false} {
+		b.Run(fmt.Sprintf("serialized=%t", serialized), func(b *testing.B) {
+			d := &fakeDriver{
+				onExec: func(string) {
+					time.Sleep(time.Millisecond)
+				},
+			}
+			db := new(false)
+			db.Initialized = true
+			db.db = sql.OpenDB(d)
+			defer db.Close()
+
+			var mu sync.Mutex
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if serialized {
+						mu.Lock()
+					}
+					_, err := db.NewUser(context.Background(), req)
+					if serialized {
+						mu.Unlock()
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestMySQL_collectWarnings(t *testing.T) {
+	type testCase struct {
+		errs        map[string]error
+		expectErr   error
+		expectCalls []string
+	}
+
+	stmtErr := errors.New("grant failed")
+	tests := map[string]testCase{
+		"warnings collected after each statement": {
+			expectCalls: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"query: SHOW WARNINGS",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"query: SHOW WARNINGS",
+				"commit",
+			},
+		},
+		"statement error is not masked": {
+			errs:      map[string]error{"GRANT": stmtErr},
+			expectErr: stmtErr,
+			expectCalls: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"query: SHOW WARNINGS",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"rollback",
+			},
+		},
+		"failing to collect warnings is ignored": {
+			errs: map[string]error{showWarningsSQL: errors.New("not allowed")},
+			expectCalls: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"query: SHOW WARNINGS",
+				"exec: GRANT SELECT ON app.* TO 'v_test'@'%'",
+				"query: SHOW WARNINGS",
+				"commit",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				errs: test.errs,
+				rows: map[string]fakeRows{
+					showWarningsSQL: {
+						columns: []string{"Level", "Code", "Message"},
+						values:  [][]driver.Value{{"Warning", "1287", "deprecated syntax"}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.InterpolateParams = true
+			db.CollectWarnings = true
+
+			statements := []string{"CREATE USER '{{name}}'@'%'; GRANT SELECT ON app.* TO '{{name}}'@'%'"}
+			err := db.executePreparedStatementsWithMap(context.Background(), statements, map[string]string{"name": "v_test"})
+			if !errors.Is(err, test.expectErr) {
+				t.Fatalf("expected error %v, got: %v", test.expectErr, err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expectCalls) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expectCalls, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_tolerateDuplicateGrants(t *testing.T) {
+	type testCase struct {
+		tolerate  bool
+		errs      map[string]error
+		expectErr bool
+	}
+
+	duplicate := &stdmysql.MySQLError{Number: 1062, Message: "Duplicate entry '%-app-v_test' for key 'PRIMARY'"}
+	tests := map[string]testCase{
+		"re-grant tolerated": {
+			tolerate: true,
+			errs:     map[string]error{"GRANT": duplicate},
+		},
+		"re-grant not tolerated by default": {
+			errs:      map[string]error{"GRANT": duplicate},
+			expectErr: true,
+		},
+		"other grant errors still fail": {
+			tolerate:  true,
+			errs:      map[string]error{"GRANT": &stdmysql.MySQLError{Number: 1044}},
+			expectErr: true,
+		},
+		"duplicates outside of grants still fail": {
+			tolerate:  true,
+			errs:      map[string]error{"INSERT": duplicate},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{errs: test.errs}
+			db := newFakeMySQL(t, d)
+			db.TolerateDuplicateGrants = test.tolerate
+
+			statements := []string{
+				"GRANT SELECT ON app.* TO '{{name}}'@'%'; INSERT INTO app.users VALUES ('{{name}}')",
+			}
+			err := db.executePreparedStatementsWithMap(context.Background(), statements, map[string]string{"name": "v_test"})
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestCollectWarnings(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			showWarningsSQL: {
+				columns: []string{"Level", "Code", "Message"},
+				values: [][]driver.Value{
+					{"Warning", "1287", "deprecated syntax"},
+					{"Note", "1449", "definer does not exist"},
+				},
+			},
+		},
+	}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	warnings, err := collectWarnings(context.Background(), db)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		"Warning 1287: deprecated syntax",
+		"Note 1449: definer does not exist",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestMySQL_captureCreationResults(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			"CALL provision": {
+				columns: []string{"schema_name"},
+				values:  [][]driver.Value{{"app_1234"}},
+			},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.CaptureCreationResults = true
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				CALL provision('{{name}}');`,
+			},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	md, ok := db.UserMetadata(resp.Username)
+	if !ok {
+		t.Fatalf("expected metadata for %s", resp.Username)
+	}
+	if md["schema_name"] != "app_1234" || md[metadataRoleName] != "app" {
+		t.Fatalf("unexpected metadata: %#v", md)
+	}
+
+	expectedCall := fmt.Sprintf("query: CALL provision('%s')", resp.Username)
+	if !strutil.StrListContains(d.calls(), expectedCall) {
+		t.Fatalf("expected %q in calls: %v", expectedCall, d.calls())
+	}
+}
+
+func TestMySQL_NewUser_serverMetadata(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.ConnectionURL = "{{username}}:{{password}}@tcp(db.example.com:3306)/"
+	db.Username = "root"
+	db.Password = "rootpassword"
+	db.detectedServerVersion = "8.0.32"
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	md, ok := db.UserMetadata(resp.Username)
+	if !ok {
+		t.Fatalf("expected metadata for %s", resp.Username)
+	}
+	if md[metadataServerAddress] != "db.example.com:3306" || md[metadataServerVersion] != "8.0.32" {
+		t.Fatalf("unexpected metadata: %#v", md)
+	}
+	if _, err := time.Parse(time.RFC3339, md[metadataCreatedAt]); err != nil {
+		t.Fatalf("expected an RFC3339 created_at, got: %q", md[metadataCreatedAt])
+	}
+	for _, v := range md {
+		if strings.Contains(v, "rootpassword") || strings.Contains(v, "secret") {
+			t.Fatalf("metadata contains a password: %#v", md)
+		}
+	}
+}
+
+func TestMySQL_DeleteUser_revocationSteps(t *testing.T) {
+	type testCase struct {
+		revokePrivileges bool
+		killConnections  bool
+		expected         []string
+	}
+
+	revoke := "exec: REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'v_test'@'%'"
+	drop := "exec: DROP USER 'v_test'@'%'"
+	processlist := "query: " + userProcesslistSQL
+
+	tests := map[string]testCase{
+		"statements only": {
+			expected: []string{"begin", drop, "commit"},
+		},
+		"revoke privileges": {
+			revokePrivileges: true,
+			expected:         []string{revoke, "begin", drop, "commit"},
+		},
+		"kill connections": {
+			killConnections: true,
+			expected:        []string{processlist, "exec: KILL 42", "begin", drop, "commit"},
+		},
+		"all steps": {
+			revokePrivileges: true,
+			killConnections:  true,
+			expected:         []string{revoke, processlist, "exec: KILL 42", "begin", drop, "commit"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					userProcesslistSQL: {
+						columns: []string{"ID"},
+						values:  [][]driver.Value{{int64(42)}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.RevocationRevokePrivileges = test.revokePrivileges
+			db.RevocationKillConnections = test.killConnections
+
+			req := dbplugin.DeleteUserRequest{
+				Username: "v_test",
+				Statements: dbplugin.Statements{
+					Commands: []string{"DROP USER '{{name}}'@'%'"},
+				},
+			}
+			if _, err := db.DeleteUser(context.Background(), req); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_DeleteUser_dynamicRevocation(t *testing.T) {
+	type testCase struct {
+		grants   []string
+		showErr  error
+		expected []string
+	}
+
+	show := "query: SHOW GRANTS FOR 'v_test'@'%'"
+	revokeAll := "exec: REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'v_test'@'%'"
+	drop := "exec: DROP USER 'v_test'@'%'"
+
+	tests := map[string]testCase{
+		"recognized grants": {
+			grants: []string{
+				"GRANT USAGE ON *.* TO `v_test`@`%`",
+				"GRANT SELECT ON `app`.* TO `v_test`@`%`",
+				"GRANT `app_rw`@`%` TO `v_test`@`%`",
+			},
+			expected: []string{
+				show,
+				"exec: REVOKE SELECT ON `app`.* FROM 'v_test'@'%'",
+				"exec: REVOKE `app_rw`@`%` FROM 'v_test'@'%'",
+				"begin", drop, "commit",
+			},
+		},
+		"unrecognized grant": {
+			grants: []string{
+				"GRANT SELECT ON `app`.* TO `v_test`@`%`",
+				"REVOKE SELECT ON `app`.`secrets` FROM `v_test`@`%`",
+			},
+			expected: []string{
+				show,
+				"exec: REVOKE SELECT ON `app`.* FROM 'v_test'@'%'",
+				revokeAll,
+				"begin", drop, "commit",
+			},
+		},
+		"grants not readable": {
+			showErr:  &stdmysql.MySQLError{Number: 1227},
+			expected: []string{show, revokeAll, "begin", drop, "commit"},
+		},
+		"user already dropped": {
+			showErr:  &stdmysql.MySQLError{Number: 1141},
+			expected: []string{show, "begin", drop, "commit"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := make([][]driver.Value, len(test.grants))
+			for i, grant := range test.grants {
+				values[i] = []driver.Value{grant}
+			}
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					"SHOW GRANTS FOR": {columns: []string{"Grants for v_test@%"}, values: values},
+				},
+			}
+			if test.showErr != nil {
+				d.errs = map[string]error{"SHOW GRANTS FOR": test.showErr}
+			}
+			db := newFakeMySQL(t, d)
+			db.DynamicRevocation = true
+			db.FallbackRevocationErrorCodes = []int{1141}
+
+			req := dbplugin.DeleteUserRequest{
+				Username: "v_test",
+				Statements: dbplugin.Statements{
+					Commands: []string{"DROP USER '{{name}}'@'%'"},
+				},
+			}
+			if _, err := db.DeleteUser(context.Background(), req); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_changeUserPassword_suppressQueryLog(t *testing.T) {
+	type testCase struct {
+		suppress bool
+		errs     map[string]error
+		expected []string
+	}
+
+	rotate := "exec: ALTER USER 'v_test'@'%' IDENTIFIED BY 'secret'"
+
+	tests := map[string]testCase{
+		"not suppressed": {
+			expected: []string{"begin", rotate, "commit"},
+		},
+		"suppressed": {
+			suppress: true,
+			expected: []string{
+				"exec: SET SESSION sql_log_off = 1",
+				"begin", rotate, "commit",
+				"exec: SET SESSION sql_log_off = DEFAULT",
+			},
+		},
+		"not privileged": {
+			suppress: true,
+			errs:     map[string]error{"SET SESSION sql_log_off": &stdmysql.MySQLError{Number: 1227}},
+			expected: []string{
+				"exec: SET SESSION sql_log_off = 1",
+				"begin", rotate, "commit",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{errs: test.errs}
+			db := newFakeMySQL(t, d)
+			db.RotationSyntax = rotationSyntaxAlterUser
+			db.InterpolateParams = true
+			db.SuppressQueryLog = test.suppress
+
+			if err := db.changeUserPassword(context.Background(), "v_test", "secret", nil); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_changeUserPassword_disconnect(t *testing.T) {
+	type testCase struct {
+		disconnect bool
+		errs       map[string]error
+		expected   []string
+		expectErr  bool
+	}
+
+	rotate := "exec: ALTER USER 'v_test'@'%' IDENTIFIED BY 'secret'"
+	processlist := "query: " + userProcesslistSQL
+
+	tests := map[string]testCase{
+		"default": {
+			expected: []string{"begin", rotate, "commit"},
+		},
+		"disconnect": {
+			disconnect: true,
+			expected: []string{
+				"begin", rotate, "commit",
+				processlist, "exec: KILL 11", "exec: KILL 12",
+			},
+		},
+		"session already gone": {
+			disconnect: true,
+			errs:       map[string]error{"KILL 11": &stdmysql.MySQLError{Number: 1094}},
+			expected: []string{
+				"begin", rotate, "commit",
+				processlist, "exec: KILL 11", "exec: KILL 12",
+			},
+		},
+		"kill fails": {
+			disconnect: true,
+			errs:       map[string]error{"KILL 11": &stdmysql.MySQLError{Number: 1095}},
+			expected: []string{
+				"begin", rotate, "commit",
+				processlist, "exec: KILL 11",
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				errs: test.errs,
+				rows: map[string]fakeRows{
+					userProcesslistSQL: {
+						columns: []string{"ID"},
+						values:  [][]driver.Value{{int64(11)}, {int64(12)}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.RotationSyntax = rotationSyntaxAlterUser
+			db.InterpolateParams = true
+			db.PasswordChangeDisconnect = test.disconnect
+
+			err := db.changeUserPassword(context.Background(), "v_test", "secret", nil)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if actual := d.calls(); !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_rotateOnInit(t *testing.T) {
+	type testCase struct {
+		verifyErr     error
+		expectedInits []string
+		expectedAlter []string
+		expectErr     bool
+	}
+
+	tests := map[string]testCase{
+		"rotated": {
+			expectedInits: []string{"rotated verify=true"},
+			expectedAlter: []string{"rotated"},
+		},
+		"failed re-init": {
+			verifyErr: errors.New("access denied"),
+			expectedInits: []string{
+				"rotated verify=true",
+				"rotated verify=false",
+				"bootstrap verify=false",
+			},
+			expectedAlter: []string{"rotated", "bootstrap"},
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.Username = "vault"
+			db.Password = "bootstrap"
+			db.RotationSyntax = rotationSyntaxAlterUser
+			db.InterpolateParams = true
+
+			var newPassword string
+			label := func(password string) string {
+				if password == "bootstrap" {
+					return password
+				}
+				newPassword = password
+				return "rotated"
+			}
+
+			var inits []string
+			defer func(f func(context.Context, *MySQL, map[string]interface{}, bool) error) {
+				initializeProducer = f
+			}(initializeProducer)
+			initializeProducer = func(_ context.Context, m *MySQL, config map[string]interface{}, verify bool) error {
+				m.Password = config["password"].(string)
+				inits = append(inits, fmt.Sprintf("%s verify=%t", label(m.Password), verify))
+				m.db = sql.OpenDB(d)
+				m.Initialized = true
+				if verify {
+					return test.verifyErr
+				}
+				return nil
+			}
+
+			req := dbplugin.InitializeRequest{
+				Config: map[string]interface{}{
+					"connection_url": "{{username}}:{{password}}@tcp(localhost:3306)/",
+					"username":       "vault",
+					"password":       "bootstrap",
+					"rotate_on_init": true,
+				},
+				VerifyConnection: true,
+			}
+			config, err := db.rotateOnInit(context.Background(), req)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			var alters []string
+			for _, call := range d.calls() {
+				prefix := "exec: ALTER USER 'vault'@'%' IDENTIFIED BY '"
+				if strings.HasPrefix(call, prefix) {
+					alters = append(alters, label(strings.TrimSuffix(strings.TrimPrefix(call, prefix), "'")))
+				}
+			}
+			if !reflect.DeepEqual(alters, test.expectedAlter) {
+				t.Fatalf("expected password changes: %v, got: %v", test.expectedAlter, alters)
+			}
+			if !reflect.DeepEqual(inits, test.expectedInits) {
+				t.Fatalf("expected initializations: %v, got: %v", test.expectedInits, inits)
+			}
+
+			if test.expectErr {
+				if strings.Contains(err.Error(), newPassword) {
+					t.Fatalf("error contains the rotated password: %s", err)
+				}
+				if db.Password != "bootstrap" {
+					t.Fatalf("expected the producer to use the bootstrap password again")
+				}
+				return
+			}
+			if config["password"] != newPassword || config["rotate_on_init"] != false {
+				t.Fatalf("unexpected config: %v", config)
+			}
+			if req.Config["password"] != "bootstrap" {
+				t.Fatalf("request config modified: %v", req.Config)
+			}
+		})
+	}
+}
+
+func TestMySQL_userHostStatements(t *testing.T) {
+	type testCase struct {
+		run      func(ctx context.Context, db *MySQL, username string) error
+		expected string
+	}
+
+	tests := map[string]testCase{
+		"rotation": {
+			run: func(ctx context.Context, db *MySQL, username string) error {
+				_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+					Username: username,
+					Password: &dbplugin.ChangePassword{NewPassword: "newsecret"},
+				})
+				return err
+			},
+			expected: "ALTER USER '{{name}}'@'10.0.%' IDENTIFIED BY 'newsecret'",
+		},
+		"lock": {
+			expected: "ALTER USER '{{name}}'@'10.0.%' ACCOUNT LOCK",
+		},
+		"unlock": {
+			run: func(ctx context.Context, db *MySQL, username string) error {
+				return db.UnlockUser(ctx, username)
+			},
+			expected: "ALTER USER '{{name}}'@'10.0.%' ACCOUNT UNLOCK",
+		},
+		"expire password": {
+			run: func(ctx context.Context, db *MySQL, username string) error {
+				return db.ExpirePassword(ctx, username)
+			},
+			expected: "ALTER USER '{{name}}'@'10.0.%' PASSWORD EXPIRE",
+		},
+		"sweeper expiration": {
+			expected: "ALTER USER '{{name}}'@'10.0.%' ATTRIBUTE",
+		},
+		"user grants": {
+			run: func(ctx context.Context, db *MySQL, username string) error {
+				_, err := db.UserGrants(ctx, username)
+				return err
+			},
+			expected: "SHOW GRANTS FOR '{{name}}'@'10.0.%'",
+		},
+		"connection user rotation": {
+			run: func(ctx context.Context, db *MySQL, username string) error {
+				_, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+					Username: db.Username,
+					Password: &dbplugin.ChangePassword{NewPassword: "newsecret"},
+				})
+				return err
+			},
+			expected: "ALTER USER 'vaultadmin'@'%' IDENTIFIED BY 'newsecret'",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{"8.0.32"}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.Username = "vaultadmin"
+			db.UserHost = "10.0.%"
+			db.UsernamePrefix = "v_"
+			db.RotationSyntax = rotationSyntaxAlterUser
+			db.CreateLocked = true
+			db.AllowExpirePassword = true
+			db.expiredUserSweepInterval = time.Hour
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'{{host}}' IDENTIFIED BY '{{password}}'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if test.run != nil {
+				if err := test.run(context.Background(), db, resp.Username); err != nil {
+					t.Fatalf("no error expected, got: %s", err)
+				}
+			}
+
+			expected := strings.Replace(test.expected, "{{name}}", resp.Username, 1)
+			for _, call := range d.calls() {
+				if strings.Contains(call, expected) {
+					return
+				}
+			}
+			t.Fatalf("expected %q in calls:\n%s", expected, strings.Join(d.calls(), "\n"))
+		})
+	}
+}
+
+func TestMySQL_defaultStatementsEscapeValues(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.RotationSyntax = rotationSyntaxAlterUser
+
+	err := db.changeUserPassword(context.Background(), `v_o'test`, `pa'ss\word`, nil)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: `v_o'test`})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		`exec: ALTER USER 'v_o\'test'@'%' IDENTIFIED BY 'pa\'ss\\word'`,
+		`exec: REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'v_o\'test'@'%'`,
+		`exec: DROP USER 'v_o\'test'@'%'`,
+	}
+	calls := d.calls()
+	for _, call := range expected {
+		if !strutil.StrListContains(calls, call) {
+			t.Fatalf("expected %q in calls:\n%s", call, strings.Join(calls, "\n"))
+		}
+	}
+}
+
+func TestMySQL_sessionLabels(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.CreationSessionLabel = "vault-create"
+	db.RevocationSessionLabel = "vault-revoke"
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "test",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{
+		Username: resp.Username,
+		Statements: dbplugin.Statements{
+			Commands: []string{"DROP USER '{{name}}'@'%'"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		"exec: " + setSessionLabelSQL,
+		"begin",
+		fmt.Sprintf("prepare: CREATE USER '%s'@'%%' IDENTIFIED BY 'secret'", resp.Username),
+		fmt.Sprintf("exec: CREATE USER '%s'@'%%' IDENTIFIED BY 'secret'", resp.Username),
+		"commit",
+		"exec: " + resetSessionLabelSQL,
+		"exec: " + setSessionLabelSQL,
+		"begin",
+		fmt.Sprintf("exec: DROP USER '%s'@'%%'", resp.Username),
+		"commit",
+		"exec: " + resetSessionLabelSQL,
+	}
+	if actual := d.calls(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestMySQL_ExpirePassword(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+
+	if err := db.ExpirePassword(context.Background(), "v_test"); err == nil {
+		t.Fatalf("expected error without allow_expire_password")
+	}
+	if len(d.calls()) != 0 {
+		t.Fatalf("expected no calls, got: %v", d.calls())
+	}
+
+	db.AllowExpirePassword = true
+	if err := db.ExpirePassword(context.Background(), `v_o'test`); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := `exec: ALTER USER 'v_o\'test'@'%' PASSWORD EXPIRE`
+	if !strutil.StrListContains(d.calls(), expected) {
+		t.Fatalf("expected %q in calls: %v", expected, d.calls())
+	}
+}
+
+func TestMySQL_NewUser_requireTLS(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.RequireTLS = "ssl"
+	db.RoleRequireTLS = map[string]string{"partner": "x509"}
+
+	for _, role := range []string{"app", "partner"} {
+		req := dbplugin.NewUserRequest{
+			UsernameConfig: dbplugin.UsernameMetadata{
+				DisplayName: "test",
+				RoleName:    role,
+			},
+			Statements: dbplugin.Statements{
+				Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' {{require_tls}}"},
+			},
+			Password:   "secret",
+			Expiration: time.Now().Add(time.Minute),
+		}
+		if _, err := db.NewUser(context.Background(), req); err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+	}
+
+	var clauses []string
+	for _, call := range d.calls() {
+		if strings.HasPrefix(call, "exec: CREATE USER") {
+			clauses = append(clauses, call[strings.Index(call, "REQUIRE"):])
+		}
+	}
+	expected := []string{"REQUIRE SSL", "REQUIRE X509"}
+	if !reflect.DeepEqual(clauses, expected) {
+		t.Fatalf("expected %v, got %v", expected, clauses)
+	}
+}
+
+func TestMySQL_NewUser_passwordLifetime(t *testing.T) {
+	type testCase struct {
+		version   string
+		role      string
+		expected  string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"default lifetime": {
+			version:  "8.0.23",
+			role:     "app",
+			expected: "PASSWORD EXPIRE INTERVAL 90 DAY",
+		},
+		"role lifetime": {
+			version:  "8.0.23",
+			role:     "partner",
+			expected: "PASSWORD EXPIRE INTERVAL 30 DAY",
+		},
+		"role without lifetime": {
+			version:  "5.6.51-log",
+			role:     "legacy",
+			expected: "",
+		},
+		"unsupported server": {
+			version:   "5.6.51-log",
+			role:      "app",
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{test.version}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.PasswordLifetimeDays = 90
+			db.RolePasswordLifetimeDays = map[string]int{"partner": 30, "legacy": 0}
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    test.role,
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' {{password_lifetime}}"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			expected := fmt.Sprintf("exec: CREATE USER '%s'@'%%' IDENTIFIED BY 'secret' %s", resp.Username, test.expected)
+			if !strutil.StrListContains(d.calls(), expected) {
+				t.Fatalf("expected %q in calls:\n%s", expected, strings.Join(d.calls(), "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_externalAuth(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.RoleExternalAuth = map[string]string{"ldap": "mysql'pam"}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "ldap",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED WITH auth_pam AS '{{auth_string}}'"},
+		},
+		Expiration: time.Now().Add(time.Minute),
+	}
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := fmt.Sprintf(`exec: CREATE USER '%s'@'%%' IDENTIFIED WITH auth_pam AS 'mysql\'pam'`, resp.Username)
+	if !strutil.StrListContains(d.calls(), expected) {
+		t.Fatalf("expected %q in calls:\n%s", expected, strings.Join(d.calls(), "\n"))
+	}
+
+	// Other roles still require a password
+	req.UsernameConfig.RoleName = "app"
+	if _, err := db.NewUser(context.Background(), req); err == nil {
+		t.Fatalf("err expected, got nil")
+	}
+}
+
+func TestMySQL_rotationSyntax(t *testing.T) {
+	type testCase struct {
+		syntax   string
+		version  string
+		expected string
+	}
+
+	alterUser := "exec: ALTER USER 'v_test'@'%' IDENTIFIED BY 'secret'"
+	setPassword := "exec: SET PASSWORD FOR 'v_test'@'%' = PASSWORD('secret')"
+
+	tests := map[string]testCase{
+		"alter_user": {
+			syntax:   rotationSyntaxAlterUser,
+			version:  "5.6.51-log",
+			expected: alterUser,
+		},
+		"set_password": {
+			syntax:   rotationSyntaxSetPassword,
+			version:  "8.0.23",
+			expected: setPassword,
+		},
+		"detected mysql 8": {
+			version:  "8.0.23",
+			expected: alterUser,
+		},
+		"detected mysql 5.6": {
+			version:  "5.6.51-log",
+			expected: setPassword,
+		},
+		"detected mariadb 10.1": {
+			version:  "10.1.48-MariaDB",
+			expected: setPassword,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{test.version}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.RotationSyntax = test.syntax
+
+			if err := db.changeUserPassword(context.Background(), "v_test", "secret", nil); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			if !strutil.StrListContains(d.calls(), test.expected) {
+				t.Fatalf("expected %q in calls: %v", test.expected, d.calls())
+			}
+		})
+	}
+}
+
+func TestMySQL_createLocked(t *testing.T) {
+	type testCase struct {
+		version   string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"mysql 8":      {version: "8.0.23"},
+		"mysql 5.6":    {version: "5.6.51-log", expectErr: true},
+		"mariadb 10.3": {version: "10.3.27-MariaDB", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{test.version}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.RoleCreateLocked = map[string]bool{"staged": true}
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "staged",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				if err := db.UnlockUser(context.Background(), "v_test"); err == nil {
+					t.Fatalf("err expected from UnlockUser, got nil")
+				}
+				for _, call := range d.calls() {
+					if strings.HasPrefix(call, "exec:") {
+						t.Fatalf("expected nothing to be executed, got: %v", d.calls())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if err := db.UnlockUser(context.Background(), resp.Username); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			for _, expected := range []string{
+				fmt.Sprintf("exec: ALTER USER '%s'@'%%' ACCOUNT LOCK", resp.Username),
+				fmt.Sprintf("exec: ALTER USER '%s'@'%%' ACCOUNT UNLOCK", resp.Username),
+			} {
+				if !strutil.StrListContains(d.calls(), expected) {
+					t.Fatalf("expected %q in calls: %v", expected, d.calls())
+				}
+			}
+		})
+	}
+}
+
+func TestSupportsAlterUser(t *testing.T) {
+	tests := map[string]bool{
+		"8.0.23":             true,
+		"5.7.6":              true,
+		"5.7.5":              false,
+		"5.6.51-log":         false,
+		"10.2.36-MariaDB":    true,
+		"10.1.48-MariaDB":    false,
+		"5.7.33-0ubuntu0.18": true,
+		"unknown":            true,
+	}
+
+	for version, expected := range tests {
+		if actual := supportsAlterUser(version); actual != expected {
+			t.Fatalf("supportsAlterUser(%q) = %t, expected %t", version, actual, expected)
+		}
+	}
+}
+
+func TestMaxUsernameLength(t *testing.T) {
+	tests := map[string]int{
+		"8.0.23":          32,
+		"5.7.8":           32,
+		"5.7.7":           16,
+		"5.6.51-log":      16,
+		"10.5.8-MariaDB":  80,
+		"10.1.48-MariaDB": 80,
+		"unknown":         32,
+	}
+
+	for version, expected := range tests {
+		if actual := maxUsernameLength(version); actual != expected {
+			t.Fatalf("maxUsernameLength(%q) = %d, expected %d", version, actual, expected)
+		}
+	}
+}
+
+func TestMySQL_DeleteUser_canceled(t *testing.T) {
+	for _, mode := range []string{executionModeTransaction, executionModeAutocommit} {
+		t.Run(mode, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d := &fakeDriver{
+				onExec: func(query string) {
+					if strings.HasPrefix(query, "REVOKE") {
+						cancel()
+					}
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.ExecutionMode = mode
+
+			req := dbplugin.DeleteUserRequest{
+				Username: "v_test",
+				Statements: dbplugin.Statements{
+					Commands: []string{"REVOKE ALL PRIVILEGES ON *.* FROM '{{name}}'@'%'; DROP USER '{{name}}'@'%'"},
+				},
+			}
+			_, err := db.DeleteUser(ctx, req)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got: %v", err)
+			}
+
+			for _, call := range d.calls() {
+				if strings.HasPrefix(call, "exec: DROP") || call == "commit" {
+					t.Fatalf("unexpected %q after cancellation, calls: %v", call, d.calls())
+				}
+			}
+		})
+	}
+}
+
+func TestMySQL_DeleteUser_revocationStatementTimeout(t *testing.T) {
+	d := &fakeDriver{
+		onExec: func(query string) {
+			if strings.HasPrefix(query, "REVOKE") {
+				time.Sleep(50 * time.Millisecond)
+			}
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.revocationStatementTimeout = 10 * time.Millisecond
+
+	_, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "v_test"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the revocation to time out, got: %v", err)
+	}
+	for _, call := range d.calls() {
+		if strings.HasPrefix(call, "exec: DROP USER") {
+			t.Fatalf("expected no statements after the timeout, got: %v", d.calls())
+		}
+	}
+}
+
+func TestMySQL_userHost(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.UserHost = "%"
+	db.RoleUserHost = map[string]string{"app": "10.0.%"}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'{{host}}' IDENTIFIED BY '{{password}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: resp.Username})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("exec: CREATE USER '%s'@'10.0.%%' IDENTIFIED BY 'secret'", resp.Username),
+		fmt.Sprintf("exec: DROP USER '%s'@'10.0.%%'", resp.Username),
+	}
+	for _, call := range expected {
+		if !strutil.StrListContains(d.calls(), call) {
+			t.Fatalf("expected %q in calls: %v", call, d.calls())
+		}
+	}
+}
+
+func TestMySQL_passwordAllowedCharacters(t *testing.T) {
+	type testCase struct {
+		password  string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"allowed":    {password: "Abc-123"},
+		"disallowed": {password: "Abc$123", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.PasswordAllowedCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-"
+
+			newReq := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+				},
+				Password:   test.password,
+				Expiration: time.Now().Add(time.Minute),
+			}
+			_, newErr := db.NewUser(context.Background(), newReq)
+
+			updateReq := dbplugin.UpdateUserRequest{
+				Username: "v_test",
+				Password: &dbplugin.ChangePassword{
+					NewPassword: test.password,
+					Statements: dbplugin.Statements{
+						Commands: []string{"ALTER USER '{{username}}'@'%' IDENTIFIED BY '{{password}}'"},
+					},
+				},
+			}
+			_, updateErr := db.UpdateUser(context.Background(), updateReq)
+
+			for _, err := range []error{newErr, updateErr} {
+				if test.expectErr && err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				if !test.expectErr && err != nil {
+					t.Fatalf("no error expected, got: %s", err)
+				}
+			}
+			if test.expectErr && len(d.calls()) > 0 {
+				t.Fatalf("expected no statements, got: %v", d.calls())
+			}
+		})
+	}
+}
+
+func TestMySQL_recordGrants(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.RecordGrants = true
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT SELECT ON app.* TO '{{name}}'@'%';`,
+			},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	deleteReq := dbplugin.DeleteUserRequest{
+		Username: resp.Username,
+		Statements: dbplugin.Statements{
+			Commands: []string{"{{revoke_grants}}; DROP USER '{{name}}'@'{{host}}'"},
+		},
+	}
+	if _, err := db.DeleteUser(context.Background(), deleteReq); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := fmt.Sprintf("exec: REVOKE SELECT ON app.* FROM '%s'@'%%'", resp.Username)
+	if !strutil.StrListContains(d.calls(), expected) {
+		t.Fatalf("expected %q in calls: %v", expected, d.calls())
+	}
+}
+
+func TestMySQL_dropUserRole(t *testing.T) {
+	type testCase struct {
+		commands []string
+		expected bool
+	}
+
+	tests := map[string]testCase{
+		"role created": {
+			commands: []string{`
+				CREATE ROLE '{{name}}_role';
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT '{{name}}_role' TO '{{name}}'@'%';`,
+			},
+			expected: true,
+		},
+		"no role": {
+			commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.DropUserRole = true
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: test.commands,
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			deleteReq := dbplugin.DeleteUserRequest{
+				Username: resp.Username,
+			}
+			if _, err := db.DeleteUser(context.Background(), deleteReq); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			dropRole := fmt.Sprintf("exec: DROP ROLE IF EXISTS '%s_role'", resp.Username)
+			if actual := strutil.StrListContains(d.calls(), dropRole); actual != test.expected {
+				t.Fatalf("expected %q in calls to be %t: %v", dropRole, test.expected, d.calls())
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_pastExpiration(t *testing.T) {
+	type testCase struct {
+		policy    string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"default": {policy: "", expectErr: true},
+		"reject":  {policy: pastExpirationReject, expectErr: true},
+		"clamp":   {policy: pastExpirationClamp},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.PastExpiration = test.policy
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' COMMENT '{{ttl_seconds}}'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(-time.Hour),
+			}
+			_, err := db.NewUser(context.Background(), req)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				if len(d.calls()) > 0 {
+					t.Fatalf("expected no statements, got: %v", d.calls())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			var ttl string
+			for _, call := range d.calls() {
+				if i := strings.Index(call, "COMMENT '"); i >= 0 {
+					ttl = strings.TrimSuffix(call[i+len("COMMENT '"):], "'")
+				}
+			}
+			if ttl == "0" || ttl == "" {
+				t.Fatalf("expected a positive ttl, got: %v", d.calls())
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_defaultSchema(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.DefaultSchema = "app"
+	db.RoleDefaultSchema = map[string]string{"reporting": "reports"}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "reporting",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT SELECT ON {{default_schema}}.* TO '{{name}}'@'%';`,
+			},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	resp, err := db.NewUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := fmt.Sprintf("exec: GRANT SELECT ON reports.* TO '%s'@'%%'", resp.Username)
+	if !strutil.StrListContains(d.calls(), expected) {
+		t.Fatalf("expected %q in calls: %v", expected, d.calls())
+	}
+	if md, _ := db.UserMetadata(resp.Username); md[metadataSchema] != "reports" {
+		t.Fatalf("expected the default schema in metadata, got: %#v", md)
+	}
+}
+
+func TestMySQL_NewUser_postCreationStatements(t *testing.T) {
+	type testCase struct {
+		split    bool
+		role     string
+		expected []string
+	}
+
+	tests := map[string]testCase{
+		"same transaction": {
+			role: "app",
+			expected: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: CREATE SCHEMA v_test",
+				"commit",
+			},
+		},
+		"split": {
+			role:  "app",
+			split: true,
+			expected: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"commit",
+				"begin",
+				"exec: CREATE SCHEMA v_test",
+				"commit",
+			},
+		},
+		"role override": {
+			role: "reporting",
+			expected: []string{
+				"begin",
+				"exec: CREATE USER 'v_test'@'%'",
+				"exec: GRANT SELECT ON reports.* TO 'v_test'@'%'",
+				"commit",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.PostCreationStatements = []string{"CREATE SCHEMA {{name}}"}
+			db.RolePostCreationStatements = map[string][]string{
+				"reporting": {"GRANT SELECT ON reports.* TO '{{name}}'@'%'"},
+			}
+			db.SplitPostCreation = test.split
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    test.role,
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			var actual []string
+			for _, call := range d.calls() {
+				if !strings.HasPrefix(call, "prepare: ") {
+					actual = append(actual, strings.ReplaceAll(call, resp.Username, "v_test"))
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_creationDelay(t *testing.T) {
+	type testCase struct {
+		delay       time.Duration
+		cancelAfter time.Duration
+		minElapsed  time.Duration
+		maxElapsed  time.Duration
+	}
+
+	tests := map[string]testCase{
+		"no delay": {
+			maxElapsed: time.Second,
+		},
+		"delayed": {
+			delay:      50 * time.Millisecond,
+			minElapsed: 50 * time.Millisecond,
+			maxElapsed: 5 * time.Second,
+		},
+		"canceled cuts the delay short": {
+			delay:       time.Minute,
+			cancelAfter: 10 * time.Millisecond,
+			maxElapsed:  5 * time.Second,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			db.creationDelay = test.delay
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelAfter > 0 {
+				time.AfterFunc(test.cancelAfter, cancel)
+			}
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "test",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			start := time.Now()
+			resp, err := db.NewUser(ctx, req)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if resp.Username == "" {
+				t.Fatalf("expected the created username to be returned")
+			}
+			if elapsed < test.minElapsed || elapsed > test.maxElapsed {
+				t.Fatalf("expected NewUser to take between %s and %s, took %s", test.minElapsed, test.maxElapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_ambiguousCommit(t *testing.T) {
+	type testCase struct {
+		verify    bool
+		commitErr error
+		count     int64
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"user exists": {
+			verify:    true,
+			commitErr: stdmysql.ErrInvalidConn,
+			count:     1,
+		},
+		"user missing": {
+			verify:    true,
+			commitErr: stdmysql.ErrInvalidConn,
+			expectErr: true,
+		},
+		"verification disabled": {
+			commitErr: stdmysql.ErrInvalidConn,
+			count:     1,
+			expectErr: true,
+		},
+		"commit rejected": {
+			verify:    true,
+			commitErr: &stdmysql.MySQLError{Number: 1213},
+			count:     1,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				commitErr: test.commitErr,
+				rows: map[string]fakeRows{
+					userExistsSQL: {
+						columns: []string{"COUNT(*)"},
+						values:  [][]driver.Value{{test.count}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.VerifyAmbiguousCommit = test.verify
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "test",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+				},
+				Password:   "secret",
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr {
+				if err != nil {
+					t.Fatalf("no error expected, got: %s", err)
+				}
+				if _, ok := db.UserMetadata(resp.Username); !ok {
+					t.Fatalf("expected metadata for %q", resp.Username)
+				}
+			}
+		})
+	}
+}
+
+func TestMySQL_generateUsername_reserved(t *testing.T) {
+	type testCase struct {
+		reserved []string
+		username string
+	}
+
+	// The display name fills the whole username, so every generated
+	// username is "v_crafted_accoun"
+	tests := map[string]testCase{
+		"reserved username": {reserved: []string{"root", "V_Crafted_Accoun"}},
+		"connection user":   {username: "v_crafted_accoun"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := new(false)
+			db.serverMaxUsernameLen = 16
+			db.ReservedUsernames = test.reserved
+			db.Username = test.username
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "crafted_account_name",
+					RoleName:    "app",
+				},
+			}
+			username, err := db.generateUsername(req)
+			if err == nil {
+				t.Fatalf("expected the reserved username to be rejected, got: %s", username)
+			}
+
+			req.UsernameConfig.DisplayName = "other"
+			if _, err := db.generateUsername(req); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestMySQL_DeleteUser_noopRevocation(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.RevocationMode = revocationModeNoop
+	db.metadata.put("v_test", userMetadata{metadataRoleName: "app"})
+
+	_, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{Username: "v_test"})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if calls := d.calls(); len(calls) > 0 {
+		t.Fatalf("expected no statements, got: %v", calls)
+	}
+	if _, ok := db.UserMetadata("v_test"); ok {
+		t.Fatalf("expected the user's metadata to be removed")
+	}
+}
+
+func TestMySQL_DeleteUser_verifyRevocation(t *testing.T) {
+	type testCase struct {
+		count     int64
+		err       error
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"user gone": {},
+		"user still exists": {
+			count:     1,
+			expectErr: true,
+		},
+		"mysql.user not readable": {
+			err: &stdmysql.MySQLError{Number: 1142},
+		},
+		"query failure": {
+			err:       &stdmysql.MySQLError{Number: 2013},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					userExistsSQL: {
+						columns: []string{"COUNT(*)"},
+						values:  [][]driver.Value{{test.count}},
+					},
+				},
+			}
+			if test.err != nil {
+				d.errs = map[string]error{userExistsSQL: test.err}
+			}
+			db := newFakeMySQL(t, d)
+			db.VerifyRevocation = true
+
+			req := dbplugin.DeleteUserRequest{
+				Username: "v_test",
+				Statements: dbplugin.Statements{
+					Commands: []string{"DROP USER '{{name}}'@'%'"},
+				},
+			}
+			_, err := db.DeleteUser(context.Background(), req)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestMySQL_DeleteUser_unrecordedMetadata(t *testing.T) {
+	type testCase struct {
+		statements []string
+		recorded   userMetadata
+		expected   []string
+	}
+
+	tests := map[string]testCase{
+		"recorded": {
+			statements: []string{"DROP SCHEMA app_{{role_name}}; DROP USER '{{name}}'@'{{host}}'"},
+			recorded:   userMetadata{metadataRoleName: "reader"},
+			expected: []string{
+				"exec: DROP SCHEMA app_reader",
+				"exec: DROP USER 'v_test'@'%'",
+			},
+		},
+		"not recorded": {
+			statements: []string{"DROP SCHEMA app_{{role_name}}; DROP USER '{{name}}'@'{{host}}'"},
+			expected: []string{
+				"exec: REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'v_test'@'%'",
+				"exec: DROP USER 'v_test'@'%'",
+			},
+		},
+		"grants not recorded": {
+			statements: []string{"{{revoke_grants}}; DROP USER '{{name}}'@'{{host}}'"},
+			expected: []string{
+				"exec: REVOKE ALL PRIVILEGES, GRANT OPTION FROM 'v_test'@'%'",
+				"exec: DROP USER 'v_test'@'%'",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+			if test.recorded != nil {
+				db.metadata.put("v_test", test.recorded)
+			}
+
+			req := dbplugin.DeleteUserRequest{
+				Username: "v_test",
+				Statements: dbplugin.Statements{
+					Commands: test.statements,
+				},
+			}
+			if _, err := db.DeleteUser(context.Background(), req); err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			var actual []string
+			for _, call := range d.calls() {
+				if strings.HasPrefix(call, "exec: ") {
+					actual = append(actual, call)
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
+
+func TestMySQL_isFallbackRevocationError(t *testing.T) {
+	type testCase struct {
+		codes    []int
+		err      error
+		expected bool
+	}
+
+	tests := map[string]testCase{
+		"default code": {
+			codes:    defaultFallbackRevocationErrorCodes,
+			err:      &stdmysql.MySQLError{Number: 1141},
+			expected: true,
+		},
+		"wrapped code": {
+			codes:    defaultFallbackRevocationErrorCodes,
+			err:      fmt.Errorf("revoke: %w", &stdmysql.MySQLError{Number: 1396}),
+			expected: true,
+		},
+		"unlisted code": {
+			codes:    []int{1141},
+			err:      &stdmysql.MySQLError{Number: 1396},
+			expected: false,
+		},
+		"not a mysql error": {
+			codes:    defaultFallbackRevocationErrorCodes,
+			err:      errors.New("connection refused"),
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := new(false)
+			db.FallbackRevocationErrorCodes = test.codes
+
+			actual := db.isFallbackRevocationError(test.err)
+			if actual != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMySQL_NewUser_passwordEscaped(t *testing.T) {
+	type testCase struct {
+		password string
+		expected string
+	}
+
+	tests := map[string]testCase{
+		"plain":           {password: "secret", expected: `secret`},
+		"single quote":    {password: `se'cret`, expected: `se\'cret`},
+		"backslash":       {password: `se\cret`, expected: `se\\cret`},
+		"quote injection": {password: `x'; DROP DATABASE app; --`, expected: `x\'; DROP DATABASE app; --`},
+		"trailing escape": {password: `secret\`, expected: `secret\\`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := newFakeMySQL(t, d)
+
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password_escaped}}'"},
+				},
+				Password:   test.password,
+				Expiration: time.Now().Add(time.Minute),
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			expected := fmt.Sprintf("exec: CREATE USER '%s'@'%%' IDENTIFIED BY '%s'", resp.Username, test.expected)
+			if !strutil.StrListContains(d.calls(), expected) {
+				t.Fatalf("expected %q in calls: %v", expected, d.calls())
+			}
+		})
+	}
+}
+
+func TestRedactPasswords(t *testing.T) {
+	password := "s3cr3t-pw"
+	values := passwordTemplateValues(password)
+
+	if values["password_base64"] != "czNjcjN0LXB3" {
+		t.Fatalf("unexpected base64 value: %s", values["password_base64"])
+	}
+	if values["password_hex"] != "7333637233742d7077" {
+		t.Fatalf("unexpected hex value: %s", values["password_hex"])
+	}
+
+	for name, value := range values {
+		err := fmt.Errorf("Error 1064: You have an error in your SQL syntax near '%s'", value)
+		actual := redactPasswords(err, password)
+		if strings.Contains(actual.Error(), value) {
+			t.Fatalf("%s was not redacted: %s", name, actual)
+		}
+	}
+
+	err := errors.New("connection refused")
+	if actual := redactPasswords(err, password); actual != err {
+		t.Fatalf("expected error without secrets to be returned unchanged")
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	tests := map[string]string{
+		"v_test":     "v_test",
+		"it's":       `it\'s`,
+		`back\slash`: `back\\slash`,
+		`\'`:         `\\\'`,
+	}
+
+	for input, expected := range tests {
+		if actual := escapeString(input); actual != expected {
+			t.Fatalf("escapeString(%q) = %q, expected %q", input, actual, expected)
+		}
+	}
+}
+
 func createTestMySQLUser(t *testing.T, connURL, username, password, query string) {
 	t.Helper()
 	db, err := sql.Open("mysql", connURL)
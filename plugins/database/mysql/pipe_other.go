@@ -0,0 +1,5 @@
+// +build !windows
+
+package mysql
+
+const namedPipeSupported = false
@@ -0,0 +1,19 @@
+// +build windows
+
+package mysql
+
+import (
+	"context"
+	"net"
+
+	winio "github.com/Microsoft/go-winio"
+	"github.com/go-sql-driver/mysql"
+)
+
+const namedPipeSupported = true
+
+func init() {
+	mysql.RegisterDialContext(namedPipeNet, func(ctx context.Context, addr string) (net.Conn, error) {
+		return winio.DialPipeContext(ctx, addr)
+	})
+}
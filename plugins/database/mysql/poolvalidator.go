@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// startPoolValidator starts pinging the idle pooled connections if a
+// pool_validation_interval is configured.
+func (m *MySQL) startPoolValidator() {
+	m.stopPoolValidator()
+	if m.poolValidationInterval <= 0 {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	m.poolValidatorStopCh = stopCh
+
+	go func() {
+		ticker := time.NewTicker(m.poolValidationInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				m.Lock()
+				db := m.db
+				m.Unlock()
+				if db == nil {
+					continue
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), m.poolValidationInterval)
+				checked, failed, err := validatePool(ctx, db)
+				cancel()
+				if failed > 0 {
+					m.logger.Debug("retired pooled connections that failed validation", "checked", checked, "failed", failed)
+				}
+				// Only a pool whose every connection failed is unhealthy
+				switch {
+				case checked == 0:
+				case failed == checked:
+					m.reportHealth(err)
+				default:
+					m.reportHealth(nil)
+				}
+			}
+		}
+	}()
+}
+
+// stopPoolValidator stops the pool validator if it is running.
+func (m *MySQL) stopPoolValidator() {
+	if m.poolValidatorStopCh != nil {
+		close(m.poolValidatorStopCh)
+		m.poolValidatorStopCh = nil
+	}
+}
+
+// validatePool pings each connection that is idle in db and returns the
+// number of connections checked, the number that failed and the last ping
+// error. The checked
+// connections are held until all of them were pinged so no connection is
+// checked twice. database/sql discards a connection whose ping reports it
+// broken instead of returning it to the pool.
+func validatePool(ctx context.Context, db *sql.DB) (int, int, error) {
+	idle := db.Stats().Idle
+
+	conns := make([]*sql.Conn, 0, idle)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	failed := 0
+	var lastErr error
+	for i := 0; i < idle; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			break
+		}
+		conns = append(conns, conn)
+
+		if err := conn.PingContext(ctx); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	return len(conns), failed, lastErr
+}
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestValidatePool(t *testing.T) {
+	type testCase struct {
+		pingErr      error
+		expectFailed int
+		expectIdle   int
+	}
+
+	tests := map[string]testCase{
+		"healthy connections stay pooled": {
+			expectIdle: 3,
+		},
+		"broken connections are retired": {
+			pingErr:      driver.ErrBadConn,
+			expectFailed: 3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{}
+			db := sql.OpenDB(d)
+			defer db.Close()
+			db.SetMaxIdleConns(3)
+
+			// Fill the pool with idle connections
+			ctx := context.Background()
+			var conns []*sql.Conn
+			for i := 0; i < 3; i++ {
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				conns = append(conns, conn)
+			}
+			for _, conn := range conns {
+				conn.Close()
+			}
+
+			d.pingErr = test.pingErr
+			checked, failed, _ := validatePool(ctx, db)
+			if checked != 3 {
+				t.Fatalf("expected 3 connections checked, got %d", checked)
+			}
+			if failed != test.expectFailed {
+				t.Fatalf("expected %d failed connections, got %d", test.expectFailed, failed)
+			}
+			if idle := db.Stats().Idle; idle != test.expectIdle {
+				t.Fatalf("expected %d idle connections, got %d", test.expectIdle, idle)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package mysql
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// broadGrantPatterns match grants that give more than a dynamic user should
+// normally need. The key describes the match without echoing the statement,
+// which may contain the password.
+var broadGrantPatterns = map[string]*regexp.Regexp{
+	"grants ALL PRIVILEGES":      regexp.MustCompile(`(?i)\bGRANT\s+ALL\b`),
+	"grants on all databases":    regexp.MustCompile(`(?i)\bGRANT\b.+\bON\s+\*\.\*`),
+	"grants WITH GRANT OPTION":   regexp.MustCompile(`(?i)\bWITH\s+GRANT\s+OPTION\b`),
+	"grants the SUPER privilege": regexp.MustCompile(`(?i)\bGRANT\b.*\bSUPER\b.*\bON\b`),
+}
+
+// broadGrants renders the statements with queryMap and returns a
+// description of every overly broad grant pattern found in them. The
+// password is left out of the rendering so it can't cause a false match.
+func broadGrants(statements []string, queryMap map[string]string) []string {
+	renderMap := make(map[string]string, len(queryMap))
+	for k, v := range queryMap {
+		if k != "password" {
+			renderMap[k] = v
+		}
+	}
+
+	var found []string
+	for _, query := range renderQueries(statements, renderMap) {
+		for desc, pattern := range broadGrantPatterns {
+			if pattern.MatchString(query) && !strutil.StrListContains(found, desc) {
+				found = append(found, desc)
+			}
+		}
+	}
+	return found
+}
+
+// requireTLSClause renders a require_tls value as the REQUIRE clause of
+// CREATE USER: "none", "ssl", "x509" or "subject=<distinguished name>". An
+// empty value renders as an empty clause.
+func requireTLSClause(value string) (string, error) {
+	switch {
+	case value == "":
+		return "", nil
+	case strings.EqualFold(value, "none"):
+		return "REQUIRE NONE", nil
+	case strings.EqualFold(value, "ssl"):
+		return "REQUIRE SSL", nil
+	case strings.EqualFold(value, "x509"):
+		return "REQUIRE X509", nil
+	case len(value) > len("subject=") && strings.EqualFold(value[:len("subject=")], "subject="):
+		return fmt.Sprintf("REQUIRE SUBJECT '%s'", escapeString(value[len("subject="):])), nil
+	default:
+		return "", fmt.Errorf("invalid require_tls %q, must be none, ssl, x509 or subject=<name>", value)
+	}
+}
+
+// maxPasswordLifetimeDays is the largest interval PASSWORD EXPIRE INTERVAL
+// accepts
+const maxPasswordLifetimeDays = 65535
+
+// passwordLifetimeClause renders password_lifetime_days as the PASSWORD
+// EXPIRE INTERVAL clause of CREATE USER. Zero renders as an empty clause.
+func passwordLifetimeClause(days int) (string, error) {
+	switch {
+	case days == 0:
+		return "", nil
+	case days < 0 || days > maxPasswordLifetimeDays:
+		return "", fmt.Errorf("invalid password_lifetime_days %d, must be between 0 and %d", days, maxPasswordLifetimeDays)
+	default:
+		return fmt.Sprintf("PASSWORD EXPIRE INTERVAL %d DAY", days), nil
+	}
+}
+
+// maxUserHostLength is the longest host part of an account name MySQL
+// accepts
+const maxUserHostLength = 255
+
+// userHostChars matches a host name or IP address, optionally with the %
+// and _ wildcards
+var userHostChars = regexp.MustCompile(`^[A-Za-z0-9.:%_-]+$`)
+
+// validateUserHost returns an error if host isn't a legal host part of an
+// account name: a host name or IP address with optional wildcards, or an
+// IPv4 network given as address/netmask or address/prefix length.
+func validateUserHost(host string) error {
+	if host == "" || len(host) > maxUserHostLength {
+		return fmt.Errorf("invalid user_host %q, must be between 1 and %d characters", host, maxUserHostLength)
+	}
+
+	addr, mask := host, ""
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		addr, mask = host[:i], host[i+1:]
+	}
+	if !userHostChars.MatchString(addr) {
+		return fmt.Errorf("invalid user_host %q, must be a host name, IP address or network", host)
+	}
+	if mask == "" && !strings.HasSuffix(host, "/") {
+		return nil
+	}
+
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		return fmt.Errorf("invalid user_host %q, a network must have an IPv4 address", host)
+	}
+	var ipNet *net.IPNet
+	if prefix, err := strconv.Atoi(mask); err == nil && prefix >= 0 && prefix <= 32 {
+		ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(prefix, 32)}
+	} else if m := net.ParseIP(mask).To4(); m != nil {
+		ipNet = &net.IPNet{IP: ip, Mask: net.IPMask(m)}
+		if _, bits := ipNet.Mask.Size(); bits == 0 {
+			return fmt.Errorf("invalid user_host %q, netmask %q isn't contiguous", host, mask)
+		}
+	} else {
+		return fmt.Errorf("invalid user_host %q, %q is not a netmask or prefix length", host, mask)
+	}
+	if !ip.Equal(ip.Mask(ipNet.Mask)) {
+		return fmt.Errorf("invalid user_host %q, address has bits set outside of the network", host)
+	}
+	return nil
+}
+
+// grantPattern matches a privilege grant as listed by SHOW GRANTS, capturing
+// the privileges, the level they are granted on and the grant option.
+var grantPattern = regexp.MustCompile(`(?is)^GRANT\s+(.+?)\s+ON\s+(\S+)\s+TO\s+.*?(\bWITH\s+GRANT\s+OPTION)?\s*$`)
+
+// missingPrivileges returns the required global privileges that none of the
+// SHOW GRANTS rows hold. GRANT OPTION is held if it is granted on any level.
+func missingPrivileges(grants []string, required []string) []string {
+	held := map[string]bool{}
+	for _, grant := range grants {
+		match := grantPattern.FindStringSubmatch(strings.TrimSpace(grant))
+		if match == nil {
+			continue
+		}
+		if match[3] != "" {
+			held["GRANT OPTION"] = true
+		}
+		if strings.Trim(match[2], "`") != "*.*" {
+			continue
+		}
+		for _, priv := range strings.Split(match[1], ",") {
+			priv = normalizeStatement(priv)
+			if i := strings.IndexByte(priv, '('); i >= 0 {
+				priv = strings.TrimSpace(priv[:i])
+			}
+			held[priv] = true
+		}
+	}
+
+	var missing []string
+	for _, priv := range required {
+		if held[priv] || (priv != "GRANT OPTION" && (held["ALL"] || held["ALL PRIVILEGES"])) {
+			continue
+		}
+		missing = append(missing, priv)
+	}
+	return missing
+}
+
+// grantLevelPattern matches privilege grants, capturing the level they are
+// granted on. Role grants have no ON clause.
+var grantLevelPattern = regexp.MustCompile(`(?is)^GRANT\s+.+?\s+ON\s+(?:(?:TABLE|FUNCTION|PROCEDURE)\s+)?(.+?)\s+TO\s`)
+
+// grantKeywordPattern matches the GRANT keyword anywhere in a statement
+var grantKeywordPattern = regexp.MustCompile(`(?i)\bGRANT\b`)
+
+// onClausePattern matches the ON clause of a privilege grant
+var onClausePattern = regexp.MustCompile(`(?is)\sON\s`)
+
+// checkGrantSchemas returns an error for the first query granting privileges
+// outside of the allowed schemas. An entry ending in * allows every schema
+// starting with the rest of it, and * alone allows every schema including
+// global grants. Levels without a schema, which grant on the default
+// database, are rejected. An empty allow-list permits every grant.
+//
+// Leading comments are skipped. Any other statement mentioning GRANT whose
+// level can't be parsed is rejected, so the check fails closed like
+// checkStatementVerbs. Role grants have no level and are permitted.
+func checkGrantSchemas(queries []string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	for _, query := range queries {
+		query = stripLeadingComments(query)
+		match := grantLevelPattern.FindStringSubmatch(query)
+		if match == nil {
+			if grantKeywordPattern.MatchString(query) && !isRoleGrant(query) {
+				return fmt.Errorf("statement grants privileges on a level schema_allow_list can't check")
+			}
+			continue
+		}
+		schema, ok := grantSchema(match[1])
+		if !ok || !schemaAllowed(schema, allowed) {
+			return fmt.Errorf("grant on %s is not permitted by schema_allow_list", match[1])
+		}
+	}
+	return nil
+}
+
+// isRoleGrant reports whether query grants roles, which has no ON clause.
+func isRoleGrant(query string) bool {
+	return strings.HasPrefix(normalizeStatement(query), "GRANT ") && !onClausePattern.MatchString(query)
+}
+
+// grantSchema returns the schema of a grant level like `app`.* or app.orders,
+// "*" for global grants. ok is false if the level names no schema.
+func grantSchema(level string) (schema string, ok bool) {
+	var rest string
+	if strings.HasPrefix(level, "`") {
+		// Backticks inside a quoted name are doubled
+		i := 1
+		for {
+			end := strings.IndexByte(level[i:], '`')
+			if end < 0 {
+				return "", false
+			}
+			i += end
+			if strings.HasPrefix(level[i:], "``") {
+				i += 2
+				continue
+			}
+			break
+		}
+		schema = strings.Replace(level[1:i], "``", "`", -1)
+		rest = level[i+1:]
+	} else {
+		i := strings.IndexByte(level, '.')
+		if i < 0 {
+			return "", false
+		}
+		schema, rest = level[:i], level[i:]
+	}
+
+	if !strings.HasPrefix(rest, ".") {
+		return "", false
+	}
+	return schema, true
+}
+
+// schemaAllowed reports whether the grant schema is covered by one of the
+// allowed entries. An unescaped % in a database level grant is a wildcard,
+// so such a schema is only covered by entries ending in * whose prefix it
+// keeps before the wildcard. An unescaped _ is compared literally, since
+// it is almost always meant as part of the name.
+func schemaAllowed(schema string, allowed []string) bool {
+	literal, wildcard := unescapeSchema(schema)
+	for _, entry := range allowed {
+		switch {
+		case entry == "*":
+			return true
+		case schema == "*":
+			continue
+		case strings.HasSuffix(entry, "*"):
+			if strings.HasPrefix(literal, strings.TrimSuffix(entry, "*")) {
+				return true
+			}
+		case !wildcard && literal == entry:
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeSchema removes the backslash escapes of _ and % from a grant
+// schema. If it holds an unescaped %, only the part before it is returned
+// and wildcard is true.
+func unescapeSchema(schema string) (literal string, wildcard bool) {
+	var b strings.Builder
+	for i := 0; i < len(schema); i++ {
+		switch {
+		case schema[i] == '\\' && i+1 < len(schema) && (schema[i+1] == '_' || schema[i+1] == '%'):
+			i++
+			b.WriteByte(schema[i])
+		case schema[i] == '%':
+			return b.String(), true
+		default:
+			b.WriteByte(schema[i])
+		}
+	}
+	return b.String(), false
+}
+
+// revokeGrantsTemplate expands to a REVOKE statement per recorded grant
+// when it makes up a whole revocation statement
+const revokeGrantsTemplate = "{{revoke_grants}}"
+
+// grantSummary returns the privileges granted by the GRANT statements among
+// queries as "<privileges> ON <level>" entries separated by semicolons,
+// e.g. "SELECT, INSERT ON app.*;SELECT, GRANT OPTION ON reports.orders".
+// Role grants, which have no ON clause, aren't included.
+func grantSummary(queries []string) string {
+	var grants []string
+	for _, query := range queries {
+		match := grantPattern.FindStringSubmatch(strings.TrimSpace(query))
+		if match == nil {
+			continue
+		}
+		privileges := strings.Join(strings.Fields(match[1]), " ")
+		if match[3] != "" {
+			privileges += ", GRANT OPTION"
+		}
+		grants = append(grants, privileges+" ON "+match[2])
+	}
+	return strings.Join(grants, ";")
+}
+
+// createRolePattern matches CREATE ROLE statements, capturing the roles
+var createRolePattern = regexp.MustCompile(`(?is)^CREATE\s+ROLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(.+?)\s*$`)
+
+// userRoles returns the roles created by the CREATE ROLE statements among
+// queries whose name contains username, separated by semicolons. Roles that
+// don't carry the username may be shared with other users and are left
+// out.
+func userRoles(queries []string, username string) string {
+	var roles []string
+	for _, query := range queries {
+		match := createRolePattern.FindStringSubmatch(strings.TrimSpace(query))
+		if match == nil {
+			continue
+		}
+		for _, role := range strings.Split(match[1], ",") {
+			role = strings.TrimSpace(role)
+			if strings.Contains(role, username) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return strings.Join(roles, ";")
+}
+
+// revokeAllGrantsStatement replaces {{revoke_grants}} when no grants are
+// recorded for the user
+const revokeAllGrantsStatement = "REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'{{host}}'"
+
+// expandRevokeGrants replaces each revocation statement that is only
+// {{revoke_grants}} with a REVOKE statement per grant recorded in
+// queryMap. Grants are only recorded in memory, so users created before the
+// plugin was last initialized have all of their privileges revoked instead.
+func expandRevokeGrants(statements []string, queryMap map[string]string) []string {
+	var expanded []string
+	for _, stmt := range statements {
+		if !strings.Contains(stmt, revokeGrantsTemplate) {
+			expanded = append(expanded, stmt)
+			continue
+		}
+
+		summary, recorded := queryMap[metadataGrants]
+		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
+			if strings.TrimSpace(query) != revokeGrantsTemplate {
+				expanded = append(expanded, query)
+				continue
+			}
+			if !recorded {
+				expanded = append(expanded, revokeAllGrantsStatement)
+				continue
+			}
+			for _, grant := range strings.Split(summary, ";") {
+				if grant == "" {
+					continue
+				}
+				expanded = append(expanded, "REVOKE "+grant+" FROM '{{name}}'@'{{host}}'")
+			}
+		}
+	}
+	return expanded
+}
+
+// revokeGrantPattern matches a privilege or proxy grant as listed by SHOW
+// GRANTS, capturing the privileges, the level they are granted on and the
+// grantee with anything that follows it
+var revokeGrantPattern = regexp.MustCompile(`(?is)^GRANT\s+(.+?)\s+ON\s+((?:(?:TABLE|FUNCTION|PROCEDURE)\s+)?\S+)\s+TO\s+(.*)$`)
+
+// quotedRole matches a role name as quoted by SHOW GRANTS. The host of a
+// role is optional, MariaDB doesn't list it.
+const quotedRole = "(?:`[^`]*`|'[^']*')(?:@(?:`[^`]*`|'[^']*'))?"
+
+// roleGrantPattern matches a role grant as listed by SHOW GRANTS, capturing
+// the roles
+var roleGrantPattern = regexp.MustCompile(`(?is)^GRANT\s+(` + quotedRole + `(?:\s*,\s*` + quotedRole + `)*)\s+TO\s`)
+
+// grantOptionPattern matches the grant option following the grantee
+var grantOptionPattern = regexp.MustCompile(`(?i)\bWITH\s+GRANT\s+OPTION\b`)
+
+// revokeStatements returns the REVOKE statements that take the SHOW GRANTS
+// rows away from account, a quoted 'user'@'host', and how many rows weren't
+// recognized. The USAGE grant every user has is skipped, as there is
+// nothing to revoke.
+func revokeStatements(grants []string, account string) (revokes []string, unrecognized int) {
+	for _, grant := range grants {
+		grant = strings.TrimSpace(grant)
+
+		if match := roleGrantPattern.FindStringSubmatch(grant); match != nil {
+			revokes = append(revokes, "REVOKE "+match[1]+" FROM "+account)
+			continue
+		}
+
+		match := revokeGrantPattern.FindStringSubmatch(grant)
+		if match == nil {
+			unrecognized++
+			continue
+		}
+		privileges := strings.Join(strings.Fields(match[1]), " ")
+		switch {
+		case strings.EqualFold(privileges, "PROXY"):
+			// Revoking the proxy privilege takes its grant option with it
+		case strings.EqualFold(privileges, "USAGE"):
+			if !grantOptionPattern.MatchString(match[3]) {
+				continue
+			}
+			privileges = "GRANT OPTION"
+		default:
+			if grantOptionPattern.MatchString(match[3]) {
+				privileges += ", GRANT OPTION"
+			}
+		}
+		revokes = append(revokes, "REVOKE "+privileges+" ON "+match[2]+" FROM "+account)
+	}
+	return revokes, unrecognized
+}
+
+// stripLeadingComments removes the whitespace and comments preceding the
+// first keyword of query. Executable comments like /*!50700 ... */ are kept,
+// since the server runs their contents.
+func stripLeadingComments(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n")
+		switch {
+		case strings.HasPrefix(query, "/*!"), strings.HasPrefix(query, "/*M!"):
+			return query
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query[2:], "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[2+end+2:]
+		case strings.HasPrefix(query, "#"), strings.HasPrefix(query, "-- "), strings.HasPrefix(query, "--\t"), query == "--":
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		default:
+			return query
+		}
+	}
+}
+
+// normalizeStatement upper cases the query and collapses its whitespace so
+// verbs can be compared regardless of formatting.
+func normalizeStatement(query string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(query), " "))
+}
+
+// checkStatementVerbs returns an error for the first query that doesn't
+// start with one of the allowed verbs. An empty allow-list permits every
+// statement. Only the leading keyword is reported, since the query may
+// contain the password.
+func checkStatementVerbs(queries []string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	for _, query := range queries {
+		normalized := normalizeStatement(query)
+		permitted := false
+		for _, verb := range allowed {
+			if normalized == verb || strings.HasPrefix(normalized, verb+" ") {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return fmt.Errorf("statement starting with %q is not permitted by allowed_statement_verbs", strings.SplitN(normalized, " ", 2)[0])
+		}
+	}
+	return nil
+}
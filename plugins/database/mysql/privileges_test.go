@@ -0,0 +1,484 @@
+package mysql
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+func TestBroadGrants(t *testing.T) {
+	type testCase struct {
+		statements []string
+		expected   []string
+	}
+
+	tests := map[string]testCase{
+		"least privilege": {
+			statements: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT SELECT ON app.* TO '{{name}}'@'%';`,
+			},
+		},
+		"all privileges on everything": {
+			statements: []string{`
+				CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+				GRANT ALL PRIVILEGES ON *.* TO '{{name}}'@'%';`,
+			},
+			expected: []string{"grants ALL PRIVILEGES", "grants on all databases"},
+		},
+		"grant option": {
+			statements: []string{"GRANT SELECT ON app.* TO '{{name}}'@'%' WITH GRANT OPTION"},
+			expected:   []string{"grants WITH GRANT OPTION"},
+		},
+		"super": {
+			statements: []string{"GRANT SUPER ON *.* TO '{{name}}'@'%'"},
+			expected:   []string{"grants on all databases", "grants the SUPER privilege"},
+		},
+		"password is not a grant": {
+			statements: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			queryMap := map[string]string{
+				"name":     "v_test",
+				"password": "GRANT ALL ON *.*",
+			}
+
+			actual := broadGrants(test.statements, queryMap)
+			sort.Strings(actual)
+			if !strutil.EquivalentSlices(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckStatementVerbs(t *testing.T) {
+	allowed := []string{"CREATE USER", "GRANT", "ALTER USER", "DROP USER", "REVOKE"}
+
+	type testCase struct {
+		queries   []string
+		allowed   []string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"unrestricted": {
+			queries: []string{"DELETE FROM app.users"},
+		},
+		"allowed verbs": {
+			queries: []string{
+				"CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+				"grant  SELECT ON app.* TO 'v_test'@'%'",
+				"DROP\n\tUSER 'v_test'@'%'",
+			},
+			allowed: allowed,
+		},
+		"dml": {
+			queries:   []string{"GRANT SELECT ON app.* TO 'v_test'@'%'", "DELETE FROM app.users"},
+			allowed:   allowed,
+			expectErr: true,
+		},
+		"verb prefix only": {
+			queries:   []string{"GRANTED"},
+			allowed:   allowed,
+			expectErr: true,
+		},
+		"different object": {
+			queries:   []string{"DROP DATABASE app"},
+			allowed:   allowed,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkStatementVerbs(test.queries, test.allowed)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestRequireTLSClause(t *testing.T) {
+	type testCase struct {
+		value     string
+		expected  string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"unset":       {value: "", expected: ""},
+		"none":        {value: "none", expected: "REQUIRE NONE"},
+		"ssl":         {value: "SSL", expected: "REQUIRE SSL"},
+		"x509":        {value: "x509", expected: "REQUIRE X509"},
+		"subject":     {value: "subject=/CN=app/O=Acme", expected: "REQUIRE SUBJECT '/CN=app/O=Acme'"},
+		"quoted":      {value: "subject=/CN=o'app", expected: `REQUIRE SUBJECT '/CN=o\'app'`},
+		"no subject":  {value: "subject=", expectErr: true},
+		"unsupported": {value: "tls13", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := requireTLSClause(test.value)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPasswordLifetimeClause(t *testing.T) {
+	type testCase struct {
+		days      int
+		expected  string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"unset":    {days: 0, expected: ""},
+		"90 days":  {days: 90, expected: "PASSWORD EXPIRE INTERVAL 90 DAY"},
+		"maximum":  {days: 65535, expected: "PASSWORD EXPIRE INTERVAL 65535 DAY"},
+		"negative": {days: -1, expectErr: true},
+		"too long": {days: 65536, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := passwordLifetimeClause(test.days)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if actual != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateUserHost(t *testing.T) {
+	type testCase struct {
+		host      string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"any":                      {host: "%"},
+		"wildcard network":         {host: "10.0.%"},
+		"host name":                {host: "app-1.example.com"},
+		"domain wildcard":          {host: "%.example.com"},
+		"ipv6":                     {host: "fe80::1"},
+		"netmask":                  {host: "10.0.0.0/255.255.0.0"},
+		"prefix length":            {host: "10.0.0.0/16"},
+		"empty":                    {host: "", expectErr: true},
+		"quote":                    {host: "%' OR '1", expectErr: true},
+		"space":                    {host: "10.0. %", expectErr: true},
+		"account separator":        {host: "app@10.0.%", expectErr: true},
+		"no mask":                  {host: "10.0.0.0/", expectErr: true},
+		"wildcard network address": {host: "10.0.%/16", expectErr: true},
+		"prefix too long":          {host: "10.0.0.0/33", expectErr: true},
+		"non-contiguous":           {host: "10.0.0.0/255.0.255.0", expectErr: true},
+		"host bits set":            {host: "10.0.1.0/16", expectErr: true},
+		"too long":                 {host: strings.Repeat("a", 256), expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateUserHost(test.host)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestMissingPrivileges(t *testing.T) {
+	required := []string{"CREATE USER", "GRANT OPTION", "PROCESS"}
+
+	type testCase struct {
+		grants   []string
+		expected []string
+	}
+
+	tests := map[string]testCase{
+		"all privileges": {
+			grants:   []string{"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION"},
+			expected: nil,
+		},
+		"listed privileges": {
+			grants: []string{
+				"GRANT SELECT, PROCESS, CREATE USER ON *.* TO `vault`@`%` WITH GRANT OPTION",
+				"GRANT CONNECTION_ADMIN,SYSTEM_USER ON *.* TO `vault`@`%`",
+			},
+			expected: nil,
+		},
+		"no grant option": {
+			grants:   []string{"GRANT CREATE USER, PROCESS ON *.* TO 'vault'@'%'"},
+			expected: []string{"GRANT OPTION"},
+		},
+		"database level": {
+			grants: []string{
+				"GRANT USAGE ON *.* TO `vault`@`%`",
+				"GRANT ALL PRIVILEGES ON `app`.* TO `vault`@`%` WITH GRANT OPTION",
+			},
+			expected: []string{"CREATE USER", "PROCESS"},
+		},
+		"column privileges": {
+			grants:   []string{"GRANT SELECT (id), CREATE USER ON *.* TO `vault`@`%`"},
+			expected: []string{"GRANT OPTION", "PROCESS"},
+		},
+		"role only": {
+			grants:   []string{"GRANT USAGE ON *.* TO `vault`@`%`", "GRANT `admin`@`%` TO `vault`@`%`"},
+			expected: []string{"CREATE USER", "GRANT OPTION", "PROCESS"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := missingPrivileges(test.grants, required)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGrantSummary(t *testing.T) {
+	queries := []string{
+		"CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+		"GRANT SELECT,  INSERT ON app.* TO 'v_test'@'%'",
+		"GRANT SELECT ON `reports`.`orders` TO 'v_test'@'%' WITH GRANT OPTION",
+		"GRANT 'reader' TO 'v_test'@'%'",
+	}
+
+	expected := "SELECT, INSERT ON app.*;SELECT, GRANT OPTION ON `reports`.`orders`"
+	if actual := grantSummary(queries); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestCheckGrantSchemas(t *testing.T) {
+	type testCase struct {
+		query     string
+		allowed   []string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"unrestricted": {
+			query: "GRANT ALL ON *.* TO 'v_test'@'%'",
+		},
+		"allowed schema": {
+			query:   "GRANT SELECT ON tenant_a.* TO 'v_test'@'%'",
+			allowed: []string{"tenant_a"},
+		},
+		"quoted table": {
+			query:   "GRANT SELECT, INSERT (id, name) ON `tenant_a`.`orders` TO 'v_test'@'%'",
+			allowed: []string{"tenant_a"},
+		},
+		"shared schema": {
+			query:     "GRANT SELECT ON shared.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"global grant": {
+			query:     "GRANT SELECT ON *.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a_*"},
+			expectErr: true,
+		},
+		"global grant allowed": {
+			query:   "GRANT SELECT ON *.* TO 'v_test'@'%'",
+			allowed: []string{"*"},
+		},
+		"default database": {
+			query:     "GRANT SELECT ON orders TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"prefix": {
+			query:   "grant select on tenant_a_app.* to 'v_test'@'%'",
+			allowed: []string{"tenant_a_*"},
+		},
+		"wildcard within prefix": {
+			query:   "GRANT SELECT ON `tenant_a_%`.* TO 'v_test'@'%'",
+			allowed: []string{"tenant_a_*"},
+		},
+		"wildcard outside prefix": {
+			query:     "GRANT SELECT ON `tenant%`.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a_*"},
+			expectErr: true,
+		},
+		"wildcard on exact entry": {
+			query:     "GRANT SELECT ON `tenant_a%`.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"escaped underscore": {
+			query:   "GRANT SELECT ON `tenant\\_a`.* TO 'v_test'@'%'",
+			allowed: []string{"tenant_a"},
+		},
+		"doubled backtick": {
+			query:   "GRANT SELECT ON `a``b`.* TO 'v_test'@'%'",
+			allowed: []string{"a`b"},
+		},
+		"routine": {
+			query:     "GRANT EXECUTE ON PROCEDURE shared.cleanup TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"role grant": {
+			query:   "GRANT 'reader' TO 'v_test'@'%'",
+			allowed: []string{"tenant_a"},
+		},
+		"leading comment": {
+			query:     "/* x */ GRANT ALL ON shared.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"leading line comments": {
+			query:     "-- setup\n# grants\n  GRANT ALL ON shared.* TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"leading comment allowed schema": {
+			query:   "/* x */ GRANT SELECT ON tenant_a.* TO 'v_test'@'%'",
+			allowed: []string{"tenant_a"},
+		},
+		"executable comment": {
+			query:     "/*!50700 GRANT ALL ON tenant_a.* TO 'v_test'@'%' */",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"unparseable level": {
+			query:     "GRANT SELECT ON TO 'v_test'@'%'",
+			allowed:   []string{"tenant_a"},
+			expectErr: true,
+		},
+		"no grant": {
+			query:   "/* x */ CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+			allowed: []string{"tenant_a"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkGrantSchemas([]string{test.query}, test.allowed)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	queries := []string{
+		"CREATE ROLE 'v_test_rw'@'%', 'shared'",
+		"create role if not exists `v_test_ro`",
+		"CREATE USER 'v_test'@'%' IDENTIFIED BY 'secret'",
+		"GRANT 'v_test_rw'@'%' TO 'v_test'@'%'",
+	}
+
+	expected := "'v_test_rw'@'%';`v_test_ro`"
+	if actual := userRoles(queries, "v_test"); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRevokeStatements(t *testing.T) {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `v_test`@`%`",
+		"GRANT SELECT, INSERT ON `app`.* TO `v_test`@`%` WITH GRANT OPTION",
+		"GRANT EXECUTE ON PROCEDURE `app`.`report` TO `v_test`@`%`",
+		"GRANT PROXY ON ''@'' TO 'v_test'@'%' WITH GRANT OPTION",
+		"GRANT `app_rw`@`%`,`app_ro`@`%` TO `v_test`@`%` WITH ADMIN OPTION",
+		"GRANT `mariadb_role` TO `v_test`@`%`",
+		"REVOKE INSERT ON `app`.* FROM `v_test`@`%`",
+	}
+
+	expected := []string{
+		"REVOKE SELECT, INSERT, GRANT OPTION ON `app`.* FROM 'v_test'@'%'",
+		"REVOKE EXECUTE ON PROCEDURE `app`.`report` FROM 'v_test'@'%'",
+		"REVOKE PROXY ON ''@'' FROM 'v_test'@'%'",
+		"REVOKE `app_rw`@`%`,`app_ro`@`%` FROM 'v_test'@'%'",
+		"REVOKE `mariadb_role` FROM 'v_test'@'%'",
+	}
+
+	revokes, unrecognized := revokeStatements(grants, "'v_test'@'%'")
+	if !reflect.DeepEqual(revokes, expected) {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(revokes, "\n"))
+	}
+	if unrecognized != 1 {
+		t.Fatalf("expected 1 unrecognized grant, got %d", unrecognized)
+	}
+}
+
+func TestExpandRevokeGrants(t *testing.T) {
+	type testCase struct {
+		statements []string
+		queryMap   map[string]string
+		expected   []string
+	}
+
+	tests := map[string]testCase{
+		"no template": {
+			statements: []string{"DROP USER '{{name}}'@'%'"},
+			queryMap:   map[string]string{},
+			expected:   []string{"DROP USER '{{name}}'@'%'"},
+		},
+		"recorded grants": {
+			statements: []string{"{{revoke_grants}}; DROP USER '{{name}}'@'{{host}}'"},
+			queryMap:   map[string]string{"grants": "SELECT ON app.*;INSERT, GRANT OPTION ON logs.*"},
+			expected: []string{
+				"REVOKE SELECT ON app.* FROM '{{name}}'@'{{host}}'",
+				"REVOKE INSERT, GRANT OPTION ON logs.* FROM '{{name}}'@'{{host}}'",
+				"DROP USER '{{name}}'@'{{host}}'",
+			},
+		},
+		"no grants": {
+			statements: []string{"{{revoke_grants}}", "DROP USER '{{name}}'@'%'"},
+			queryMap:   map[string]string{"grants": ""},
+			expected:   []string{"DROP USER '{{name}}'@'%'"},
+		},
+		"not recorded": {
+			statements: []string{"{{revoke_grants}}; DROP USER '{{name}}'@'{{host}}'"},
+			queryMap:   map[string]string{},
+			expected: []string{
+				"REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'{{host}}'",
+				"DROP USER '{{name}}'@'{{host}}'",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := expandRevokeGrants(test.statements, test.queryMap)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
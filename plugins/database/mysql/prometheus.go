@@ -0,0 +1,169 @@
+package mysql
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	prometheusNamespace = "database"
+	prometheusSubsystem = mySQLTypeName
+)
+
+// Retry kinds reported by the retries metric
+const (
+	retryUsernameRegeneration = "username_regeneration"
+	retryFallbackRevocation   = "fallback_revocation"
+)
+
+// prometheusMetrics holds the metrics exported by RegisterPrometheus. A nil
+// *prometheusMetrics records nothing, so the plugin doesn't pay for the
+// metrics unless they are registered.
+type prometheusMetrics struct {
+	operations        *prometheus.HistogramVec
+	retries           *prometheus.CounterVec
+	preparedFallbacks prometheus.Counter
+	pool              *poolCollector
+}
+
+// RegisterPrometheus registers the plugin's metrics with registerer: the
+// latency of NewUser, DeleteUser and UpdateUser by outcome, the retries
+// drawn from the retry budget, statements run unprepared after error 1295
+// and the connection pool statistics. Nothing is registered with the
+// default registry. The metrics can only be registered once per plugin
+// instance.
+func (m *MySQL) RegisterPrometheus(registerer prometheus.Registerer) error {
+	m.prometheusMu.Lock()
+	defer m.prometheusMu.Unlock()
+
+	if m.prometheus.Load() != nil {
+		return errors.New("prometheus metrics are already registered")
+	}
+
+	metrics := &prometheusMetrics{
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Subsystem: prometheusSubsystem,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the user operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "outcome"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Subsystem: prometheusSubsystem,
+			Name:      "retries_total",
+			Help:      "Retries drawn from the retry budget.",
+		}, []string{"kind"}),
+		preparedFallbacks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Subsystem: prometheusSubsystem,
+			Name:      "prepared_fallbacks_total",
+			Help:      "Statements run unprepared because the server can't prepare them (error 1295).",
+		}),
+		pool: newPoolCollector(m),
+	}
+
+	collectors := []prometheus.Collector{metrics.operations, metrics.retries, metrics.preparedFallbacks, metrics.pool}
+	for i, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			for _, registered := range collectors[:i] {
+				registerer.Unregister(registered)
+			}
+			return err
+		}
+	}
+
+	m.prometheus.Store(metrics)
+	return nil
+}
+
+// metrics returns the registered prometheus metrics, nil if none are.
+func (m *MySQL) metrics() *prometheusMetrics {
+	metrics, _ := m.prometheus.Load().(*prometheusMetrics)
+	return metrics
+}
+
+// observeOperation records the duration and outcome of an operation.
+func (p *prometheusMetrics) observeOperation(operation string, start time.Time, err error) {
+	if p == nil {
+		return
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	p.operations.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// retry records a retry of the given kind.
+func (p *prometheusMetrics) retry(kind string) {
+	if p == nil {
+		return
+	}
+	p.retries.WithLabelValues(kind).Inc()
+}
+
+// preparedFallback records a statement run unprepared after error 1295.
+func (p *prometheusMetrics) preparedFallback() {
+	if p == nil {
+		return
+	}
+	p.preparedFallbacks.Inc()
+}
+
+// poolCollector reports the statistics of the primary connection pool when
+// scraped.
+type poolCollector struct {
+	m *MySQL
+
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func newPoolCollector(m *MySQL) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(prometheusNamespace, prometheusSubsystem, name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		m:            m,
+		open:         desc("pool_open_connections", "Established connections, in use or idle."),
+		inUse:        desc("pool_in_use_connections", "Connections currently in use."),
+		idle:         desc("pool_idle_connections", "Idle connections."),
+		waitCount:    desc("pool_wait_count_total", "Connections waited for."),
+		waitDuration: desc("pool_wait_duration_seconds_total", "Time spent waiting for connections."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+// Collect implements prometheus.Collector. Nothing is reported while there
+// is no pool.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.Lock()
+	db := c.m.db
+	c.m.Unlock()
+	if db == nil {
+		return
+	}
+
+	stats := db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,82 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMySQL_RegisterPrometheus(t *testing.T) {
+	d := &fakeDriver{
+		prepareErrs: map[string]error{
+			"GRANT": &stdmysql.MySQLError{Number: 1295},
+		},
+	}
+	db := newFakeMySQL(t, d)
+
+	registry := prometheus.NewRegistry()
+	if err := db.RegisterPrometheus(registry); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if err := db.RegisterPrometheus(registry); err == nil {
+		t.Fatalf("expected registering twice to fail")
+	}
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "app",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%'; GRANT SELECT ON app.* TO '{{name}}'@'%'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+	if _, err := db.NewUser(context.Background(), req); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	db.metrics().retry(retryFallbackRevocation)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] += float64(metric.GetHistogram().GetSampleCount())
+			case metric.GetCounter() != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				values[family.GetName()] += metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"database_mysql_operation_duration_seconds": 1,
+		"database_mysql_prepared_fallbacks_total":   1,
+		"database_mysql_retries_total":              1,
+		"database_mysql_pool_open_connections":      1,
+		"database_mysql_pool_in_use_connections":    0,
+	}
+	for name, value := range expected {
+		if actual, ok := values[name]; !ok || actual != value {
+			t.Fatalf("expected %s to be %v, got %v (present: %t)", name, value, actual, ok)
+		}
+	}
+}
+
+func TestPrometheusMetrics_nil(t *testing.T) {
+	var metrics *prometheusMetrics
+	metrics.observeOperation(auditNewUser, time.Now(), nil)
+	metrics.retry(retryUsernameRegeneration)
+	metrics.preparedFallback()
+}
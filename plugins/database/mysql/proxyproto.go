@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+)
+
+// proxyProtocolNets are the network names the PROXY protocol dialers are
+// registered under in the mysql driver
+var proxyProtocolNets = map[string]string{
+	proxyProtocolV1: "tcp+proxy-v1",
+	proxyProtocolV2: "tcp+proxy-v2",
+}
+
+// proxyProtocolV2Signature starts every PROXY protocol v2 header
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var registerProxyProtocolDialersOnce sync.Once
+
+// registerProxyProtocolDialers registers a dialer for each PROXY protocol
+// version with the mysql driver. The driver keeps dialers in a global
+// registry, so this only needs to happen once per process.
+func registerProxyProtocolDialers() {
+	registerProxyProtocolDialersOnce.Do(func() {
+		for version, network := range proxyProtocolNets {
+			version := version
+			mysql.RegisterDialContext(network, func(ctx context.Context, addr string) (net.Conn, error) {
+				return dialProxyProtocol(ctx, version, addr)
+			})
+		}
+	})
+}
+
+// dialProxyProtocol dials addr over TCP and sends a PROXY protocol header of
+// the given version before the MySQL handshake starts, announcing the
+// connection's own addresses.
+func dialProxyProtocol(ctx context.Context, version, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := proxyProtocolHeader(version, conn.LocalAddr().(*net.TCPAddr), conn.RemoteAddr().(*net.TCPAddr))
+	if err == nil {
+		_, err = conn.Write(header)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send PROXY protocol header: %w", err)
+	}
+	return conn, nil
+}
+
+// proxyProtocolHeader returns the PROXY protocol header announcing a TCP
+// connection from src to dst.
+func proxyProtocolHeader(version string, src, dst *net.TCPAddr) ([]byte, error) {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	ipv4 := srcIP != nil && dstIP != nil
+	if !ipv4 {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+
+	switch version {
+	case proxyProtocolV1:
+		family := "TCP4"
+		if !ipv4 {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port, dst.Port)), nil
+
+	case proxyProtocolV2:
+		var buf bytes.Buffer
+		buf.Write(proxyProtocolV2Signature)
+		// Version 2, PROXY command
+		buf.WriteByte(0x21)
+		// TCP over IPv4 or IPv6, followed by the address block length
+		if ipv4 {
+			buf.WriteByte(0x11)
+			binary.Write(&buf, binary.BigEndian, uint16(12))
+		} else {
+			buf.WriteByte(0x21)
+			binary.Write(&buf, binary.BigEndian, uint16(36))
+		}
+		buf.Write(srcIP)
+		buf.Write(dstIP)
+		binary.Write(&buf, binary.BigEndian, uint16(src.Port))
+		binary.Write(&buf, binary.BigEndian, uint16(dst.Port))
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+}
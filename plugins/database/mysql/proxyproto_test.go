@@ -0,0 +1,182 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	type testCase struct {
+		version  string
+		src, dst *net.TCPAddr
+		expected []byte
+	}
+
+	ipv4Src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51234}
+	ipv4Dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 3306}
+	ipv6Src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234}
+	ipv6Dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3306}
+
+	v2 := func(famLen []byte, addrs ...[]byte) []byte {
+		header := append([]byte("\r\n\r\n\x00\r\nQUIT\n\x21"), famLen...)
+		for _, a := range addrs {
+			header = append(header, a...)
+		}
+		return header
+	}
+
+	tests := map[string]testCase{
+		"v1 ipv4": {
+			version:  proxyProtocolV1,
+			src:      ipv4Src,
+			dst:      ipv4Dst,
+			expected: []byte("PROXY TCP4 10.0.0.1 10.0.0.2 51234 3306\r\n"),
+		},
+		"v1 ipv6": {
+			version:  proxyProtocolV1,
+			src:      ipv6Src,
+			dst:      ipv6Dst,
+			expected: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 3306\r\n"),
+		},
+		"v2 ipv4": {
+			version: proxyProtocolV2,
+			src:     ipv4Src,
+			dst:     ipv4Dst,
+			expected: v2([]byte{0x11, 0x00, 0x0c},
+				[]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2},
+				[]byte{0xc8, 0x22}, []byte{0x0c, 0xea}),
+		},
+		"v2 ipv6": {
+			version: proxyProtocolV2,
+			src:     ipv6Src,
+			dst:     ipv6Dst,
+			expected: v2([]byte{0x21, 0x00, 0x24},
+				net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"),
+				[]byte{0xc8, 0x22}, []byte{0x0c, 0xea}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := proxyProtocolHeader(test.version, test.src, test.dst)
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if !bytes.Equal(actual, test.expected) {
+				t.Fatalf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+
+	if _, err := proxyProtocolHeader("v3", ipv4Src, ipv4Dst); err == nil {
+		t.Fatalf("err expected for an unknown version, got nil")
+	}
+}
+
+func TestDialProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := make([]byte, 28)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		received <- header
+	}()
+
+	conn, err := dialProxyProtocol(context.Background(), proxyProtocolV2, ln.Addr().String())
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	defer conn.Close()
+
+	expected, err := proxyProtocolHeader(proxyProtocolV2, conn.LocalAddr().(*net.TCPAddr), conn.RemoteAddr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := <-received; !bytes.Equal(header, expected) {
+		t.Fatalf("expected header %q, got %q", expected, header)
+	}
+}
+
+func TestInit_sendProxyProtocol(t *testing.T) {
+	type testCase struct {
+		conf      map[string]interface{}
+		expectNet string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"v2 by default": {
+			conf: map[string]interface{}{
+				"connection_url":      "user:password@tcp(localhost:3306)/test",
+				"send_proxy_protocol": true,
+			},
+			expectNet: "tcp+proxy-v2",
+		},
+		"v1": {
+			conf: map[string]interface{}{
+				"connection_url":         "user:password@tcp(localhost:3306)/test",
+				"send_proxy_protocol":    true,
+				"proxy_protocol_version": "v1",
+			},
+			expectNet: "tcp+proxy-v1",
+		},
+		"unknown version": {
+			conf: map[string]interface{}{
+				"connection_url":         "user:password@tcp(localhost:3306)/test",
+				"send_proxy_protocol":    true,
+				"proxy_protocol_version": "v3",
+			},
+			expectErr: true,
+		},
+		"unix socket": {
+			conf: map[string]interface{}{
+				"connection_url":      "user:password@unix(/var/run/mysqld/mysqld.sock)/test",
+				"send_proxy_protocol": true,
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &mySQLConnectionProducer{}
+			_, err := c.Init(context.Background(), test.conf, false)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			dsn, err := c.addTLStoDSN()
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := parseDSN(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Net != test.expectNet {
+				t.Fatalf("expected net %q, got %q", test.expectNet, config.Net)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// showReplicaStatusSQL needs MySQL 8.0.22, older servers and MariaDB
+	// only know showSlaveStatusSQL
+	showReplicaStatusSQL = "SHOW REPLICA STATUS"
+	showSlaveStatusSQL   = "SHOW SLAVE STATUS"
+)
+
+// replicationLagPollInterval is how often the lag is read again while
+// waiting for it to drop
+var replicationLagPollInterval = time.Second
+
+// checkReplicationLag applies replication_lag_action when the replica lags
+// more than max_replication_lag. It returns the lag to record when the
+// action is to warn, zero otherwise.
+func (m *MySQL) checkReplicationLag(ctx context.Context) (time.Duration, error) {
+	if m.maxReplicationLag <= 0 {
+		return 0, nil
+	}
+
+	for {
+		lag, ok, err := m.replicationLag(ctx)
+		if err != nil && ctx.Err() != nil {
+			return 0, fmt.Errorf("failed to read the replication lag: %w", err)
+		}
+		if err != nil {
+			m.logger.Warn("unable to read the replication lag", "error", err)
+			return 0, nil
+		}
+		if !ok {
+			m.logger.Warn("replication lag is not available, the replica connection isn't replicating")
+			return 0, nil
+		}
+		if lag <= m.maxReplicationLag {
+			return 0, nil
+		}
+
+		switch m.ReplicationLagAction {
+		case replicationLagFail:
+			return 0, fmt.Errorf("replication lag of %s exceeds max_replication_lag of %s", lag, m.maxReplicationLag)
+		case replicationLagWait:
+			m.logger.Debug("waiting for the replication lag to drop", "lag", lag)
+			timer := time.NewTimer(jitterDelay(m.BackoffJitter, replicationLagPollInterval))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, fmt.Errorf("replication lag of %s still exceeds max_replication_lag of %s: %w", lag, m.maxReplicationLag, ctx.Err())
+			}
+		default:
+			m.logger.Warn("replication lag exceeds max_replication_lag, the credential may not work on replicas yet", "lag", lag)
+			return lag, nil
+		}
+	}
+}
+
+// replicationLag reads the replication lag of the replica connection. With
+// several replication channels the largest lag is returned. ok is false if
+// the server isn't a replica or a channel doesn't report a lag.
+func (m *MySQL) replicationLag(ctx context.Context) (lag time.Duration, ok bool, err error) {
+	db, err := m.readOperationConnection(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rows, err := db.QueryContext(ctx, showReplicaStatusSQL)
+	if isSyntaxError(err) {
+		rows, err = db.QueryContext(ctx, showSlaveStatusSQL)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, false, err
+	}
+	index := -1
+	for i, column := range columns {
+		if column == "Seconds_Behind_Source" || column == "Seconds_Behind_Master" {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0, false, nil
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, false, err
+		}
+
+		// The lag is NULL while replication is stopped
+		if !values[index].Valid {
+			return 0, false, nil
+		}
+		seconds, err := strconv.Atoi(values[index].String)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid replication lag %q: %w", values[index].String, err)
+		}
+		if channelLag := time.Duration(seconds) * time.Second; channelLag > lag {
+			lag = channelLag
+		}
+		ok = true
+	}
+	return lag, ok, rows.Err()
+}
+
+// isSyntaxError reports whether the server rejected the statement as
+// invalid syntax (1064).
+func isSyntaxError(err error) bool {
+	var mysqlErr *stdmysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1064
+}
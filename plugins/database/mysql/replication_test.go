@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+)
+
+func TestMySQL_checkReplicationLag(t *testing.T) {
+	type testCase struct {
+		action      string
+		rows        map[string]fakeRows
+		errs        map[string]error
+		expectedLag time.Duration
+		canceled    bool
+		expectErr   bool
+	}
+
+	lagging := map[string]fakeRows{
+		showReplicaStatusSQL: {
+			columns: []string{"Replica_IO_State", "Seconds_Behind_Source"},
+			values:  [][]driver.Value{{"", int64(2)}, {"", int64(30)}},
+		},
+	}
+
+	tests := map[string]testCase{
+		"within threshold": {
+			rows: map[string]fakeRows{
+				showReplicaStatusSQL: {
+					columns: []string{"Seconds_Behind_Source"},
+					values:  [][]driver.Value{{int64(5)}},
+				},
+			},
+		},
+		"warn": {
+			rows:        lagging,
+			expectedLag: 30 * time.Second,
+		},
+		"fail": {
+			action:    replicationLagFail,
+			rows:      lagging,
+			expectErr: true,
+		},
+		"wait times out": {
+			action:    replicationLagWait,
+			rows:      lagging,
+			expectErr: true,
+		},
+		"older server": {
+			errs: map[string]error{
+				showReplicaStatusSQL: &stdmysql.MySQLError{Number: 1064},
+			},
+			rows: map[string]fakeRows{
+				showSlaveStatusSQL: {
+					columns: []string{"Seconds_Behind_Master"},
+					values:  [][]driver.Value{{int64(30)}},
+				},
+			},
+			expectedLag: 30 * time.Second,
+		},
+		"replication stopped": {
+			action: replicationLagFail,
+			rows: map[string]fakeRows{
+				showReplicaStatusSQL: {
+					columns: []string{"Seconds_Behind_Source"},
+					values:  [][]driver.Value{{nil}},
+				},
+			},
+		},
+		"not a replica": {
+			action: replicationLagFail,
+			rows: map[string]fakeRows{
+				showReplicaStatusSQL: {
+					columns: []string{"Seconds_Behind_Source"},
+				},
+			},
+		},
+		"canceled while reading": {
+			rows:      lagging,
+			canceled:  true,
+			expectErr: true,
+		},
+		"status not readable": {
+			action: replicationLagFail,
+			errs: map[string]error{
+				showReplicaStatusSQL: &stdmysql.MySQLError{Number: 1227},
+			},
+		},
+	}
+
+	defer func(interval time.Duration) {
+		replicationLagPollInterval = interval
+	}(replicationLagPollInterval)
+	replicationLagPollInterval = 10 * time.Millisecond
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{rows: test.rows, errs: test.errs}
+			db := newFakeMySQL(t, d)
+			db.maxReplicationLag = 10 * time.Second
+			db.ReplicationLagAction = test.action
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if test.canceled {
+				cancel()
+			}
+
+			lag, err := db.checkReplicationLag(ctx)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if lag != test.expectedLag {
+				t.Fatalf("expected lag %s, got %s", test.expectedLag, lag)
+			}
+		})
+	}
+}
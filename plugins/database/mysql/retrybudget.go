@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is returned instead of retrying once the shared
+// retry budget is used up.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget is a token bucket shared by every retrying path, so an outage
+// can't turn into a retry storm. It holds up to a minute's worth of retries
+// and refills continuously. A nil budget allows every retry.
+type retryBudget struct {
+	sync.Mutex
+	capacity float64
+	tokens   float64
+	// perSecond is the refill rate
+	perSecond float64
+	last      time.Time
+	now       func() time.Time
+}
+
+// newRetryBudget returns a budget of perMinute retries, or nil for an
+// unlimited budget when perMinute is zero.
+func newRetryBudget(perMinute int) *retryBudget {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return &retryBudget{
+		capacity:  float64(perMinute),
+		tokens:    float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		last:      time.Now(),
+		now:       time.Now,
+	}
+}
+
+// take draws a retry from the budget and reports whether one was left.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.perSecond
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
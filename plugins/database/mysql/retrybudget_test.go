@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestRetryBudget(t *testing.T) {
+	if b := newRetryBudget(0); b != nil || !b.take() {
+		t.Fatalf("expected an unlimited budget")
+	}
+
+	now := time.Now()
+	b := newRetryBudget(2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	if !b.take() || !b.take() {
+		t.Fatalf("expected 2 retries")
+	}
+	if b.take() {
+		t.Fatalf("expected the budget to be exhausted")
+	}
+
+	// One retry refills every 30 seconds
+	now = now.Add(30 * time.Second)
+	if !b.take() {
+		t.Fatalf("expected a refilled retry")
+	}
+	if b.take() {
+		t.Fatalf("expected the budget to be exhausted")
+	}
+
+	// The budget never holds more than a minute's worth
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.take() {
+			t.Fatalf("expected retry %d", i)
+		}
+	}
+	if b.take() {
+		t.Fatalf("expected the budget to be capped")
+	}
+}
+
+func TestMySQL_DeleteUser_retryBudget(t *testing.T) {
+	d := &fakeDriver{
+		errs: map[string]error{
+			"DROP USER": &stdmysql.MySQLError{Number: 1396},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.FallbackRevocationStatements = []string{"DROP USER IF EXISTS '{{name}}'@'%'"}
+	db.FallbackRevocationErrorCodes = defaultFallbackRevocationErrorCodes
+	db.retries = newRetryBudget(1)
+
+	req := dbplugin.DeleteUserRequest{Username: "v_test"}
+
+	// The first fallback draws the only retry, the failing fallback
+	// statements still fail the revocation
+	if _, err := db.DeleteUser(context.Background(), req); err == nil || errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("expected the fallback revocation to run and fail, got: %v", err)
+	}
+
+	if _, err := db.DeleteUser(context.Background(), req); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("expected ErrRetryBudgetExhausted, got: %v", err)
+	}
+}
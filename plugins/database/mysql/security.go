@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"strings"
+)
+
+// TLS modes reported by ConnectionSecurity
+const (
+	tlsModeDisabled   = "disabled"
+	tlsModePreferred  = "preferred"
+	tlsModeSkipVerify = "skip-verify"
+	tlsModeVerifyCA   = "verify-ca"
+	tlsModeVerifyFull = "verify-full"
+	tlsModeCustom     = "custom"
+)
+
+// ConnectionSecurity describes how the plugin's connections to the server
+// are secured. It holds no secrets, so operators can report it to audit
+// that every configured database enforces encryption.
+type ConnectionSecurity struct {
+	// TLSMode is one of "disabled", "preferred", "skip-verify",
+	// "verify-ca", "verify-full" or "custom" for TLS configs registered
+	// with the driver outside of the plugin
+	TLSMode string `json:"tls_mode"`
+	// Encrypted is true when every connection is required to use TLS
+	Encrypted bool `json:"encrypted"`
+	// ClientCertificate is true when connections present tls_certificate_key
+	ClientCertificate bool `json:"client_certificate"`
+	// AuthType is the configured auth_type
+	AuthType string `json:"auth_type"`
+	// Transport is the driver network: "tcp", "unix", "np",
+	// "cloudsql-connector", "ssh-tunnel" or "tcp+proxy-v1"/"tcp+proxy-v2"
+	// when sending a PROXY protocol header
+	Transport string `json:"transport"`
+}
+
+// ConnectionSecurity returns the security of the connection as recorded by
+// the last Initialize. The second return value is false if the plugin isn't
+// initialized.
+func (c *mySQLConnectionProducer) ConnectionSecurity() (ConnectionSecurity, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.security, c.Initialized
+}
+
+// connectionSecurity derives the connection's security from the effective
+// DSN.
+func (c *mySQLConnectionProducer) connectionSecurity() (ConnectionSecurity, error) {
+	connURL, err := c.addTLStoDSN()
+	if err != nil {
+		return ConnectionSecurity{}, err
+	}
+	config, err := parseDSN(connURL)
+	if err != nil {
+		return ConnectionSecurity{}, err
+	}
+
+	security := ConnectionSecurity{
+		AuthType:          c.AuthType,
+		Transport:         config.Net,
+		ClientCertificate: c.tlsConfigName != "" && len(c.TLSCertificateKeyData) > 0,
+	}
+	if c.SSHTunnel {
+		security.Transport = "ssh-tunnel"
+	}
+	if security.AuthType == "" {
+		security.AuthType = authTypePassword
+	}
+
+	switch tlsConfig := strings.ToLower(config.TLSConfig); {
+	case c.AuthType == authTypeCloudSQLConnector:
+		// The connector always dials with mutual TLS, verifying the instance
+		security.TLSMode = tlsModeVerifyFull
+	case c.tlsConfigName != "" && config.TLSConfig == c.tlsConfigName:
+		security.TLSMode = tlsModeVerifyFull
+		if c.TLSSkipHostnameVerify {
+			security.TLSMode = tlsModeVerifyCA
+		}
+	case tlsConfig == "" || tlsConfig == "false":
+		security.TLSMode = tlsModeDisabled
+	case tlsConfig == "true":
+		security.TLSMode = tlsModeVerifyFull
+	case tlsConfig == tlsModePreferred:
+		security.TLSMode = tlsModePreferred
+	case tlsConfig == tlsModeSkipVerify:
+		security.TLSMode = tlsModeSkipVerify
+	default:
+		security.TLSMode = tlsModeCustom
+	}
+
+	security.Encrypted = security.TLSMode != tlsModeDisabled && security.TLSMode != tlsModePreferred
+	return security, nil
+}
@@ -0,0 +1,137 @@
+package mysql
+
+import (
+	"context"
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestConnectionSecurity(t *testing.T) {
+	// The effective DSN only parses with the plugin's TLS config registered
+	mysql.RegisterTLSConfig("securityTest", &tls.Config{})
+	defer mysql.DeregisterTLSConfig("securityTest")
+
+	type testCase struct {
+		producer *mySQLConnectionProducer
+		expected ConnectionSecurity
+	}
+
+	tests := map[string]testCase{
+		"plaintext": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL: "user:password@tcp(localhost:3306)/test",
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModeDisabled,
+				AuthType:  authTypePassword,
+				Transport: "tcp",
+			},
+		},
+		"preferred": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL: "user:password@tcp(localhost:3306)/test?tls=preferred",
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModePreferred,
+				AuthType:  authTypePassword,
+				Transport: "tcp",
+			},
+		},
+		"system roots": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL: "user:password@tcp(localhost:3306)/test?tls=true",
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModeVerifyFull,
+				Encrypted: true,
+				AuthType:  authTypePassword,
+				Transport: "tcp",
+			},
+		},
+		"skip verify": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL: "user:password@tcp(localhost:3306)/test?tls=skip-verify",
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModeSkipVerify,
+				Encrypted: true,
+				AuthType:  authTypePassword,
+				Transport: "tcp",
+			},
+		},
+		"plugin tls config": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL:         "user:password@tcp(localhost:3306)/test",
+				tlsConfigName:         "securityTest",
+				TLSCertificateKeyData: []byte("cert"),
+			},
+			expected: ConnectionSecurity{
+				TLSMode:           tlsModeVerifyFull,
+				Encrypted:         true,
+				ClientCertificate: true,
+				AuthType:          authTypePassword,
+				Transport:         "tcp",
+			},
+		},
+		"plugin tls config without hostname verification": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL:         "user:password@tcp(localhost:3306)/test",
+				tlsConfigName:         "securityTest",
+				TLSSkipHostnameVerify: true,
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModeVerifyCA,
+				Encrypted: true,
+				AuthType:  authTypePassword,
+				Transport: "tcp",
+			},
+		},
+		"unix socket": {
+			producer: &mySQLConnectionProducer{
+				ConnectionURL: "user:password@unix(/var/run/mysqld/mysqld.sock)/test",
+			},
+			expected: ConnectionSecurity{
+				TLSMode:   tlsModeDisabled,
+				AuthType:  authTypePassword,
+				Transport: "unix",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := test.producer.connectionSecurity()
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestInit_connectionSecurity(t *testing.T) {
+	db := new(false)
+	if _, ok := db.ConnectionSecurity(); ok {
+		t.Fatalf("expected no connection security before Initialize")
+	}
+
+	conf := map[string]interface{}{
+		"connection_url": "user:password@tcp(localhost:3306)/test?tls=true",
+	}
+	if _, err := db.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	security, ok := db.ConnectionSecurity()
+	if !ok {
+		t.Fatalf("expected connection security after Initialize")
+	}
+	if !security.Encrypted || security.TLSMode != tlsModeVerifyFull {
+		t.Fatalf("expected verified TLS, got %+v", security)
+	}
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// serverIdentityQueries maps the server identity template keys to the query
+// reading their value. MariaDB has no @@server_uuid, so statements using
+// {{server_uuid}} fail there.
+var serverIdentityQueries = map[string]string{
+	"server_id":   "SELECT @@server_id",
+	"server_uuid": "SELECT @@server_uuid",
+}
+
+// serverIdentityCache keeps the server identity values read from the server.
+// They are read on first use and kept until the plugin is initialized
+// again.
+type serverIdentityCache struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func newServerIdentityCache() *serverIdentityCache {
+	return &serverIdentityCache{
+		values: make(map[string]string),
+	}
+}
+
+// reset drops the cached values.
+func (c *serverIdentityCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.values = make(map[string]string)
+}
+
+// serverIdentityValues returns the {{server_id}} and {{server_uuid}} values
+// referenced by the statements, reading each from the server only once.
+func (m *MySQL) serverIdentityValues(ctx context.Context, statements []string) (map[string]string, error) {
+	var keys []string
+	for key := range serverIdentityQueries {
+		for _, stmt := range statements {
+			if strings.Contains(stmt, "{{"+key+"}}") {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	m.serverIdentity.Lock()
+	defer m.serverIdentity.Unlock()
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if value, ok := m.serverIdentity.values[key]; ok {
+			values[key] = value
+			continue
+		}
+
+		db, err := m.operationConnection(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var value string
+		if err := db.QueryRowContext(ctx, serverIdentityQueries[key]).Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		m.serverIdentity.values[key] = value
+		values[key] = value
+	}
+	return values, nil
+}
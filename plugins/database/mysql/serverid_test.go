@@ -0,0 +1,82 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dbplugin "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+func TestMySQL_NewUser_serverIdentity(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			serverIdentityQueries["server_id"]: {
+				columns: []string{"@@server_id"},
+				values:  [][]driver.Value{{"42"}},
+			},
+			serverIdentityQueries["server_uuid"]: {
+				columns: []string{"@@server_uuid"},
+				values:  [][]driver.Value{{"3e11fa47-71ca-11e1-9e33-c80aa9429562"}},
+			},
+		},
+	}
+	db := newFakeMySQL(t, d)
+
+	req := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "test",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' COMMENT '{{server_id}}/{{server_uuid}}'"},
+		},
+		Password:   "secret",
+		Expiration: time.Now().Add(time.Minute),
+	}
+
+	var usernames []string
+	for i := 0; i < 2; i++ {
+		resp, err := db.NewUser(context.Background(), req)
+		if err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+		usernames = append(usernames, resp.Username)
+	}
+
+	calls := d.calls()
+	for _, username := range usernames {
+		expected := fmt.Sprintf("exec: CREATE USER '%s'@'%%' IDENTIFIED BY 'secret' COMMENT '42/3e11fa47-71ca-11e1-9e33-c80aa9429562'", username)
+		if !strutil.StrListContains(calls, expected) {
+			t.Fatalf("expected %q in calls:\n%s", expected, strings.Join(calls, "\n"))
+		}
+	}
+
+	// The values are read once and cached
+	queries := 0
+	for _, call := range calls {
+		if strings.HasPrefix(call, "query: SELECT @@server") {
+			queries++
+		}
+	}
+	if queries != 2 {
+		t.Fatalf("expected each identity value to be queried once, got %d queries:\n%s", queries, strings.Join(calls, "\n"))
+	}
+}
+
+func TestMySQL_serverIdentityValues_unreferenced(t *testing.T) {
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+
+	values, err := db.serverIdentityValues(context.Background(), []string{"CREATE USER '{{name}}'@'%'"})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if len(values) != 0 || len(d.calls()) != 0 {
+		t.Fatalf("expected no values and no queries, got %v and %v", values, d.calls())
+	}
+}
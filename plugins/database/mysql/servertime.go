@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// serverTimeSQL reads the server's clock independently of the session time
+// zone
+const serverTimeSQL = "SELECT UNIX_TIMESTAMP(NOW(6))"
+
+// serverClockRefreshInterval is how long a measured clock offset is used
+// before it is measured again, since clocks drift
+var serverClockRefreshInterval = 10 * time.Minute
+
+// serverClock keeps the offset of the server's clock from Vault's for
+// use_server_time. It is measured again once serverClockRefreshInterval
+// passed, once the pool is replaced after a reconnect, and when the plugin
+// is initialized again.
+type serverClock struct {
+	sync.Mutex
+	db       *sql.DB
+	offset   time.Duration
+	measured time.Time
+}
+
+// reset drops the measured offset.
+func (c *serverClock) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.db = nil
+	c.measured = time.Time{}
+}
+
+// serverTime converts t from Vault's clock to the server's when
+// use_server_time is set. If the server's clock can't be read, t is returned
+// unchanged.
+func (m *MySQL) serverTime(ctx context.Context, t time.Time) time.Time {
+	if !m.UseServerTime || t.IsZero() {
+		return t
+	}
+
+	offset, err := m.serverClockOffset(ctx)
+	if err != nil {
+		m.logger.Warn("unable to read the server's clock, using Vault's", "error", err)
+		return t
+	}
+	return t.Add(offset)
+}
+
+// serverClockOffset returns how far the server's clock is ahead of Vault's.
+func (m *MySQL) serverClockOffset(ctx context.Context) (time.Duration, error) {
+	db, err := m.operationConnection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	m.clock.Lock()
+	defer m.clock.Unlock()
+
+	if m.clock.db == db && time.Since(m.clock.measured) < serverClockRefreshInterval {
+		return m.clock.offset, nil
+	}
+
+	offset, err := measureClockOffset(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= time.Second || offset <= -time.Second {
+		m.logger.Debug("server clock differs from Vault's", "offset", offset)
+	}
+	m.clock.db = db
+	m.clock.offset = offset
+	m.clock.measured = time.Now()
+	return offset, nil
+}
+
+// measureClockOffset reads the server's clock and compares it to the local
+// time halfway through the query.
+func measureClockOffset(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var value string
+	start := time.Now()
+	if err := db.QueryRowContext(ctx, serverTimeSQL).Scan(&value); err != nil {
+		return 0, err
+	}
+	local := start.Add(time.Since(start) / 2)
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid server time %q: %w", value, err)
+	}
+	server := time.Unix(0, int64(seconds*float64(time.Second)))
+	return server.Sub(local), nil
+}
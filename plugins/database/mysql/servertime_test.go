@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+)
+
+func TestMySQL_serverTime(t *testing.T) {
+	// The server's clock is an hour ahead of Vault's
+	now := time.Now().Add(time.Hour)
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			serverTimeSQL: {
+				columns: []string{"UNIX_TIMESTAMP(NOW(6))"},
+				values:  [][]driver.Value{{fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)}},
+			},
+		},
+	}
+	db := newFakeMySQL(t, d)
+
+	expiration := time.Now().Add(time.Minute)
+	if actual := db.serverTime(context.Background(), expiration); !actual.Equal(expiration) {
+		t.Fatalf("expected Vault's clock without use_server_time, got %s", actual)
+	}
+
+	db.UseServerTime = true
+	offset := db.serverTime(context.Background(), expiration).Sub(expiration)
+	if offset < time.Hour-time.Second || offset > time.Hour+time.Second {
+		t.Fatalf("expected an offset of about an hour, got %s", offset)
+	}
+
+	queries := func() int {
+		count := 0
+		for _, call := range d.calls() {
+			if call == "query: "+serverTimeSQL {
+				count++
+			}
+		}
+		return count
+	}
+
+	db.serverTime(context.Background(), expiration)
+	if count := queries(); count != 1 {
+		t.Fatalf("expected the offset to be cached, got %d queries", count)
+	}
+
+	db.clock.reset()
+	db.serverTime(context.Background(), expiration)
+	if count := queries(); count != 2 {
+		t.Fatalf("expected the offset to be measured again after a reset, got %d queries", count)
+	}
+}
+
+func TestMySQL_serverTime_unavailable(t *testing.T) {
+	d := &fakeDriver{
+		errs: map[string]error{
+			serverTimeSQL: &stdmysql.MySQLError{Number: 1227},
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.UseServerTime = true
+
+	expiration := time.Now().Add(time.Minute)
+	if actual := db.serverTime(context.Background(), expiration); !actual.Equal(expiration) {
+		t.Fatalf("expected Vault's clock, got %s", actual)
+	}
+}
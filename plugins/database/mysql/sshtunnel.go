@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultSSHPort = "22"
+
+// sshTunnel dials MySQL through an SSH bastion. A single SSH connection is
+// shared by all MySQL connections and re-established once it breaks.
+type sshTunnel struct {
+	sync.Mutex
+	addr   string
+	config *ssh.ClientConfig
+	client *ssh.Client
+}
+
+// newSSHTunnel returns a tunnel through the bastion at addr, authenticating
+// as username with the PEM encoded privateKey. The bastion must present
+// hostKey, given in authorized_keys format.
+func newSSHTunnel(addr, username, privateKey, hostKey string) (*sshTunnel, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh_private_key: %w", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh_host_key: %w", err)
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultSSHPort)
+	}
+
+	return &sshTunnel{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.FixedHostKey(publicKey),
+		},
+	}, nil
+}
+
+// dialContext opens a connection to addr as seen from the bastion.
+func (t *sshTunnel) dialContext(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		// The SSH connection may have broken, so start over on the next dial
+		t.reset(client)
+		return nil, fmt.Errorf("failed to dial %s through the SSH tunnel: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// connect returns the SSH connection to the bastion, establishing it if
+// needed.
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH host %s: %w", t.addr, err)
+	}
+	// Bound the SSH handshake by the context as well
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to establish SSH connection to %s: %w", t.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.client = ssh.NewClient(sshConn, chans, reqs)
+	return t.client, nil
+}
+
+// reset closes client if it's still the tunnel's SSH connection.
+func (t *sshTunnel) reset(client *ssh.Client) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// Close closes the SSH connection. The tunnel reconnects on the next dial.
+func (t *sshTunnel) Close() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHBastion starts an SSH server that accepts clientKey and forwards
+// direct-tcpip channels. It returns its address and host key in
+// authorized_keys format.
+func startSSHBastion(t *testing.T, clientKey ssh.PublicKey) (string, string) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+
+	return ln.Addr().String(), string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey()))
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+
+		// The payload starts with the target host and port
+		payload := newChan.ExtraData()
+		hostLen := binary.BigEndian.Uint32(payload)
+		host := string(payload[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(payload[4+hostLen:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, chReqs, err := newChan.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+func TestSSHTunnel_dial(t *testing.T) {
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(clientPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	bastion, hostKey := startSSHBastion(t, clientSigner.PublicKey())
+
+	// The MySQL stand-in greets every connection
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	tunnel, err := newSSHTunnel(bastion, "vault", privateKey, hostKey)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	defer tunnel.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := tunnel.dialContext(context.Background(), target.Addr().String())
+		if err != nil {
+			t.Fatalf("no error expected, got: %s", err)
+		}
+		greeting, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(greeting) != "hello" {
+			t.Fatalf("expected greeting through the tunnel, got %q: %v", greeting, err)
+		}
+	}
+
+	// A bastion presenting another host key is rejected
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherPriv)
+	otherTunnel, err := newSSHTunnel(bastion, "vault", privateKey, string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherTunnel.dialContext(context.Background(), target.Addr().String()); err == nil {
+		t.Fatalf("expected the host key mismatch to fail the dial")
+	}
+}
+
+func TestInit_sshTunnelRequiresSettings(t *testing.T) {
+	conf := map[string]interface{}{
+		"connection_url": "user:password@tcp(localhost:3306)/test",
+		"ssh_tunnel":     true,
+		"ssh_host":       "bastion.example.com",
+	}
+
+	c := &mySQLConnectionProducer{}
+	if _, err := c.Init(context.Background(), conf, false); err == nil {
+		t.Fatalf("err expected without the SSH credentials, got nil")
+	}
+}
@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Endpoints reported by ActiveEndpoint
+const (
+	endpointPrimary = "primary"
+	endpointStandby = "standby"
+)
+
+// ActiveEndpoint returns "primary", or "standby" once the standby has been
+// promoted. The second return value is false if the plugin isn't
+// initialized.
+func (c *mySQLConnectionProducer) ActiveEndpoint() (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.standbyPromoted {
+		return endpointStandby, c.Initialized
+	}
+	return endpointPrimary, c.Initialized
+}
+
+// startStandbyMonitor starts health checking the primary and standby if a
+// standby_connection_url is configured.
+func (m *MySQL) startStandbyMonitor() {
+	m.stopStandbyMonitor()
+	if m.StandbyConnectionURL == "" {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	m.standbyStopCh = stopCh
+
+	go func() {
+		ticker := time.NewTicker(m.standbyHealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), m.standbyHealthCheckInterval)
+				promoted, err := m.checkStandby(ctx)
+				cancel()
+				if err != nil {
+					m.logger.Error("standby health check failed", "error", err)
+				}
+				if promoted {
+					m.logger.Warn("promoted the standby connection after failed primary health checks", "failures", m.StandbyPromotionFailures)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopStandbyMonitor stops the standby health checks if they are running.
+func (m *MySQL) stopStandbyMonitor() {
+	if m.standbyStopCh != nil {
+		close(m.standbyStopCh)
+		m.standbyStopCh = nil
+	}
+}
+
+// checkStandby pings the primary and the standby, which keeps the standby
+// pool warm, and promotes the standby once standby_promotion_failures
+// consecutive primary health checks failed. A standby that fails its own
+// health check isn't promoted. It reports whether the standby was promoted.
+func (m *MySQL) checkStandby(ctx context.Context) (bool, error) {
+	if err := m.lockOperation(ctx); err != nil {
+		return false, err
+	}
+	defer m.Unlock()
+
+	if m.standbyPromoted || !m.Initialized {
+		return false, nil
+	}
+
+	primaryErr := pingConnection(ctx, m.Connection)
+	standbyErr := pingConnection(ctx, m.standbyConnection)
+	m.reportHealth(primaryErr)
+
+	if primaryErr == nil {
+		m.primaryFailures = 0
+		if standbyErr != nil {
+			return false, fmt.Errorf("standby is unhealthy: %w", standbyErr)
+		}
+		return false, nil
+	}
+
+	m.primaryFailures++
+	m.logger.Debug("primary health check failed", "failures", m.primaryFailures, "error", primaryErr)
+	if m.primaryFailures < m.StandbyPromotionFailures {
+		return false, nil
+	}
+	if standbyErr != nil {
+		return false, fmt.Errorf("primary is unhealthy but the standby can't be promoted: %w", standbyErr)
+	}
+
+	if m.db != nil {
+		m.db.Close()
+	}
+	m.db = m.standbyDB
+	m.standbyDB = nil
+	m.standbyPromoted = true
+
+	if security, err := m.connectionSecurity(); err == nil {
+		m.security = security
+	}
+	return true, nil
+}
+
+// standbyConnection returns the standby pool.
+func (c *mySQLConnectionProducer) standbyConnection(ctx context.Context) (interface{}, error) {
+	connURL, err := c.addTLStoURL(c.StandbyConnectionURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.standbyDB, err = c.openDB(ctx, c.standbyDB, connURL)
+	if err != nil {
+		return nil, err
+	}
+	return c.standbyDB, nil
+}
+
+// pingConnection opens the pool returned by connect and pings it.
+func pingConnection(ctx context.Context, connect func(context.Context) (interface{}, error)) error {
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	return db.(*sql.DB).PingContext(ctx)
+}
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestMySQL_checkStandby(t *testing.T) {
+	db := newFakeMySQL(t, &fakeDriver{pingErr: errors.New("primary down")})
+	db.ConnectionURL = "user:password@tcp(127.0.0.1:1)/"
+	db.StandbyConnectionURL = "user:password@tcp(127.0.0.1:2)/"
+	db.StandbyPromotionFailures = 2
+
+	standby := sql.OpenDB(&fakeDriver{})
+	db.standbyDB = standby
+
+	promoted, err := db.checkStandby(context.Background())
+	if err != nil || promoted {
+		t.Fatalf("expected no promotion after one failure, got: %t, %v", promoted, err)
+	}
+	if endpoint, _ := db.ActiveEndpoint(); endpoint != endpointPrimary {
+		t.Fatalf("expected %q, got %q", endpointPrimary, endpoint)
+	}
+
+	promoted, err = db.checkStandby(context.Background())
+	if err != nil || !promoted {
+		t.Fatalf("expected promotion after two failures, got: %t, %v", promoted, err)
+	}
+	if endpoint, _ := db.ActiveEndpoint(); endpoint != endpointStandby {
+		t.Fatalf("expected %q, got %q", endpointStandby, endpoint)
+	}
+	if db.db != standby {
+		t.Fatalf("expected the standby pool to be the primary pool")
+	}
+
+	dsn, err := db.EffectiveDSN()
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if config, _ := parseDSN(dsn); config.Addr != "127.0.0.1:2" {
+		t.Fatalf("expected the standby DSN, got: %s", dsn)
+	}
+}
+
+func TestMySQL_checkStandby_unhealthyStandby(t *testing.T) {
+	db := newFakeMySQL(t, &fakeDriver{pingErr: errors.New("primary down")})
+	db.ConnectionURL = "user:password@tcp(127.0.0.1:1)/"
+	db.StandbyConnectionURL = "user:password@tcp(127.0.0.1:2)/"
+	db.StandbyPromotionFailures = 1
+
+	promoted, err := db.checkStandby(context.Background())
+	if err == nil || promoted {
+		t.Fatalf("expected no promotion of an unhealthy standby, got: %t, %v", promoted, err)
+	}
+	if endpoint, _ := db.ActiveEndpoint(); endpoint != endpointPrimary {
+		t.Fatalf("expected %q, got %q", endpointPrimary, endpoint)
+	}
+}
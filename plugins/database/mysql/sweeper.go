@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// recordExpirationSQL stores the user's expiration as a user attribute
+	// so it can be found on the server. Requires MySQL 8.0.21 or later.
+	recordExpirationSQL = `
+		ALTER USER '{{name}}'@'{{host}}' ATTRIBUTE '{"vault_expires_at": {{expiration_unix}}}'
+	`
+
+	expiredUsersSQL = `
+		SELECT USER, HOST FROM INFORMATION_SCHEMA.USER_ATTRIBUTES
+		WHERE USER LIKE ?
+		AND CAST(JSON_UNQUOTE(JSON_EXTRACT(ATTRIBUTE, '$.vault_expires_at')) AS UNSIGNED) < UNIX_TIMESTAMP()
+	`
+)
+
+// startSweeper starts the background sweep for expired users if an
+// expired_user_sweep_interval is configured.
+func (m *MySQL) startSweeper() {
+	m.stopSweeper()
+	if m.expiredUserSweepInterval <= 0 {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	m.sweeperStopCh = stopCh
+
+	go func() {
+		ticker := time.NewTicker(m.expiredUserSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), m.expiredUserSweepInterval)
+				dropped, err := m.sweepExpiredUsers(ctx)
+				cancel()
+				if err != nil {
+					m.logger.Error("failed to sweep expired users", "dropped", dropped, "error", err)
+					continue
+				}
+				if dropped > 0 {
+					m.logger.Info("dropped expired users", "dropped", dropped)
+				}
+			}
+		}
+	}()
+}
+
+// stopSweeper stops the background sweep if it is running.
+func (m *MySQL) stopSweeper() {
+	if m.sweeperStopCh != nil {
+		close(m.sweeperStopCh)
+		m.sweeperStopCh = nil
+	}
+}
+
+// sweepExpiredUsers drops every prefixed user whose recorded expiration has
+// passed and returns the number of users dropped.
+func (m *MySQL) sweepExpiredUsers(ctx context.Context) (int, error) {
+	db, err := m.operationConnection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, expiredUsersSQL, likePrefix(m.UsernamePrefix))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type account struct{ user, host string }
+	var expired []account
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.user, &a.host); err != nil {
+			return 0, err
+		}
+		expired = append(expired, a)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, a := range expired {
+		query := fmt.Sprintf("DROP USER IF EXISTS '%s'@'%s'", escapeString(a.user), escapeString(a.host))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return dropped, fmt.Errorf("failed to drop expired user %q: %w", a.user, err)
+		}
+		m.metadata.delete(a.user)
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// expirationUnix formats t as unix seconds for the expiration attribute.
+func expirationUnix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// likePrefix returns a LIKE pattern matching every name starting with
+// prefix.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
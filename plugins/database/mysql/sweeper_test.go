@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLikePrefix(t *testing.T) {
+	tests := map[string]string{
+		"vault":   "vault%",
+		"vault_":  `vault\_%`,
+		"50%_off": `50\%\_off%`,
+		`back\`:   `back\\%`,
+	}
+
+	for prefix, expected := range tests {
+		if actual := likePrefix(prefix); actual != expected {
+			t.Fatalf("likePrefix(%q) = %q, expected %q", prefix, actual, expected)
+		}
+	}
+}
+
+func TestInit_expiredUserSweepRequiresPrefix(t *testing.T) {
+	conf := map[string]interface{}{
+		"connection_url":              "user:password@tcp(localhost:3306)/test",
+		"expired_user_sweep_interval": "1h",
+	}
+
+	db := new(false)
+	if _, err := db.Init(context.Background(), conf, false); err == nil {
+		t.Fatalf("expected error without username_prefix")
+	}
+
+	conf["username_prefix"] = "vault_"
+	if _, err := db.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+}
+
+func TestMySQL_sweepExpiredUsers(t *testing.T) {
+	var db *MySQL
+	var lockErrs []error
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			expiredUsersSQL: {
+				columns: []string{"USER", "HOST"},
+				values:  [][]driver.Value{{"vault_a", "%"}, {"vault_b", "10.0.0.%"}},
+			},
+		},
+		// The sweep must not hold the lock that user operations take
+		onExec: func(string) {
+			err := db.lockOperation(context.Background())
+			if err == nil {
+				db.Unlock()
+			}
+			lockErrs = append(lockErrs, err)
+		},
+	}
+	db = newFakeMySQL(t, d)
+	db.UsernamePrefix = "vault_"
+	db.lockTimeout = 50 * time.Millisecond
+	db.metadata.put("vault_a", userMetadata{metadataRoleName: "app"})
+
+	dropped, err := db.sweepExpiredUsers(context.Background())
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if dropped != 2 {
+		t.Fatalf("expected 2 users dropped, got: %d", dropped)
+	}
+
+	expected := []string{
+		"query: " + expiredUsersSQL,
+		"exec: DROP USER IF EXISTS 'vault_a'@'%'",
+		"exec: DROP USER IF EXISTS 'vault_b'@'10.0.0.%'",
+	}
+	if actual := d.calls(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+	for _, err := range lockErrs {
+		if err != nil {
+			t.Fatalf("expected the lock to be free while dropping users, got: %s", err)
+		}
+	}
+	if _, ok := db.metadata.get("vault_a"); ok {
+		t.Fatalf("expected the dropped user's metadata to be removed")
+	}
+}
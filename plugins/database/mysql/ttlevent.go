@@ -0,0 +1,101 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// createTTLEventSQL drops the user once its expiration has passed,
+	// should Vault fail to revoke it. The server drops the event after it
+	// ran. FROM_UNIXTIME and AT both use the session time zone.
+	createTTLEventSQL = `
+		CREATE EVENT {{ttl_event}} ON SCHEDULE AT FROM_UNIXTIME({{expiration_unix}})
+		DO DROP USER IF EXISTS '{{name}}'@'{{host}}'
+	`
+
+	rescheduleTTLEventSQL = "ALTER EVENT %s ON SCHEDULE AT FROM_UNIXTIME(%s)"
+	dropTTLEventSQL       = "DROP EVENT IF EXISTS %s"
+)
+
+// ttlEventName returns the quoted, schema qualified name of the user's
+// server_side_ttl_events event. Usernames can be longer than event names
+// and contain any character, so the name is derived from a hash of the
+// username.
+func ttlEventName(schema, username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return "`" + strings.Replace(schema, "`", "``", -1) + "`.`vault_ttl_" + hex.EncodeToString(sum[:16]) + "`"
+}
+
+// checkTTLEventSupport returns an error if the server can't run the events
+// of server_side_ttl_events. The event scheduler state is cached with the
+// capabilities, so starting it is noticed once the plugin is initialized
+// again.
+func (m *MySQL) checkTTLEventSupport(ctx context.Context) error {
+	capabilities, err := m.Capabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to detect server capabilities for server_side_ttl_events: %w", err)
+	}
+	if !versionAtLeast(capabilities.Version, []int{5, 7, 8}, []int{10, 1, 3}) {
+		return fmt.Errorf("server version %s does not support DROP USER IF EXISTS, which server_side_ttl_events needs", capabilities.Version)
+	}
+	if !capabilities.EventScheduler {
+		return fmt.Errorf("server_side_ttl_events requires the event scheduler to be running")
+	}
+	return nil
+}
+
+// rescheduleTTLEvent moves the user's event to the new expiration if
+// server_side_ttl_events is set. Users without an event, because they were
+// created before it was set or the event already ran, are left alone.
+func (m *MySQL) rescheduleTTLEvent(ctx context.Context, username string, expiration time.Time) error {
+	if !m.ServerSideTTLEvents {
+		return nil
+	}
+
+	db, err := m.operationConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(rescheduleTTLEventSQL, ttlEventName(m.ServerSideTTLEventSchema, username), expirationUnix(m.serverTime(ctx, expiration)))
+	_, err = db.ExecContext(ctx, query)
+	if isUnknownEventError(err) {
+		m.logger.Debug("user has no server side TTL event to reschedule", "username", username)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reschedule server side TTL event: %w", err)
+	}
+	return nil
+}
+
+// dropTTLEvent drops the user's event if server_side_ttl_events is set.
+func (m *MySQL) dropTTLEvent(ctx context.Context, db *sql.DB, username string) error {
+	if !m.ServerSideTTLEvents {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(dropTTLEventSQL, ttlEventName(m.ServerSideTTLEventSchema, username)))
+	if err != nil {
+		return fmt.Errorf("failed to drop server side TTL event: %w", err)
+	}
+	return nil
+}
+
+// isUnknownEventError reports whether the event doesn't exist (1539).
+func isUnknownEventError(err error) bool {
+	var mysqlErr *stdmysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1539
+}
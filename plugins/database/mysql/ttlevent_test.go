@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+	"github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestTTLEventName(t *testing.T) {
+	name := ttlEventName("ops`db", "v_test")
+	if !strings.HasPrefix(name, "`ops``db`.`vault_ttl_") || len(name) != len("`ops``db`.`vault_ttl_`")+32 {
+		t.Fatalf("unexpected event name %q", name)
+	}
+	if other := ttlEventName("ops`db", "v_other"); other == name {
+		t.Fatalf("expected different users to get different event names, got %q", name)
+	}
+}
+
+func TestMySQL_NewUser_serverSideTTLEvents(t *testing.T) {
+	type testCase struct {
+		scheduler string
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"scheduler running": {scheduler: "ON"},
+		"scheduler stopped": {scheduler: "OFF", expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &fakeDriver{
+				rows: map[string]fakeRows{
+					serverVersionSQL: {
+						columns: []string{"VERSION()"},
+						values:  [][]driver.Value{{"8.0.32"}},
+					},
+					eventSchedulerSQL: {
+						columns: []string{"@@GLOBAL.event_scheduler"},
+						values:  [][]driver.Value{{test.scheduler}},
+					},
+				},
+			}
+			db := newFakeMySQL(t, d)
+			db.ServerSideTTLEvents = true
+			db.ServerSideTTLEventSchema = "ops"
+
+			expiration := time.Now().Add(time.Hour)
+			req := dbplugin.NewUserRequest{
+				UsernameConfig: dbplugin.UsernameMetadata{
+					DisplayName: "test",
+					RoleName:    "app",
+				},
+				Statements: dbplugin.Statements{
+					Commands: []string{"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'"},
+				},
+				Password:   "secret",
+				Expiration: expiration,
+			}
+			resp, err := db.NewUser(context.Background(), req)
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got nil")
+				}
+				for _, call := range d.calls() {
+					if strings.Contains(call, "CREATE USER") {
+						t.Fatalf("expected no user to be created, got calls: %v", d.calls())
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+
+			expected := fmt.Sprintf("CREATE EVENT %s ON SCHEDULE AT FROM_UNIXTIME(%d)", ttlEventName("ops", resp.Username), expiration.Unix())
+			found := false
+			for _, call := range d.calls() {
+				if strings.Contains(call, expected) && strings.Contains(call, fmt.Sprintf("DROP USER IF EXISTS '%s'@'%%'", resp.Username)) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("expected %q in calls: %v", expected, d.calls())
+			}
+		})
+	}
+}
+
+func TestMySQL_serverSideTTLEvents_renewAndRevoke(t *testing.T) {
+	event := ttlEventName("ops", "v_test")
+	expiration := time.Now().Add(2 * time.Hour)
+
+	d := &fakeDriver{}
+	db := newFakeMySQL(t, d)
+	db.ServerSideTTLEvents = true
+	db.ServerSideTTLEventSchema = "ops"
+
+	_, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username:   "v_test",
+		Expiration: &dbplugin.ChangeExpiration{NewExpiration: expiration},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	_, err = db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{
+		Username: "v_test",
+		Statements: dbplugin.Statements{
+			Commands: []string{"DROP USER '{{name}}'@'%'"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("exec: ALTER EVENT %s ON SCHEDULE AT FROM_UNIXTIME(%d)", event, expiration.Unix()),
+		"exec: DROP EVENT IF EXISTS " + event,
+		"begin",
+		"exec: DROP USER 'v_test'@'%'",
+		"commit",
+	}
+	if actual := d.calls(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected calls:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	// Users created before server_side_ttl_events was set have no event
+	d.errs = map[string]error{"ALTER EVENT": &stdmysql.MySQLError{Number: 1539}}
+	_, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+		Username:   "v_test",
+		Expiration: &dbplugin.ChangeExpiration{NewExpiration: expiration},
+	})
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+}
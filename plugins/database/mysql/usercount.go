@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+const (
+	dynamicUserCountSQL = `
+		SELECT COUNT(*) FROM mysql.user WHERE User LIKE ?
+	`
+
+	// expiredUserCountSQL counts the prefixed users whose recorded
+	// expiration has passed. Expirations are only recorded when the expired
+	// user sweep is enabled, on MySQL 8.0.21 or later.
+	expiredUserCountSQL = `
+		SELECT COUNT(*) FROM INFORMATION_SCHEMA.USER_ATTRIBUTES
+		WHERE USER LIKE ?
+		AND CAST(JSON_UNQUOTE(JSON_EXTRACT(ATTRIBUTE, '$.vault_expires_at')) AS UNSIGNED) < UNIX_TIMESTAMP()
+	`
+)
+
+var (
+	dynamicUsersMetricKey = []string{"database", mySQLTypeName, "dynamic_users"}
+	expiredUsersMetricKey = []string{"database", mySQLTypeName, "expired_users"}
+)
+
+// startUserCounter starts emitting the number of prefixed users on the
+// server as a gauge if a user_count_interval is configured.
+func (m *MySQL) startUserCounter() {
+	m.stopUserCounter()
+	if m.userCountInterval <= 0 {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	m.userCounterStopCh = stopCh
+
+	go func() {
+		ticker := time.NewTicker(m.userCountInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), m.userCountInterval)
+				m.emitUserCounts(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// stopUserCounter stops the user count gauge if it is running.
+func (m *MySQL) stopUserCounter() {
+	if m.userCounterStopCh != nil {
+		close(m.userCounterStopCh)
+		m.userCounterStopCh = nil
+	}
+}
+
+// emitUserCounts sets the dynamic and expired user gauges. The expired user
+// count estimates leaked users and is skipped on servers that don't record
+// user attributes.
+func (m *MySQL) emitUserCounts(ctx context.Context) {
+	total, err := m.countUsers(ctx, dynamicUserCountSQL)
+	if err != nil {
+		m.logger.Error("failed to count dynamic users", "error", err)
+		return
+	}
+	metrics.SetGauge(dynamicUsersMetricKey, float32(total))
+
+	expired, err := m.countUsers(ctx, expiredUserCountSQL)
+	if err != nil {
+		m.logger.Debug("failed to count expired users", "error", err)
+		return
+	}
+	metrics.SetGauge(expiredUsersMetricKey, float32(expired))
+}
+
+// countUsers runs a count query for the configured username prefix.
+func (m *MySQL) countUsers(ctx context.Context, query string) (int, error) {
+	db, err := m.readOperationConnection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, likePrefix(m.UsernamePrefix)).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
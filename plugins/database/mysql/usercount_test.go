@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestCountUsers(t *testing.T) {
+	d := &fakeDriver{
+		rows: map[string]fakeRows{
+			dynamicUserCountSQL: {
+				columns: []string{"COUNT(*)"},
+				values:  [][]driver.Value{{int64(7)}},
+			},
+		},
+		errs: map[string]error{
+			expiredUserCountSQL: errors.New("Unknown table 'USER_ATTRIBUTES'"),
+		},
+	}
+	db := newFakeMySQL(t, d)
+	db.UsernamePrefix = "vault_"
+
+	count, err := db.countUsers(context.Background(), dynamicUserCountSQL)
+	if err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if count != 7 {
+		t.Fatalf("expected 7 users, got: %d", count)
+	}
+
+	if _, err := db.countUsers(context.Background(), expiredUserCountSQL); err == nil {
+		t.Fatalf("expected error from expired user count")
+	}
+}
+
+func TestInit_userCountRequiresPrefix(t *testing.T) {
+	conf := map[string]interface{}{
+		"connection_url":      "user:password@tcp(localhost:3306)/test",
+		"user_count_interval": "5m",
+	}
+
+	db := new(false)
+	if _, err := db.Init(context.Background(), conf, false); err == nil {
+		t.Fatalf("expected error without username_prefix")
+	}
+
+	conf["username_prefix"] = "vault_"
+	if _, err := db.Init(context.Background(), conf, false); err != nil {
+		t.Fatalf("no error expected, got: %s", err)
+	}
+	if db.userCountInterval.Minutes() != 5 {
+		t.Fatalf("expected interval of 5m, got: %s", db.userCountInterval)
+	}
+}